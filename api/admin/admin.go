@@ -0,0 +1,30 @@
+// Package admin implements the Terrarium administration API. These routes are not part of the Terraform registry
+// protocols and manage the registry itself, for example the lifecycle of published module versions. Every route
+// requires the admin permission on the organization it acts on.
+package admin
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/terrariumcloud/terrarium-lite/internal/auth"
+	"github.com/terrariumcloud/terrarium-lite/internal/versionlock"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/drivers"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/responses"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/stores"
+)
+
+// NewAdminAPI Creates a new instance of the admin API setting up its routes under the given path
+func NewAdminAPI(router *mux.Router, path string, store stores.ModuleStore, fileStore drivers.TerrariumStorageDriver, authorizer auth.Authorizer, responseHandler responses.APIResponseWriter, errorHandler responses.APIErrorWriter, logger logrus.FieldLogger) *AdminAPI {
+	a := &AdminAPI{
+		Router:          router.PathPrefix(path).Subrouter(),
+		ModuleStore:     store,
+		FileStore:       fileStore,
+		Authorizer:      authorizer,
+		ErrorHandler:    errorHandler,
+		ResponseHandler: responseHandler,
+		Logger:          logger,
+		VersionLocks:    &versionlock.Locks{},
+	}
+	a.SetupRoutes()
+	return a
+}
@@ -0,0 +1,110 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/terrariumcloud/terrarium-lite/internal/auth"
+	"github.com/terrariumcloud/terrarium-lite/internal/responder"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/events"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/modules"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/stores"
+)
+
+// versionStore holds a single module version, the methods of the module store approvals do not use are left nil
+type versionStore struct {
+	stores.ModuleStore
+	module  *modules.Module
+	updated *modules.VersionLifecycle
+}
+
+func (s *versionStore) ReadModuleVersion(_ context.Context, orgName string, moduleName string, providerName string, version string) (*modules.Module, error) {
+	if s.module == nil || version != s.module.Version {
+		return nil, stores.ErrModuleVersionNotFound
+	}
+	return s.module.Copy(), nil
+}
+
+func (s *versionStore) UpdateVersionLifecycle(_ context.Context, orgName string, moduleName string, providerName string, version string, lifecycle *modules.VersionLifecycle) error {
+	s.updated = lifecycle
+	return nil
+}
+
+type recordedEvents []*events.Event
+
+func (r *recordedEvents) Emit(event *events.Event) {
+	*r = append(*r, event)
+}
+
+func TestDecide(t *testing.T) {
+	pending := &modules.VersionLifecycle{State: modules.VersionPending, RequestedBy: "alice"}
+	tests := []struct {
+		name       string
+		lifecycle  *modules.VersionLifecycle
+		version    string
+		approver   string
+		handler    func(*AdminAPI) http.Handler
+		body       string
+		wantStatus int
+		wantState  modules.VersionState
+		wantEvent  bool
+		wantBody   string
+	}{
+		{"approved by another admin", pending, "1.0.0", "bob", (*AdminAPI).ApproveHandler, "", http.StatusOK, modules.VersionActive, true, ""},
+		{"rejected by another admin", pending, "1.0.0", "bob", (*AdminAPI).RejectHandler, `{"reason":"opens port 22"}`, http.StatusOK, modules.VersionRejected, false, ""},
+
+		{"approved by its publisher", pending, "1.0.0", "alice", (*AdminAPI).ApproveHandler, "", http.StatusForbidden, "", false, "different identity than their publisher"},
+		{"rejected by its publisher", pending, "1.0.0", "alice", (*AdminAPI).RejectHandler, `{"reason":"oops"}`, http.StatusForbidden, "", false, "different identity than their publisher"},
+		{"rejected without a reason", pending, "1.0.0", "bob", (*AdminAPI).RejectHandler, `{}`, http.StatusBadRequest, "", false, "a reason is required"},
+		{"rejection with unknown fields", pending, "1.0.0", "bob", (*AdminAPI).RejectHandler, `{"reason":"no","state":"active"}`, http.StatusBadRequest, "", false, "invalid request body"},
+		{"version not pending", nil, "1.0.0", "bob", (*AdminAPI).ApproveHandler, "", http.StatusConflict, "", false, "not pending approval"},
+		{"version already rejected", &modules.VersionLifecycle{State: modules.VersionRejected, RequestedBy: "alice"}, "1.0.0", "bob", (*AdminAPI).ApproveHandler, "", http.StatusConflict, "", false, "not pending approval"},
+		{"unknown version", pending, "2.0.0", "bob", (*AdminAPI).ApproveHandler, "", http.StatusNotFound, "", false, "module version not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &versionStore{module: &modules.Module{Organization: "acme", Name: "vpc", Provider: "aws", Version: "1.0.0", Lifecycle: tt.lifecycle}}
+			emitted := &recordedEvents{}
+			api := &AdminAPI{
+				ModuleStore:     store,
+				ErrorHandler:    &responder.TerrariumAPIErrorHandler{Logger: logrus.New()},
+				ResponseHandler: &responder.TerrariumAPIResponseWriter{Logger: logrus.New()},
+				Logger:          logrus.New(),
+				Events:          emitted,
+			}
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			req = mux.SetURLVars(req, map[string]string{"organization_name": "acme", "name": "vpc", "provider": "aws", "version": tt.version})
+			req = req.WithContext(auth.WithIdentity(req.Context(), &auth.Identity{Subject: tt.approver, Type: auth.IdentityUser}))
+			rec := httptest.NewRecorder()
+			tt.handler(api).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Fatalf("body = %s, want it to contain %q", rec.Body.String(), tt.wantBody)
+			}
+			if tt.wantState == "" {
+				if store.updated != nil {
+					t.Fatalf("lifecycle updated to %s, want it unchanged", store.updated.State)
+				}
+			} else {
+				if store.updated == nil || store.updated.State != tt.wantState {
+					t.Fatalf("lifecycle updated to %+v, want state %s", store.updated, tt.wantState)
+				}
+				if store.updated.RequestedBy != "alice" || store.updated.UpdatedBy != tt.approver {
+					t.Fatalf("lifecycle requested by %q and updated by %q, want alice and %s", store.updated.RequestedBy, store.updated.UpdatedBy, tt.approver)
+				}
+			}
+			// Versions are only announced as published once they are approved
+			if published := len(*emitted) == 1 && (*emitted)[0].Type == events.VersionPublished; published != tt.wantEvent || len(*emitted) > 1 {
+				t.Fatalf("emitted %d events, want a published event %t", len(*emitted), tt.wantEvent)
+			}
+		})
+	}
+}
@@ -0,0 +1,702 @@
+package admin
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/terrariumcloud/terrarium-lite/internal/auditlog"
+	"github.com/terrariumcloud/terrarium-lite/internal/auth"
+	"github.com/terrariumcloud/terrarium-lite/internal/endpoints"
+	"github.com/terrariumcloud/terrarium-lite/internal/logging"
+	"github.com/terrariumcloud/terrarium-lite/internal/versionlock"
+	"github.com/terrariumcloud/terrarium-lite/internal/webhook"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/audit"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/events"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/modules"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/webhooks"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/drivers"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/responses"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/stores"
+)
+
+// maxRequestBody bounds the size of JSON request bodies accepted by the admin API
+const maxRequestBody int64 = 1 << 20
+
+const (
+	// DefaultAuditLimit is the number of audit events returned when a query sets no limit
+	DefaultAuditLimit int = 1000
+	// MaxAuditLimit is the largest number of audit events returned by a single query. Larger exports are made by
+	// querying consecutive time ranges.
+	MaxAuditLimit int = 100000
+)
+
+// errWebhooksDisabled is returned by the webhook delivery routes when no webhook endpoints are configured
+var errWebhooksDisabled = errors.New("webhooks are not configured")
+
+// AuditTruncatedHeader is set on audit exports leaving out older events to respect the limit of the query
+const AuditTruncatedHeader string = "X-Audit-Truncated"
+
+// AdminAPI is a struct implementing the handlers for the AdminAPIInterface from the endpoints package in Terrarium
+type AdminAPI struct {
+	Router          *mux.Router
+	ModuleStore     stores.ModuleStore
+	FileStore       drivers.TerrariumStorageDriver
+	Authorizer      auth.Authorizer
+	ErrorHandler    responses.APIErrorWriter
+	ResponseHandler responses.APIResponseWriter
+	Logger          logrus.FieldLogger
+	// Audit records the changes made through the admin API to the audit trail
+	Audit *auditlog.Recorder
+	// AuditStore is queried for the audit trail, which is not served when it is nil
+	AuditStore stores.AuditStore
+	// Events is notified of the changes made through the admin API
+	Events events.Emitter
+	// Webhooks serves the webhook delivery routes, which respond 404 when it is nil
+	Webhooks *webhook.Dispatcher
+	// VersionLocks serialises deletions of a version with publishes of it through the module API
+	VersionLocks *versionlock.Locks
+	// IndexReporter lists the archives the database driver refuses to serve, none are listed when it is nil
+	IndexReporter drivers.IndexReporter
+}
+
+// LifecycleRequest is the body of a request changing the lifecycle state of a module version
+type LifecycleRequest struct {
+	State       modules.VersionState `json:"state"`
+	Reason      string               `json:"reason"`
+	Replacement string               `json:"replacement"`
+	Link        string               `json:"link"`
+}
+
+// RejectionRequest is the body of a request rejecting a module version pending approval
+type RejectionRequest struct {
+	Reason string `json:"reason"`
+}
+
+// PendingVersion is a module version awaiting approval
+type PendingVersion struct {
+	modules.ModuleVersionRef
+	Checksum    string    `json:"checksum"`
+	RequestedBy string    `json:"requested_by"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// DeletionResponse lists the module versions removed by a delete request, or that would be removed in a dry run
+type DeletionResponse struct {
+	DryRun    bool                        `json:"dry_run"`
+	DeletedBy string                      `json:"deleted_by,omitempty"`
+	Versions  []*modules.ModuleVersionRef `json:"versions"`
+	// Failed is the version a delete request stopped at, the versions listed before it were removed
+	Failed *modules.ModuleVersionRef `json:"failed,omitempty"`
+	Error  string                    `json:"error,omitempty"`
+}
+
+// AuditResponse lists audit events, oldest first
+type AuditResponse struct {
+	Events []*audit.Event `json:"events"`
+	// Truncated is set when older matching events were left out to respect the limit of the query
+	Truncated bool `json:"truncated"`
+}
+
+// GetVersionLifecycleHandler returns the lifecycle state of a module version. Versions that were never deprecated
+// or yanked are reported as active.
+func (a *AdminAPI) GetVersionLifecycleHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		module, err := a.findVersion(r)
+		if err != nil {
+			a.writeStoreError(rw, r, err)
+			return
+		}
+		lifecycle := module.Lifecycle
+		if lifecycle == nil {
+			lifecycle = &modules.VersionLifecycle{State: modules.VersionActive}
+		}
+		a.ResponseHandler.Write(rw, lifecycle, http.StatusOK)
+	})
+}
+
+// UpdateVersionLifecycleHandler deprecates, yanks or restores a module version. Deprecated versions are listed with
+// a deprecation notice, yanked versions are no longer listed but remain downloadable by exact version. Versions
+// pending approval or rejected are only changed through the approve and reject routes. Lifecycle changes are recorded
+// against the identity making them, the admin permission the route requires is never granted to anonymous callers.
+func (a *AdminAPI) UpdateVersionLifecycleHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		req := &LifecycleRequest{}
+		decoder := json.NewDecoder(io.LimitReader(r.Body, maxRequestBody))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(req); err != nil {
+			a.ErrorHandler.Write(rw, fmt.Errorf("invalid request body - %w", err), http.StatusBadRequest)
+			return
+		}
+		lifecycle := &modules.VersionLifecycle{
+			State:       req.State,
+			Reason:      req.Reason,
+			Replacement: req.Replacement,
+			Link:        req.Link,
+			UpdatedAt:   time.Now().UTC(),
+		}
+		switch req.State {
+		case modules.VersionActive:
+			lifecycle.Reason, lifecycle.Replacement, lifecycle.Link = "", "", ""
+		case modules.VersionDeprecated, modules.VersionYanked:
+			if req.Reason == "" {
+				a.ErrorHandler.Write(rw, fmt.Errorf("a reason is required to mark a version %s", req.State), http.StatusBadRequest)
+				return
+			}
+		default:
+			a.ErrorHandler.Write(rw, fmt.Errorf("state must be one of %s, %s or %s", modules.VersionActive, modules.VersionDeprecated, modules.VersionYanked), http.StatusBadRequest)
+			return
+		}
+		current, err := a.findVersion(r)
+		if err != nil {
+			a.writeStoreError(rw, r, err)
+			return
+		}
+		if awaitingApproval(current) {
+			a.ErrorHandler.Write(rw, fmt.Errorf("version is %s, approve or reject it instead", current.Lifecycle.State), http.StatusConflict)
+			return
+		}
+		lifecycle.UpdatedBy = auth.Actor(r.Context())
+		params := mux.Vars(r)
+		err = a.ModuleStore.UpdateVersionLifecycle(r.Context(), params["organization_name"], params["name"], params["provider"], params["version"], lifecycle)
+		if err != nil {
+			a.writeStoreError(rw, r, err)
+			return
+		}
+		logging.FromContext(r.Context(), a.Logger).WithFields(logrus.Fields{
+			"organization": params["organization_name"],
+			"module":       params["name"],
+			"provider":     params["provider"],
+			"version":      params["version"],
+			"state":        lifecycle.State,
+			"updated_by":   lifecycle.UpdatedBy,
+		}).Info("updated version lifecycle")
+		a.Audit.Record(r, audit.ActionLifecycle, versionRef(current), audit.SnapshotOf(current), lifecycleSnapshot(current, lifecycle))
+		previous := modules.VersionActive
+		if current.Lifecycle != nil {
+			previous = current.Lifecycle.State
+		}
+		if previous != lifecycle.State {
+			changed := *current
+			changed.Lifecycle = lifecycle
+			a.emit(events.ForVersion(events.LifecycleEventType(lifecycle.State), &changed, lifecycle.UpdatedBy))
+		}
+		a.ResponseHandler.Write(rw, lifecycle, http.StatusOK)
+	})
+}
+
+// ListPendingHandler lists the module versions of an organization awaiting approval
+func (a *AdminAPI) ListPendingHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		versions, err := a.ModuleStore.ReadOrganizationModules(r.Context(), mux.Vars(r)["organization_name"])
+		if err != nil {
+			a.writeStoreError(rw, r, err)
+			return
+		}
+		pending := make([]*PendingVersion, 0)
+		for _, module := range versions {
+			if module.Lifecycle == nil || module.Lifecycle.State != modules.VersionPending {
+				continue
+			}
+			pending = append(pending, &PendingVersion{
+				ModuleVersionRef: versionRef(module),
+				Checksum:         module.Checksum,
+				RequestedBy:      module.Lifecycle.RequestedBy,
+				RequestedAt:      module.Lifecycle.UpdatedAt,
+			})
+		}
+		a.ResponseHandler.Write(rw, pending, http.StatusOK)
+	})
+}
+
+// ListProblemsHandler lists the archives of an organization which the database driver refuses to serve, because they
+// failed validation or no longer match their recorded checksum
+func (a *AdminAPI) ListProblemsHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		problems := make([]*modules.IndexProblem, 0)
+		if a.IndexReporter != nil {
+			prefix := mux.Vars(r)["organization_name"] + "/"
+			for _, problem := range a.IndexReporter.IndexProblems() {
+				if strings.HasPrefix(problem.Source, prefix) {
+					problems = append(problems, problem)
+				}
+			}
+		}
+		a.ResponseHandler.Write(rw, problems, http.StatusOK)
+	})
+}
+
+// ApproveHandler makes a version pending approval available. The approver must be a different identity than the
+// publisher of the version.
+func (a *AdminAPI) ApproveHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		a.decide(rw, r, &modules.VersionLifecycle{State: modules.VersionActive})
+	})
+}
+
+// RejectHandler refuses a version pending approval, recording the reason. The version is never served but may be
+// published again for another review. The rejecting admin must be a different identity than the publisher.
+func (a *AdminAPI) RejectHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		req := &RejectionRequest{}
+		decoder := json.NewDecoder(io.LimitReader(r.Body, maxRequestBody))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(req); err != nil {
+			a.ErrorHandler.Write(rw, fmt.Errorf("invalid request body - %w", err), http.StatusBadRequest)
+			return
+		}
+		if req.Reason == "" {
+			a.ErrorHandler.Write(rw, errors.New("a reason is required to reject a version"), http.StatusBadRequest)
+			return
+		}
+		a.decide(rw, r, &modules.VersionLifecycle{State: modules.VersionRejected, Reason: req.Reason})
+	})
+}
+
+// decide records the approval or rejection of a version pending approval
+func (a *AdminAPI) decide(rw http.ResponseWriter, r *http.Request, lifecycle *modules.VersionLifecycle) {
+	module, err := a.findVersion(r)
+	if err != nil {
+		a.writeStoreError(rw, r, err)
+		return
+	}
+	if module.Lifecycle == nil || module.Lifecycle.State != modules.VersionPending {
+		a.ErrorHandler.Write(rw, errors.New("version is not pending approval"), http.StatusConflict)
+		return
+	}
+	approver := auth.Actor(r.Context())
+	if approver == module.Lifecycle.RequestedBy {
+		a.ErrorHandler.Write(rw, errors.New("versions must be approved or rejected by a different identity than their publisher"), http.StatusForbidden)
+		return
+	}
+	lifecycle.RequestedBy = module.Lifecycle.RequestedBy
+	lifecycle.UpdatedBy = approver
+	lifecycle.UpdatedAt = time.Now().UTC()
+	err = a.ModuleStore.UpdateVersionLifecycle(r.Context(), module.Organization, module.Name, module.Provider, module.Version, lifecycle)
+	if err != nil {
+		a.writeStoreError(rw, r, err)
+		return
+	}
+	logging.FromContext(r.Context(), a.Logger).WithFields(logrus.Fields{
+		"organization": module.Organization,
+		"module":       module.Name,
+		"provider":     module.Provider,
+		"version":      module.Version,
+		"state":        lifecycle.State,
+		"requested_by": lifecycle.RequestedBy,
+		"updated_by":   lifecycle.UpdatedBy,
+	}).Info("decided on pending module version")
+	action := audit.ActionApprove
+	if lifecycle.State == modules.VersionRejected {
+		action = audit.ActionReject
+	}
+	a.Audit.Record(r, action, versionRef(module), audit.SnapshotOf(module), lifecycleSnapshot(module, lifecycle))
+	if lifecycle.State == modules.VersionActive {
+		approved := *module
+		approved.Lifecycle = lifecycle
+		a.emit(events.ForVersion(events.VersionPublished, &approved, approver))
+	}
+	a.ResponseHandler.Write(rw, lifecycle, http.StatusOK)
+}
+
+// awaitingApproval reports whether a version is pending approval or was rejected, states only changed by approvers
+// or by publishing the version again
+func awaitingApproval(module *modules.Module) bool {
+	return module.Lifecycle != nil && (module.Lifecycle.State == modules.VersionPending || module.Lifecycle.State == modules.VersionRejected)
+}
+
+// DeleteHandler removes a module version, every version of a module or every module of an organization depending on
+// the route variables present. With dry_run=true the versions that would be removed are listed without removing them.
+// Versions are removed one at a time, each holding the lock publishes of the version take. The archive of a version
+// is removed before its index entry so that only completed deletions are recorded, and it is put back when the index
+// entry cannot be removed. Should a version fail, the versions removed before it are listed in a 500 response with
+// the version that failed.
+func (a *AdminAPI) DeleteHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		dryRun := false
+		if value := r.URL.Query().Get("dry_run"); value != "" {
+			var err error
+			if dryRun, err = strconv.ParseBool(value); err != nil {
+				a.ErrorHandler.Write(rw, errors.New("dry_run must be true or false"), http.StatusBadRequest)
+				return
+			}
+		}
+		targets, err := a.deletionTargets(r)
+		if err != nil {
+			a.writeStoreError(rw, r, err)
+			return
+		}
+		resp := &DeletionResponse{DryRun: dryRun, DeletedBy: auth.Actor(r.Context()), Versions: []*modules.ModuleVersionRef{}}
+		for _, target := range targets {
+			ref := versionRef(target)
+			if dryRun {
+				resp.Versions = append(resp.Versions, &ref)
+				continue
+			}
+			deleted, err := a.deleteVersion(r, target.Source, ref, resp.DeletedBy)
+			if err != nil {
+				if len(resp.Versions) == 0 {
+					a.writeStoreError(rw, r, err)
+					return
+				}
+				resp.Failed = &ref
+				resp.Error = "failed deleting module version"
+				a.ResponseHandler.Write(rw, resp, http.StatusInternalServerError)
+				return
+			}
+			if deleted {
+				resp.Versions = append(resp.Versions, &ref)
+			}
+		}
+		a.ResponseHandler.Write(rw, resp, http.StatusOK)
+	})
+}
+
+// deleteVersion removes a single version and its archive, reporting false when the version was already gone by the
+// time its lock was taken
+func (a *AdminAPI) deleteVersion(r *http.Request, source string, ref modules.ModuleVersionRef, deletedBy string) (bool, error) {
+	unlock, err := a.VersionLocks.Lock(r.Context(), source)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	// A publish may have replaced the version since the targets were listed
+	module, err := a.ModuleStore.ReadModuleVersion(r.Context(), ref.Organization, ref.Name, ref.Provider, ref.Version)
+	if errors.Is(err, stores.ErrModuleVersionNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	logger := logging.FromContext(r.Context(), a.Logger).WithField("key", module.Source)
+	data, err := a.FileStore.FetchModuleSource(r.Context(), module.Source)
+	if err != nil {
+		return false, fmt.Errorf("failed reading module source - %w", err)
+	}
+	if err := a.FileStore.DeleteModuleSource(r.Context(), module.Source); err != nil {
+		return false, fmt.Errorf("failed deleting module source - %w", err)
+	}
+	deletion := &modules.Deletion{ModuleVersionRef: ref, DeletedBy: deletedBy, DeletedAt: time.Now().UTC()}
+	if err := a.ModuleStore.DeleteModuleVersion(r.Context(), deletion); err != nil {
+		if restoreErr := a.FileStore.StoreModuleSource(context.Background(), module.Source, data); restoreErr != nil {
+			logger.WithError(restoreErr).Error("failed restoring module source of a version that could not be deleted")
+		}
+		return false, err
+	}
+	if module.Signature != nil {
+		if err := a.FileStore.DeleteModuleSource(r.Context(), module.Signature.SignatureKey); err != nil {
+			logger.WithError(err).WithField("key", module.Signature.SignatureKey).Warn("failed deleting module signature")
+		}
+	}
+	logger.WithFields(logrus.Fields{
+		"organization": ref.Organization,
+		"module":       ref.Name,
+		"provider":     ref.Provider,
+		"version":      ref.Version,
+		"deleted_by":   deletedBy,
+	}).Info("deleted module version")
+	a.Audit.Record(r, audit.ActionDelete, ref, audit.SnapshotOf(module), nil)
+	a.emit(events.ForVersion(events.VersionDeleted, module, deletedBy))
+	return true, nil
+}
+
+// deletionTargets returns the versions a delete request applies to, failing with ErrModuleVersionNotFound when there
+// are none
+func (a *AdminAPI) deletionTargets(r *http.Request) ([]*modules.Module, error) {
+	params := mux.Vars(r)
+	if _, ok := params["version"]; ok {
+		module, err := a.findVersion(r)
+		if err != nil {
+			return nil, err
+		}
+		return []*modules.Module{module}, nil
+	}
+	var targets []*modules.Module
+	var err error
+	if _, ok := params["name"]; ok {
+		targets, err = a.ModuleStore.ReadModuleVersions(r.Context(), params["organization_name"], params["name"], params["provider"])
+	} else {
+		targets, err = a.ModuleStore.ReadOrganizationModules(r.Context(), params["organization_name"])
+	}
+	if errors.Is(err, stores.ErrModuleNotFound) || (err == nil && len(targets) == 0) {
+		return nil, stores.ErrModuleVersionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return targets, nil
+}
+
+// AuditHandler queries the audit trail. Events can be filtered by organization, module name, actor, action and a
+// since/until time range given in RFC 3339. With format=jsonl or format=csv the events are returned as a file for
+// export rather than in the usual response envelope. Querying an organization requires the admin permission on it,
+// querying every organization requires the admin permission on all of them.
+func (a *AdminAPI) AuditHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		orgName := query.Get("organization")
+		if orgName == "" {
+			orgName = auth.AnyOrganization
+		}
+		if err := a.Authorizer.Authorize(r.Context(), orgName, auth.PermissionAdmin); err != nil {
+			auth.WriteAuthorizationError(rw, err, a.ErrorHandler)
+			return
+		}
+		if a.AuditStore == nil {
+			a.ErrorHandler.Write(rw, errors.New("the database backend does not keep an audit trail"), http.StatusNotImplemented)
+			return
+		}
+		filter, err := parseAuditFilter(query)
+		if err != nil {
+			a.ErrorHandler.Write(rw, err, http.StatusBadRequest)
+			return
+		}
+		format := query.Get("format")
+		if format != "" && format != "json" && format != "jsonl" && format != "csv" {
+			a.ErrorHandler.Write(rw, errors.New("format must be one of json, jsonl or csv"), http.StatusBadRequest)
+			return
+		}
+		limit := filter.Limit
+		// One more event than the limit is read to tell whether any were left out
+		filter.Limit++
+		events, err := a.AuditStore.ReadEvents(r.Context(), filter)
+		if err != nil {
+			logging.FromContext(r.Context(), a.Logger).WithError(err).Error("failed reading audit trail")
+			a.ErrorHandler.Write(rw, errors.New("failed reading audit trail"), http.StatusInternalServerError)
+			return
+		}
+		resp := &AuditResponse{Events: events}
+		if len(events) > limit {
+			resp.Events, resp.Truncated = events[1:], true
+		}
+		switch format {
+		case "jsonl", "csv":
+			if resp.Truncated {
+				rw.Header().Set(AuditTruncatedHeader, "true")
+			}
+			if err := writeAuditExport(rw, format, resp.Events); err != nil {
+				logging.FromContext(r.Context(), a.Logger).WithError(err).Warn("failed writing audit export")
+			}
+		default:
+			a.ResponseHandler.Write(rw, resp, http.StatusOK)
+		}
+	})
+}
+
+// parseAuditFilter reads the filter of an audit query from its parameters
+func parseAuditFilter(query url.Values) (*audit.Filter, error) {
+	filter := &audit.Filter{
+		Organization: query.Get("organization"),
+		Name:         query.Get("module"),
+		Actor:        query.Get("actor"),
+		Action:       audit.Action(query.Get("action")),
+		Limit:        DefaultAuditLimit,
+	}
+	if filter.Action != "" {
+		known := false
+		for _, action := range audit.Actions {
+			known = known || action == filter.Action
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown action %q", filter.Action)
+		}
+	}
+	for name, value := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if raw := query.Get(name); raw != "" {
+			parsed, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be an RFC 3339 time", name)
+			}
+			*value = parsed
+		}
+	}
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > MaxAuditLimit {
+			return nil, fmt.Errorf("limit must be between 1 and %d", MaxAuditLimit)
+		}
+		filter.Limit = limit
+	}
+	return filter, nil
+}
+
+// writeAuditExport writes audit events as a JSON lines or CSV file. In CSV the before and after states of each event
+// are JSON encoded so that no detail is lost.
+func writeAuditExport(rw http.ResponseWriter, format string, events []*audit.Event) error {
+	contentType := "application/x-ndjson"
+	if format == "csv" {
+		contentType = "text/csv"
+	}
+	rw.Header().Set("Content-Type", contentType)
+	rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"terrarium-audit.%s\"", format))
+	rw.WriteHeader(http.StatusOK)
+	if format == "jsonl" {
+		encoder := json.NewEncoder(rw)
+		for _, event := range events {
+			if err := encoder.Encode(event); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	writer := csv.NewWriter(rw)
+	writer.Write([]string{"id", "timestamp", "action", "actor", "source_ip", "request_id", "organization", "name", "provider", "version", "before", "after", "reason"})
+	for _, event := range events {
+		before, _ := json.Marshal(event.Before)
+		after, _ := json.Marshal(event.After)
+		writer.Write([]string{event.ID, event.Timestamp.Format(time.RFC3339Nano), string(event.Action), event.Actor, event.SourceIP,
+			event.RequestID, event.Organization, event.Name, event.Provider, event.Version, string(before), string(after), event.Reason})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// ListDeliveriesHandler lists queued and recent webhook deliveries, optionally only those with the status given
+func (a *AdminAPI) ListDeliveriesHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if a.Webhooks == nil {
+			a.ErrorHandler.Write(rw, errWebhooksDisabled, http.StatusNotFound)
+			return
+		}
+		status := webhooks.DeliveryStatus(r.URL.Query().Get("status"))
+		switch status {
+		case "", webhooks.DeliveryPending, webhooks.DeliveryDelivered, webhooks.DeliveryFailed:
+		default:
+			a.ErrorHandler.Write(rw, fmt.Errorf("status must be one of %s, %s or %s", webhooks.DeliveryPending, webhooks.DeliveryDelivered, webhooks.DeliveryFailed), http.StatusBadRequest)
+			return
+		}
+		deliveries, err := a.Webhooks.Deliveries(r.Context(), status)
+		if err != nil {
+			a.writeStoreError(rw, r, err)
+			return
+		}
+		a.ResponseHandler.Write(rw, deliveries, http.StatusOK)
+	})
+}
+
+// GetDeliveryHandler returns a single webhook delivery
+func (a *AdminAPI) GetDeliveryHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if a.Webhooks == nil {
+			a.ErrorHandler.Write(rw, errWebhooksDisabled, http.StatusNotFound)
+			return
+		}
+		delivery, err := a.Webhooks.Delivery(r.Context(), mux.Vars(r)["delivery_id"])
+		if err != nil {
+			a.writeStoreError(rw, r, err)
+			return
+		}
+		a.ResponseHandler.Write(rw, delivery, http.StatusOK)
+	})
+}
+
+// RedeliverHandler sends the event of a delivered or failed webhook delivery again as a new delivery
+func (a *AdminAPI) RedeliverHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if a.Webhooks == nil {
+			a.ErrorHandler.Write(rw, errWebhooksDisabled, http.StatusNotFound)
+			return
+		}
+		delivery, err := a.Webhooks.Redeliver(r.Context(), mux.Vars(r)["delivery_id"])
+		switch {
+		case errors.Is(err, webhook.ErrNotPending):
+			a.ErrorHandler.Write(rw, err, http.StatusConflict)
+			return
+		case err != nil:
+			a.writeStoreError(rw, r, err)
+			return
+		}
+		logging.FromContext(r.Context(), a.Logger).WithFields(logrus.Fields{
+			"delivery":      delivery.ID,
+			"redelivery_of": delivery.RedeliveryOf,
+			"endpoint":      delivery.Endpoint,
+			"requested_by":  auth.Actor(r.Context()),
+		}).Info("queued webhook redelivery")
+		a.ResponseHandler.Write(rw, delivery, http.StatusAccepted)
+	})
+}
+
+// lifecycleSnapshot is the audited state of a version once its lifecycle has been changed
+func lifecycleSnapshot(module *modules.Module, lifecycle *modules.VersionLifecycle) *audit.Snapshot {
+	snapshot := audit.SnapshotOf(module)
+	snapshot.Lifecycle = lifecycle
+	return snapshot
+}
+
+// versionRef identifies a module version
+func versionRef(module *modules.Module) modules.ModuleVersionRef {
+	return modules.ModuleVersionRef{
+		Organization: module.Organization,
+		Name:         module.Name,
+		Provider:     module.Provider,
+		Version:      module.Version,
+	}
+}
+
+// emit notifies Events of an event when it is set
+func (a *AdminAPI) emit(event *events.Event) {
+	if a.Events != nil {
+		a.Events.Emit(event)
+	}
+}
+
+// findVersion looks up the module version named by the route variables of the request
+func (a *AdminAPI) findVersion(r *http.Request) (*modules.Module, error) {
+	params := mux.Vars(r)
+	return a.ModuleStore.ReadModuleVersion(r.Context(), params["organization_name"], params["name"], params["provider"], params["version"])
+}
+
+// writeStoreError writes the response matching an error returned from the module store
+func (a *AdminAPI) writeStoreError(rw http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, stores.ErrModuleVersionNotFound) || errors.Is(err, stores.ErrDeliveryNotFound) {
+		a.ErrorHandler.Write(rw, err, http.StatusNotFound)
+		return
+	}
+	logging.FromContext(r.Context(), a.Logger).WithError(err).Error("module store request failed")
+	a.ErrorHandler.Write(rw, errors.New("failed updating module store"), http.StatusInternalServerError)
+}
+
+// SetupRoutes registers the admin routes. Every route requires the admin permission on the organization it acts on,
+// the audit route checks it against the organization queried. Webhook endpoints receive events of every organization
+// so their delivery routes require the admin permission on all of them.
+func (a *AdminAPI) SetupRoutes() {
+	a.Router.StrictSlash(true)
+	a.Router.Handle("/audit", a.AuditHandler()).Methods(http.MethodGet).Name(endpoints.AdminAuditRoute)
+	a.Router.Handle("/webhooks/deliveries", a.requireGlobalAdmin(a.ListDeliveriesHandler())).Methods(http.MethodGet).Name(endpoints.AdminDeliveriesRoute)
+	a.Router.Handle("/webhooks/deliveries/{delivery_id}", a.requireGlobalAdmin(a.GetDeliveryHandler())).Methods(http.MethodGet).Name(endpoints.AdminDeliveryRoute)
+	a.Router.Handle("/webhooks/deliveries/{delivery_id}/redeliver", a.requireGlobalAdmin(a.RedeliverHandler())).Methods(http.MethodPost).Name(endpoints.AdminRedeliverRoute)
+	lifecyclePath := "/modules/{organization_name}/{name}/{provider}/{version}/lifecycle"
+	a.Router.Handle(lifecyclePath, a.requireAdmin(a.GetVersionLifecycleHandler())).Methods(http.MethodGet).Name(endpoints.AdminLifecycleRoute)
+	a.Router.Handle(lifecyclePath, a.requireAdmin(a.UpdateVersionLifecycleHandler())).Methods(http.MethodPut).Name(endpoints.AdminLifecycleUpdateRoute)
+	a.Router.Handle("/modules/{organization_name}/pending", a.requireAdmin(a.ListPendingHandler())).Methods(http.MethodGet).Name(endpoints.AdminPendingRoute)
+	a.Router.Handle("/modules/{organization_name}/problems", a.requireAdmin(a.ListProblemsHandler())).Methods(http.MethodGet).Name(endpoints.AdminProblemsRoute)
+	a.Router.Handle("/modules/{organization_name}/{name}/{provider}/{version}/approve", a.requireAdmin(a.ApproveHandler())).Methods(http.MethodPost).Name(endpoints.AdminApproveRoute)
+	a.Router.Handle("/modules/{organization_name}/{name}/{provider}/{version}/reject", a.requireAdmin(a.RejectHandler())).Methods(http.MethodPost).Name(endpoints.AdminRejectRoute)
+	a.Router.Handle("/modules/{organization_name}/{name}/{provider}/{version}", a.requireAdmin(a.DeleteHandler())).Methods(http.MethodDelete).Name(endpoints.AdminDeleteVersionRoute)
+	a.Router.Handle("/modules/{organization_name}/{name}/{provider}", a.requireAdmin(a.DeleteHandler())).Methods(http.MethodDelete).Name(endpoints.AdminDeleteModuleRoute)
+	a.Router.Handle("/modules/{organization_name}", a.requireAdmin(a.DeleteHandler())).Methods(http.MethodDelete).Name(endpoints.AdminDeleteOrganizationRoute)
+}
+
+func (a *AdminAPI) requireAdmin(next http.Handler) http.Handler {
+	return auth.RequirePermission(a.Authorizer, auth.PermissionAdmin, a.ErrorHandler, next)
+}
+
+func (a *AdminAPI) requireGlobalAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if err := a.Authorizer.Authorize(r.Context(), auth.AnyOrganization, auth.PermissionAdmin); err != nil {
+			auth.WriteAuthorizationError(rw, err, a.ErrorHandler)
+			return
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
@@ -5,16 +5,39 @@
 package api
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"io"
+	"net"
 	"net/http"
-	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/terrariumcloud/terrarium-lite/api/admin"
 	"github.com/terrariumcloud/terrarium-lite/api/discovery"
+	"github.com/terrariumcloud/terrarium-lite/api/health"
 	"github.com/terrariumcloud/terrarium-lite/api/modules"
+	"github.com/terrariumcloud/terrarium-lite/api/stream"
+	"github.com/terrariumcloud/terrarium-lite/internal/auditlog"
+	"github.com/terrariumcloud/terrarium-lite/internal/auth"
+	"github.com/terrariumcloud/terrarium-lite/internal/auth/mtls"
+	"github.com/terrariumcloud/terrarium-lite/internal/cache"
+	"github.com/terrariumcloud/terrarium-lite/internal/certs"
 	"github.com/terrariumcloud/terrarium-lite/internal/endpoints"
+	"github.com/terrariumcloud/terrarium-lite/internal/eventstream"
+	"github.com/terrariumcloud/terrarium-lite/internal/logging"
+	"github.com/terrariumcloud/terrarium-lite/internal/metrics"
+	"github.com/terrariumcloud/terrarium-lite/internal/policy"
+	"github.com/terrariumcloud/terrarium-lite/internal/ratelimit"
+	"github.com/terrariumcloud/terrarium-lite/internal/signing"
+	"github.com/terrariumcloud/terrarium-lite/internal/tracing"
+	"github.com/terrariumcloud/terrarium-lite/internal/webhook"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/events"
 	"github.com/terrariumcloud/terrarium-lite/pkg/registry/drivers"
 	"github.com/terrariumcloud/terrarium-lite/pkg/registry/responses"
 )
@@ -23,45 +46,284 @@ import (
 // The Terrarium struct is a complete implementation of the product fully instantiated. An instance
 // of this struct is created by the CLI when `terrarium serve modules` is called from the command line
 type Terrarium struct {
-	Port         int
-	CertFile     string
-	KeyFile      string
-	DataStore    drivers.TerrariumDatabaseDriver
-	FileStore    drivers.TerrariumStorageDriver
-	ModuleAPI    endpoints.ModuleAPIInterface
-	DiscoveryAPI endpoints.DiscoveryAPIInterface
-	Router       *mux.Router
-	Responder    responses.APIResponseWriter
-	Errorer      responses.APIErrorWriter
+	BindAddress     string
+	Port            int
+	DrainTimeout    time.Duration
+	ShutdownDelay   time.Duration
+	Plaintext       bool
+	TrustProxy      bool
+	AccessLog       bool
+	Certificates    *certs.Store
+	DataStore       drivers.TerrariumDatabaseDriver
+	FileStore       drivers.TerrariumStorageDriver
+	Authenticators  []auth.Authenticator
+	RoleBindings    *auth.RoleBindings
+	ClientVerifier  *mtls.ClientVerifier
+	ModuleAPI       endpoints.ModuleAPIInterface
+	AdminAPI        endpoints.AdminAPIInterface
+	DiscoveryAPI    endpoints.DiscoveryAPIInterface
+	HealthAPI       endpoints.HealthAPIInterface
+	Metrics         *metrics.Metrics
+	Tracing         *tracing.Tracing
+	TrustedKeys     *signing.TrustedKeys
+	RequireSigned   bool
+	Policies        *policy.Engine
+	Regulated       []string
+	Webhooks        *webhook.Dispatcher
+	Events          *eventstream.Stream
+	RateLimits      *ratelimit.Limiter
+	Cache           *cache.Config
+	StreamAPI       endpoints.StreamAPIInterface
+	Router          *mux.Router
+	Responder       responses.APIResponseWriter
+	Errorer         responses.APIErrorWriter
+	ProtocolErrorer responses.APIErrorWriter
+	Logger          logrus.FieldLogger
+	ready           atomicBool
 }
 
-// Serve starts the Terrarium Registry listening on the specified port. A web server will be listening ready to
-// serve API requests
-func (t *Terrarium) Serve() error {
-	bindAddress := fmt.Sprintf(":%d", t.Port)
+// Serve starts the Terrarium Registry listening on the specified address and port. A web server will be listening ready to
+// serve API requests. In plaintext mode TLS is expected to be terminated in front of Terrarium, for example by an ingress.
+// When the context is cancelled, typically on SIGTERM, the registry reports itself as not ready, waits ShutdownDelay for
+// load balancers to stop routing new requests to it and then drains in flight requests for up to DrainTimeout before
+// releasing its drivers.
+func (t *Terrarium) Serve(ctx context.Context) error {
+	bindAddress := net.JoinHostPort(t.BindAddress, strconv.Itoa(t.Port))
+	if err := t.DataStore.Connect(ctx); err != nil {
+		t.Close()
+		return fmt.Errorf("failed connecting to the database - %w", err)
+	}
 	t.Init()
-	log.Println(fmt.Sprintf("Listening on %s", bindAddress))
-	return http.ListenAndServeTLS(bindAddress, t.CertFile, t.KeyFile, handlers.CombinedLoggingHandler(os.Stdout, t.Router))
+	if t.Webhooks != nil {
+		t.Webhooks.Start()
+	}
+	server := &http.Server{
+		Addr:    bindAddress,
+		Handler: t.Handler(),
+	}
+	// Event streams never finish on their own, they are ended as soon as shutdown starts so they do not hold up draining
+	server.RegisterOnShutdown(t.Events.Close)
+	serveErr := make(chan error, 1)
+	go func() {
+		if t.Plaintext {
+			t.logger().WithField("address", bindAddress).Info("listening (plaintext)")
+			serveErr <- server.ListenAndServe()
+			return
+		}
+		server.TLSConfig = t.Certificates.TLSConfig()
+		if t.ClientVerifier != nil {
+			t.ClientVerifier.ConfigureTLS(server.TLSConfig)
+		}
+		t.logger().WithField("address", bindAddress).Info("listening")
+		serveErr <- server.ListenAndServeTLS("", "")
+	}()
+	t.ready.Store(true)
+
+	select {
+	case err := <-serveErr:
+		t.ready.Store(false)
+		t.Close()
+		return err
+	case <-ctx.Done():
+	}
+
+	t.ready.Store(false)
+	t.logger().WithField("drain_timeout", t.DrainTimeout.String()).Info("shutting down, draining connections")
+	time.Sleep(t.ShutdownDelay)
+	drainCtx, cancel := context.WithTimeout(context.Background(), t.DrainTimeout)
+	defer cancel()
+	err := server.Shutdown(drainCtx)
+	if err != nil {
+		t.logger().WithError(err).Error("failed draining connections")
+	}
+	t.Close()
+	return err
+}
+
+// Ready reports whether the registry is connected to its database, serving and not shutting down
+func (t *Terrarium) Ready() bool {
+	return t.ready.Load()
+}
+
+// Close stops delivering webhooks, ends event streams, releases the drivers, flushes pending trace spans and stops any background reloading
+// of certificates and revocation lists
+func (t *Terrarium) Close() {
+	// Webhook deliveries are recorded in the database so the dispatcher is stopped before the drivers are released
+	if t.Webhooks != nil {
+		if err := t.Webhooks.Close(); err != nil {
+			t.logger().WithError(err).Error("failed stopping webhook deliveries")
+		}
+	}
+	if t.Events != nil {
+		t.Events.Close()
+	}
+	closers := map[string]io.Closer{
+		"database driver": t.DataStore,
+		"storage driver":  t.FileStore,
+	}
+	if t.Certificates != nil {
+		closers["certificate store"] = t.Certificates
+	}
+	if t.ClientVerifier != nil {
+		closers["client certificate verifier"] = t.ClientVerifier
+	}
+	if t.Tracing != nil {
+		closers["tracing exporter"] = t.Tracing
+	}
+	for name, closer := range closers {
+		if err := closer.Close(); err != nil {
+			t.logger().WithError(err).Errorf("failed closing %s", name)
+		}
+	}
+}
+
+// Handler returns the root HTTP handler serving every Terrarium route. When running behind a trusted proxy the
+// X-Forwarded-* headers are applied to requests first so that logged client addresses and generated URLs reflect
+// what the client sees rather than the proxy. Request IDs are assigned outside the router so that requests matching
+// no route are logged with one too.
+func (t *Terrarium) Handler() http.Handler {
+	var handler http.Handler = t.Router
+	if t.AccessLog {
+		handler = logging.AccessLog(handler)
+	}
+	handler = logging.Middleware(t.logger())(handler)
+	if t.TrustProxy {
+		handler = handlers.ProxyHeaders(handler)
+	}
+	return handler
 }
 
 // Init calls the various API sub packages to set up routers for endpoints. This is a central function that wires all API routers together
 func (t *Terrarium) Init() {
-	t.ModuleAPI = modules.NewModuleAPI(t.Router, "/v1/modules", t.DataStore.Modules(), t.FileStore, t.Responder, t.Errorer)
+	moduleStore := t.DataStore.Modules()
+	if t.Tracing != nil {
+		t.Router.Use(t.Tracing.Middleware)
+		moduleStore = t.Tracing.TraceModuleStore(moduleStore)
+	}
+	if t.Metrics != nil {
+		t.Router.Use(t.Metrics.Middleware)
+		t.FileStore = t.Metrics.InstrumentStorage(t.FileStore)
+		t.Metrics.RegisterIndexSize(t.DataStore)
+		t.Router.Handle("/metrics", t.Metrics.Handler()).Methods(http.MethodGet)
+	}
+	if t.Tracing != nil {
+		t.FileStore = t.Tracing.TraceStorage(t.FileStore)
+	}
+	if t.Cache != nil {
+		// Caching outermost keeps cache hits out of the backend latency metrics and traces
+		moduleStore = cache.ModuleStore(moduleStore, t.Cache.VersionsTTL)
+		t.FileStore = cache.Storage(t.FileStore, t.Cache.ArchiveBytes)
+	}
+	recorder := &auditlog.Recorder{Store: t.DataStore.Audit(), Logger: t.logger()}
+	recorder.RecordRoleChanges(context.Background(), t.RoleBindings)
+	t.Router.Use(auth.Middleware(t.Authenticators))
+	if t.RateLimits != nil {
+		// Limiting after authentication lets authenticated clients be limited by identity rather than address, and
+		// before rejecting invalid credentials limits clients guessing them by address
+		t.Router.Use(t.RateLimits.Middleware(t.errorerFor))
+		if t.Metrics != nil {
+			t.Metrics.Register(t.RateLimits)
+		}
+	}
+	t.Router.Use(recorder.AuthFailures)
+	t.Router.Use(auth.RejectInvalidCredentials(t.errorerFor))
+	moduleAPI := modules.NewModuleAPI(t.Router, "/v1/modules", moduleStore, t.DataStore.Stats(), t.FileStore, t.authorizer(), t.Responder, t.protocolErrorer(), t.logger())
+	moduleAPI.TrustedKeys = t.TrustedKeys
+	moduleAPI.RequireSigned = t.RequireSigned
+	moduleAPI.Policies = t.Policies
+	moduleAPI.Regulated = t.Regulated
+	moduleAPI.Audit = recorder
+	t.Events = eventstream.New(t.DataStore.Events(), t.logger())
+	emitter := events.Emitters{t.Events}
+	if t.Webhooks != nil {
+		emitter = append(emitter, t.Webhooks)
+	}
+	moduleAPI.Events = emitter
+	t.ModuleAPI = moduleAPI
+	adminAPI := admin.NewAdminAPI(t.Router, "/v1/admin", moduleStore, t.FileStore, t.authorizer(), t.Responder, t.Errorer, t.logger())
+	adminAPI.Audit = recorder
+	adminAPI.AuditStore = t.DataStore.Audit()
+	adminAPI.Events = emitter
+	adminAPI.Webhooks = t.Webhooks
+	// Deletions wait for publishes of the same version and the other way round
+	adminAPI.VersionLocks = moduleAPI.VersionLocks
+	if reporter, ok := t.DataStore.(drivers.IndexReporter); ok {
+		adminAPI.IndexReporter = reporter
+	}
+	t.AdminAPI = adminAPI
+	t.StreamAPI = stream.NewStreamAPI(t.Router, "/v1/events", t.Events, t.authorizer(), t.Errorer, t.logger())
 	// TODO: Should this be it's own binary / sub command?
-	t.DiscoveryAPI = discovery.NewDiscoveryAPI("/v1/modules", t.Responder, t.Errorer)
+	t.DiscoveryAPI = discovery.NewDiscoveryAPI("/v1/modules", t.Responder, t.protocolErrorer())
 	t.Router.Handle("/.well-known/terraform.json", t.DiscoveryAPI.DiscoveryHandler())
+	t.HealthAPI = health.NewHealthAPI(t.Ready, t.DataStore, t.FileStore, t.Responder)
+	t.Router.Handle("/healthz", t.HealthAPI.HealthzHandler()).Methods(http.MethodGet)
+	t.Router.Handle("/readyz", t.HealthAPI.ReadyzHandler()).Methods(http.MethodGet)
+	t.Router.Handle("/version", t.HealthAPI.VersionHandler()).Methods(http.MethodGet)
+}
+
+// logger returns the logger of the registry, falling back to the default logger when none was set
+func (t *Terrarium) logger() logrus.FieldLogger {
+	if t.Logger == nil {
+		return logging.Default()
+	}
+	return t.Logger
+}
+
+// protocolErrorer returns the error writer of the Terraform registry protocol routes, which Terraform expects errors
+// from in its own format. It falls back to Errorer when none is set.
+func (t *Terrarium) protocolErrorer() responses.APIErrorWriter {
+	if t.ProtocolErrorer == nil {
+		return t.Errorer
+	}
+	return t.ProtocolErrorer
+}
+
+// errorerFor selects the error writer for a request in middleware shared by every router: the protocol error writer on
+// module routes and Errorer elsewhere
+func (t *Terrarium) errorerFor(r *http.Request) responses.APIErrorWriter {
+	if route := mux.CurrentRoute(r); route != nil && strings.HasPrefix(route.GetName(), endpoints.ModuleRoutePrefix) {
+		return t.protocolErrorer()
+	}
+	return t.Errorer
+}
+
+// authorizer returns the Authorizer guarding API routes. Without any authentication or role bindings configured the
+// registry is open to anonymous readers and cannot be changed, otherwise callers must hold a role on the organization
+// they access.
+func (t *Terrarium) authorizer() auth.Authorizer {
+	if len(t.Authenticators) == 0 && t.RoleBindings == nil {
+		return &auth.ReadOnly{}
+	}
+	return &auth.RoleAuthorizer{Bindings: t.RoleBindings}
 }
 
 // NewTerrarium creates a new Terrarium instance setting up the required API routes
-func NewTerrarium(port int, certFile string, keyFile string, driver drivers.TerrariumDatabaseDriver, storageDriver drivers.TerrariumStorageDriver, responder responses.APIResponseWriter, errorer responses.APIErrorWriter) *Terrarium {
+func NewTerrarium(bindAddress string, port int, certificates *certs.Store, driver drivers.TerrariumDatabaseDriver, storageDriver drivers.TerrariumStorageDriver, responder responses.APIResponseWriter, errorer responses.APIErrorWriter) *Terrarium {
 	return &Terrarium{
-		Port:      port,
-		CertFile:  certFile,
-		KeyFile:   keyFile,
-		DataStore: driver,
-		FileStore: storageDriver,
-		Router:    mux.NewRouter(),
-		Responder: responder,
-		Errorer:   errorer,
+		BindAddress:  bindAddress,
+		Port:         port,
+		Certificates: certificates,
+		DataStore:    driver,
+		FileStore:    storageDriver,
+		Router:       mux.NewRouter(),
+		Responder:    responder,
+		Errorer:      errorer,
+	}
+}
+
+// atomicBool is a boolean safe for concurrent use
+type atomicBool struct {
+	value int32
+}
+
+func (b *atomicBool) Store(value bool) {
+	var v int32
+	if value {
+		v = 1
 	}
+	atomic.StoreInt32(&b.value, v)
+}
+
+func (b *atomicBool) Load() bool {
+	return atomic.LoadInt32(&b.value) == 1
 }
@@ -0,0 +1,124 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/modules"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/drivers"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/responses"
+)
+
+// checkTimeout bounds how long readiness checks against drivers may take
+const checkTimeout = 5 * time.Second
+
+const statusOK string = "ok"
+
+// HealthAPI is a struct implementing the handlers for the HealthAPIInterface from the endpoints package in Terrarium
+type HealthAPI struct {
+	Ready           func() bool
+	DataStore       drivers.TerrariumDatabaseDriver
+	FileStore       drivers.TerrariumStorageDriver
+	ResponseHandler responses.APIResponseWriter
+}
+
+// HealthResponse reports the overall status of a probe and the outcome of each individual check
+type HealthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// VersionResponse reports build information of the running binary
+type VersionResponse struct {
+	Path      string `json:"path"`
+	Version   string `json:"version"`
+	Sum       string `json:"sum,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// HealthzHandler reports the process is alive. It performs no checks so that a slow or failing dependency does not
+// cause an orchestrator to restart an otherwise healthy process.
+func (h *HealthAPI) HealthzHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		h.ResponseHandler.WriteRaw(rw, &HealthResponse{Status: statusOK}, http.StatusOK)
+	})
+}
+
+// ReadyzHandler reports whether the registry should receive traffic. The registry must be serving and not shutting
+// down, and every driver implementing drivers.HealthChecker must pass its check. Returns a 503 otherwise. Archives
+// the database driver refuses to serve are counted, and reported as an error when they were tampered with, but do not
+// fail the check as every other version can still be served. The probe is unauthenticated so it never names the
+// archives, organization admins list them through the admin API.
+func (h *HealthAPI) ReadyzHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+		defer cancel()
+		resp := &HealthResponse{
+			Status: statusOK,
+			Checks: map[string]string{},
+		}
+		if h.Ready() {
+			resp.Checks["server"] = statusOK
+		} else {
+			resp.Status = "unavailable"
+			resp.Checks["server"] = "not serving"
+		}
+		for name, driver := range map[string]interface{}{"database": h.DataStore, "storage": h.FileStore} {
+			checker, ok := driver.(drivers.HealthChecker)
+			if !ok {
+				continue
+			}
+			if err := checker.HealthCheck(ctx); err != nil {
+				resp.Status = "unavailable"
+				resp.Checks[name] = err.Error()
+				continue
+			}
+			resp.Checks[name] = statusOK
+		}
+		if reporter, ok := h.DataStore.(drivers.IndexReporter); ok {
+			resp.Checks["index"] = indexStatus(reporter.IndexProblems())
+		}
+		statusCode := http.StatusOK
+		if resp.Status != statusOK {
+			statusCode = http.StatusServiceUnavailable
+		}
+		h.ResponseHandler.WriteRaw(rw, resp, statusCode)
+	})
+}
+
+// VersionHandler reports the module version the running binary was built from
+func (h *HealthAPI) VersionHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		resp := &VersionResponse{
+			Version:   "unknown",
+			GoVersion: runtime.Version(),
+		}
+		if info, ok := debug.ReadBuildInfo(); ok {
+			resp.Path = info.Main.Path
+			resp.Version = info.Main.Version
+			resp.Sum = info.Main.Sum
+		}
+		h.ResponseHandler.WriteRaw(rw, resp, http.StatusOK)
+	})
+}
+
+// indexStatus summarizes the archives not served, tampered archives first as they need attention
+func indexStatus(problems []*modules.IndexProblem) string {
+	tampered := 0
+	for _, problem := range problems {
+		if problem.Tampered {
+			tampered++
+		}
+	}
+	switch {
+	case tampered > 0:
+		return fmt.Sprintf("error: %d archives do not match their recorded checksum, %d archives not served", tampered, len(problems))
+	case len(problems) > 0:
+		return fmt.Sprintf("%d invalid archives not served", len(problems))
+	}
+	return statusOK
+}
@@ -0,0 +1,20 @@
+// Package health implements endpoints allowing load balancers and orchestrators to probe Terrarium without hitting
+// module routes. /healthz reports the process is alive, /readyz reports whether the registry and its drivers are able
+// to serve requests and /version reports build information.
+package health
+
+import (
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/drivers"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/responses"
+)
+
+// NewHealthAPI Creates a new instance of the health API. The ready function reports whether the registry itself is
+// serving, readiness additionally checks any driver implementing drivers.HealthChecker.
+func NewHealthAPI(ready func() bool, dataStore drivers.TerrariumDatabaseDriver, fileStore drivers.TerrariumStorageDriver, responseHandler responses.APIResponseWriter) *HealthAPI {
+	return &HealthAPI{
+		Ready:           ready,
+		DataStore:       dataStore,
+		FileStore:       fileStore,
+		ResponseHandler: responseHandler,
+	}
+}
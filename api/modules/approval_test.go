@@ -0,0 +1,37 @@
+package modules
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/modules"
+)
+
+func TestRequiresApproval(t *testing.T) {
+	tests := []struct {
+		name      string
+		regulated []string
+		module    string
+		want      bool
+	}{
+		{"every module of an organization", []string{"acme/*/*"}, "acme/vpc/aws", true},
+		{"single module", []string{"acme/vpc/aws"}, "acme/vpc/aws", true},
+		{"any provider", []string{"acme/vpc/*"}, "acme/vpc/google", true},
+		{"second pattern", []string{"globex/*/*", "acme/iam-*/*"}, "acme/iam-roles/aws", true},
+
+		{"other organization", []string{"acme/*/*"}, "globex/vpc/aws", false},
+		{"other module", []string{"acme/iam-*/*"}, "acme/vpc/aws", false},
+		{"no patterns", nil, "acme/vpc/aws", false},
+		{"pattern does not cross slashes", []string{"acme/*"}, "acme/vpc/aws", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address := strings.Split(tt.module, "/")
+			module := modules.Module{Organization: address[0], Name: address[1], Provider: address[2]}
+			api := &ModuleAPI{Regulated: tt.regulated}
+			if got := api.requiresApproval(&module); got != tt.want {
+				t.Fatalf("requiresApproval(%s) = %t, want %t", tt.module, got, tt.want)
+			}
+		})
+	}
+}
@@ -2,33 +2,122 @@ package modules
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
-	"log"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/terrariumcloud/terrarium-lite/internal/archive"
+	"github.com/terrariumcloud/terrarium-lite/internal/auditlog"
+	"github.com/terrariumcloud/terrarium-lite/internal/auth"
+	"github.com/terrariumcloud/terrarium-lite/internal/endpoints"
+	"github.com/terrariumcloud/terrarium-lite/internal/logging"
+	"github.com/terrariumcloud/terrarium-lite/internal/policy"
+	"github.com/terrariumcloud/terrarium-lite/internal/signing"
+	"github.com/terrariumcloud/terrarium-lite/internal/versionlock"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/audit"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/events"
 	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/modules"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/stats"
 	"github.com/terrariumcloud/terrarium-lite/pkg/registry/drivers"
 	"github.com/terrariumcloud/terrarium-lite/pkg/registry/responses"
 	"github.com/terrariumcloud/terrarium-lite/pkg/registry/stores"
 )
 
+// ChecksumHeader carries the hex encoded SHA-256 of a module archive on download, archive and publish responses
+const ChecksumHeader string = "X-Checksum-Sha256"
+
+// SignatureHeader carries the base64 encoded detached signature of an archive being published
+const SignatureHeader string = "X-Signature"
+
+// SignatureTypeHeader names the kind of key the signature in SignatureHeader was made with, ed25519 or pgp
+const SignatureTypeHeader string = "X-Signature-Type"
+
+// MaxArchiveSize is the largest module archive accepted for publishing
+const MaxArchiveSize int64 = archive.DefaultMaxSize
+
+var (
+	validName    = regexp.MustCompile(`^[0-9A-Za-z][0-9A-Za-z_-]{0,63}$`)
+	validVersion = regexp.MustCompile(`^(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+)
+
+// PublishedVersion is returned once a module version has been published
+type PublishedVersion struct {
+	modules.ModuleVersionRef
+	Checksum string               `json:"checksum"`
+	State    modules.VersionState `json:"state"`
+}
+
 // ModuleAPI is a struct implementing the handlers for the ModuleAPIInterface from the endpoints package in Terrarium
 type ModuleAPI struct {
 	Router          *mux.Router
 	ModuleStore     stores.ModuleStore
+	StatsStore      stores.StatsStore
 	FileStore       drivers.TerrariumStorageDriver
+	Authorizer      auth.Authorizer
 	ErrorHandler    responses.APIErrorWriter
 	ResponseHandler responses.APIResponseWriter
+	Logger          logrus.FieldLogger
+	// TrustedKeys verifies signatures of published archives. Signed publishes are rejected when it is nil.
+	TrustedKeys *signing.TrustedKeys
+	// RequireSigned refuses to publish or serve versions without a verified signature
+	RequireSigned bool
+	// Policies checks the contents of published modules against the rules of their organization
+	Policies *policy.Engine
+	// Regulated lists organization/name/provider patterns, as understood by path.Match, of modules whose new
+	// versions are pending until approved through the admin API
+	Regulated []string
+	// Audit records published versions to the audit trail
+	Audit *auditlog.Recorder
+	// Events is notified of published and first downloaded versions
+	Events events.Emitter
+	// VersionLocks serialises publishes of a version with each other and with changes made through the admin API
+	VersionLocks *versionlock.Locks
+	// clients hashes the addresses of anonymous downloaders
+	clients clientHasher
+}
+
+// KeysResponse lists the public keys trusted to sign archives of an organization
+type KeysResponse struct {
+	Keys []*signing.PublicKey `json:"keys"`
 }
 
 // DownloadModuleHandler will return a header indicating where the requesting CLI can download module content from
 // This handler complies with the following implementation from the module protocol
 // https://www.terraform.io/internals/module-registry-protocol#download-source-code-for-a-specific-module-version
+// The recorded checksum of the archive is returned alongside so that clients can verify what they download.
 func (m *ModuleAPI) DownloadModuleHandler() http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
-		rw.Header().Add("X-Terraform-Get", "./archive?archive=zip")
+		module, ok := m.readServableVersion(rw, r)
+		if !ok {
+			return
+		}
+		if module.Checksum != "" {
+			rw.Header().Set(ChecksumHeader, module.Checksum)
+		}
+		archiveURL := &url.URL{
+			Scheme:   requestScheme(r),
+			Host:     r.Host,
+			Path:     strings.TrimSuffix(r.URL.Path, "/download") + "/archive",
+			RawQuery: "archive=zip",
+		}
+		rw.Header().Add("X-Terraform-Get", archiveURL.String())
 		m.ResponseHandler.Write(rw, nil, http.StatusNoContent)
 	})
 }
@@ -44,24 +133,32 @@ func (m *ModuleAPI) GetModuleVersionHandler() http.Handler {
 		orgName := params["organization_name"]
 		moduleName := params["name"]
 		providerName := params["provider"]
-		moduleItems, err := m.ModuleStore.ReadModuleVersions(orgName, moduleName, providerName)
-		if err != nil {
-			m.ErrorHandler.Write(rw, err, http.StatusInternalServerError)
+		moduleItems, err := m.ModuleStore.ReadModuleVersions(r.Context(), orgName, moduleName, providerName)
+		switch {
+		case errors.Is(err, stores.ErrModuleNotFound):
+			m.ErrorHandler.Write(rw, err, http.StatusNotFound)
 			return
-		}
-		if moduleItems == nil {
-			m.ErrorHandler.Write(rw, errors.New("organization does not exist"), http.StatusNotFound)
-			return
-		}
-		if len(moduleItems) == 0 {
-			m.ErrorHandler.Write(rw, errors.New("module not found"), http.StatusNotFound)
+		case err != nil:
+			logging.FromContext(r.Context(), m.Logger).WithError(err).Error("failed reading module versions")
+			m.ErrorHandler.Write(rw, errors.New("failed reading module versions"), http.StatusInternalServerError)
 			return
 		}
-		var versions []*modules.ModuleVersionItem
+		versions := make([]*modules.ModuleVersionItem, 0, len(moduleItems))
 		for _, moduleItem := range moduleItems {
-			versions = append(versions, &modules.ModuleVersionItem{
+			item := &modules.ModuleVersionItem{
 				Version: moduleItem.Version,
-			})
+			}
+			if lifecycle := moduleItem.Lifecycle; lifecycle != nil {
+				switch lifecycle.State {
+				case modules.VersionYanked, modules.VersionPending, modules.VersionRejected:
+					// Yanked versions stay downloadable by exact version but must not be selected by constraints,
+					// versions awaiting or refused approval are not served at all
+					continue
+				case modules.VersionDeprecated:
+					item.Deprecation = deprecationNotice(lifecycle)
+				}
+			}
+			versions = append(versions, item)
 		}
 		vr := &modules.ModuleVersionResponse{
 			Modules: []*modules.ModuleVersions{
@@ -86,30 +183,549 @@ func (m *ModuleAPI) ArchiveHandler() http.Handler {
 		moduleName := params["name"]
 		providerName := params["provider"]
 		version := params["version"]
-		key, err := m.ModuleStore.ReadModuleVersionSource(orgName, moduleName, providerName, version)
-		if err != nil {
-			log.Printf("[FILE STORE] Error: %s", err.Error())
-			m.ErrorHandler.Write(rw, errors.New("failed finding module source"), http.StatusInternalServerError)
+		module, ok := m.readServableVersion(rw, r)
+		if !ok {
 			return
 		}
-		zipData, err := m.FileStore.FetchModuleSource(context.TODO(), key)
+		zipData, err := m.FileStore.FetchModuleSource(r.Context(), module.Source)
 		if err != nil {
-			log.Printf("[FILE STORE] Error: %s", err.Error())
+			logging.FromContext(r.Context(), m.Logger).WithError(err).WithField("key", module.Source).Error("failed fetching module source from file store")
 			m.ErrorHandler.Write(rw, errors.New("failed fetching module source from file store"), http.StatusInternalServerError)
 			return
 		}
-		r.Header.Set("Content-Type", "application/zip")
-		rw.Write(zipData)
+		// Versions are immutable, an archive changed behind the registry's back is refused rather than served
+		if module.Checksum != "" && checksum(zipData) != module.Checksum {
+			logging.FromContext(r.Context(), m.Logger).WithFields(logrus.Fields{"key": module.Source, "recorded": module.Checksum}).Error("module archive does not match its recorded checksum")
+			m.ErrorHandler.Write(rw, errors.New("module archive does not match its recorded checksum"), http.StatusInternalServerError)
+			return
+		}
+		if module.Checksum != "" {
+			rw.Header().Set(ChecksumHeader, module.Checksum)
+		}
+		rw.Header().Set("Content-Type", "application/zip")
+		if _, err := rw.Write(zipData); err != nil {
+			return
+		}
+		download := &stats.Download{
+			Organization: orgName,
+			Name:         moduleName,
+			Provider:     providerName,
+			Version:      version,
+			Timestamp:    time.Now().UTC(),
+			Client:       m.clientIdentity(r),
+		}
+		first, err := m.StatsStore.RecordDownload(r.Context(), download)
+		if err != nil {
+			logging.FromContext(r.Context(), m.Logger).WithError(err).Warn("failed recording download")
+		}
+		if first {
+			m.emit(events.ForVersion(events.VersionFirstDownload, module, ""))
+		}
+	})
+}
+
+// PublishHandler stores the zip archive in the request body as a new module version. The route requires the publish
+// permission on the organization, which authorizers never grant to anonymous callers, so a registry without
+// authentication configured is read only. Archives that are unsafe to extract, contain no Terraform files or violate
+// the policy of the organization are rejected with a 422. Published versions are immutable: publishing identical
+// content again succeeds without changes, publishing different content is rejected with a 409 unless force=true is
+// given by a caller holding the admin permission on the organization.
+func (m *ModuleAPI) PublishHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		module := &modules.Module{
+			Organization: params["organization_name"],
+			Name:         params["name"],
+			Provider:     params["provider"],
+			Version:      params["version"],
+		}
+		if err := validateModuleVersion(module); err != nil {
+			m.ErrorHandler.Write(rw, err, http.StatusBadRequest)
+			return
+		}
+		force := false
+		if value := r.URL.Query().Get("force"); value != "" {
+			var err error
+			if force, err = strconv.ParseBool(value); err != nil {
+				m.ErrorHandler.Write(rw, errors.New("force must be true or false"), http.StatusBadRequest)
+				return
+			}
+		}
+		if force {
+			if err := m.Authorizer.Authorize(r.Context(), module.Organization, auth.PermissionAdmin); err != nil {
+				auth.WriteAuthorizationError(rw, err, m.ErrorHandler)
+				return
+			}
+		}
+		data, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, MaxArchiveSize))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			m.ErrorHandler.Write(rw, fmt.Errorf("archive exceeds the maximum size of %d bytes", MaxArchiveSize), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			// The client went away or sent a malformed body
+			m.ErrorHandler.Write(rw, errors.New("failed reading the module archive from the request body"), http.StatusBadRequest)
+			return
+		}
+		if len(data) == 0 {
+			m.ErrorHandler.Write(rw, errors.New("request body must contain the module archive"), http.StatusBadRequest)
+			return
+		}
+		module.Validation = archive.Validate(data, archive.DefaultLimits)
+		if !module.Validation.Valid {
+			m.ErrorHandler.Write(rw, fmt.Errorf("invalid module archive - %s", module.Validation.Reason), http.StatusUnprocessableEntity)
+			return
+		}
+		if module.Validation.Format != string(archive.FormatZip) {
+			m.ErrorHandler.Write(rw, errors.New("module archives must be zip files"), http.StatusUnprocessableEntity)
+			return
+		}
+		if err := m.checkPolicy(module.Organization, data); err != nil {
+			m.ErrorHandler.Write(rw, err, http.StatusUnprocessableEntity)
+			return
+		}
+		module.Checksum = checksum(data)
+		module.Source = path.Join(module.Organization, module.Name, module.Provider, module.Version+".zip")
+		signature, err := m.verifySignature(r, module, data)
+		if err != nil {
+			m.ErrorHandler.Write(rw, err, http.StatusUnprocessableEntity)
+			return
+		}
+
+		// Serialise publishes of the version so that two uploads of it cannot both pass the immutability check
+		unlock, err := m.VersionLocks.Lock(r.Context(), module.Source)
+		if err != nil {
+			// The client went away while another publish of the version was in progress
+			return
+		}
+		defer unlock()
+		existing, err := m.ModuleStore.ReadModuleVersion(r.Context(), module.Organization, module.Name, module.Provider, module.Version)
+		rejected := false
+		switch {
+		case errors.Is(err, stores.ErrModuleVersionNotFound):
+		case err != nil:
+			logging.FromContext(r.Context(), m.Logger).WithError(err).Error("failed reading module version")
+			m.ErrorHandler.Write(rw, errors.New("failed reading module version"), http.StatusInternalServerError)
+			return
+		case existing.Lifecycle != nil && existing.Lifecycle.State == modules.VersionRejected:
+			// Rejected versions were never served so they may be replaced and go through approval again
+			rejected = true
+		case existing.Checksum == module.Checksum && (module.Signature == nil || existing.Signature != nil):
+			// Publishing the same content again is a no-op unless it adds a signature to an unsigned version
+			rw.Header().Set(ChecksumHeader, module.Checksum)
+			m.ResponseHandler.Write(rw, publishedItem(existing), http.StatusOK)
+			return
+		case existing.Checksum == module.Checksum:
+		case !force:
+			m.ErrorHandler.Write(rw, fmt.Errorf("version %s already exists with different content, versions are immutable", module.Version), http.StatusConflict)
+			return
+		default:
+			logging.FromContext(r.Context(), m.Logger).WithFields(logrus.Fields{"key": module.Source, "previous": existing.Checksum, "checksum": module.Checksum}).Warn("replacing published module version")
+		}
+		if existing == nil || existing.Checksum != module.Checksum || rejected {
+			// New content of regulated modules is quarantined, adding a signature to approved content is not
+			switch {
+			case m.requiresApproval(module):
+				module.Lifecycle = &modules.VersionLifecycle{
+					State:       modules.VersionPending,
+					RequestedBy: auth.Actor(r.Context()),
+					UpdatedBy:   auth.Actor(r.Context()),
+					UpdatedAt:   time.Now().UTC(),
+				}
+			case rejected:
+				module.Lifecycle = &modules.VersionLifecycle{State: modules.VersionActive, UpdatedBy: auth.Actor(r.Context()), UpdatedAt: time.Now().UTC()}
+			}
+		}
+		// What storage held for the version is kept so that it can be put back should the index not take the new
+		// content, which would otherwise be served against the checksum of the previous content
+		previous, err := m.backupSources(r.Context(), module, existing)
+		if err != nil {
+			logging.FromContext(r.Context(), m.Logger).WithError(err).WithField("key", module.Source).Error("failed reading module source")
+			m.ErrorHandler.Write(rw, errors.New("failed reading module source from file store"), http.StatusInternalServerError)
+			return
+		}
+		if err := m.FileStore.StoreModuleSource(r.Context(), module.Source, data); err != nil {
+			logging.FromContext(r.Context(), m.Logger).WithError(err).WithField("key", module.Source).Error("failed storing module source")
+			m.restoreSources(r, previous)
+			m.ErrorHandler.Write(rw, errors.New("failed storing module source in file store"), http.StatusInternalServerError)
+			return
+		}
+		if module.Signature != nil {
+			if err := m.FileStore.StoreModuleSource(r.Context(), module.Signature.SignatureKey, signature); err != nil {
+				logging.FromContext(r.Context(), m.Logger).WithError(err).WithField("key", module.Signature.SignatureKey).Error("failed storing module signature")
+				m.restoreSources(r, previous)
+				m.ErrorHandler.Write(rw, errors.New("failed storing module signature in file store"), http.StatusInternalServerError)
+				return
+			}
+		}
+		if err := m.ModuleStore.PublishModuleVersion(r.Context(), module); err != nil {
+			logging.FromContext(r.Context(), m.Logger).WithError(err).Error("failed publishing module version")
+			m.restoreSources(r, previous)
+			m.ErrorHandler.Write(rw, errors.New("failed publishing module version"), http.StatusInternalServerError)
+			return
+		}
+		if module.Signature == nil && existing != nil && existing.Signature != nil {
+			// The signature of replaced content no longer applies
+			if err := m.FileStore.DeleteModuleSource(r.Context(), existing.Signature.SignatureKey); err != nil {
+				logging.FromContext(r.Context(), m.Logger).WithError(err).WithField("key", existing.Signature.SignatureKey).Warn("failed deleting stale module signature")
+			}
+		}
+		item := publishedItem(module)
+		after := audit.SnapshotOf(module)
+		if module.Lifecycle == nil && existing != nil && existing.Lifecycle != nil {
+			// The version kept its lifecycle, such as a pending version having a signature added
+			item.State = existing.Lifecycle.State
+			after.Lifecycle = existing.Lifecycle
+		}
+		action := audit.ActionPublish
+		if existing != nil && existing.Checksum != module.Checksum && !rejected {
+			action = audit.ActionOverride
+		}
+		m.Audit.Record(r, action, item.ModuleVersionRef, audit.SnapshotOf(existing), after)
+		if (existing == nil || existing.Checksum != module.Checksum || rejected) && item.State != modules.VersionPending {
+			// Versions pending approval are announced once approved
+			m.emit(events.ForVersion(events.VersionPublished, module, auth.Actor(r.Context())))
+		}
+		rw.Header().Set(ChecksumHeader, module.Checksum)
+		m.ResponseHandler.Write(rw, item, http.StatusCreated)
+	})
+}
+
+// backupSources reads what storage holds under the keys a publish is about to write. Keys the version did not use
+// before map to nil, they are removed on restore. An archive republished with identical content is not read.
+func (m *ModuleAPI) backupSources(ctx context.Context, module *modules.Module, existing *modules.Module) (map[string][]byte, error) {
+	backup := map[string][]byte{}
+	if existing == nil || existing.Checksum != module.Checksum {
+		backup[module.Source] = nil
+	}
+	if module.Signature != nil {
+		backup[module.Signature.SignatureKey] = nil
+	}
+	if existing == nil {
+		return backup, nil
+	}
+	for key := range backup {
+		if key != existing.Source && (existing.Signature == nil || key != existing.Signature.SignatureKey) {
+			continue
+		}
+		data, err := m.FileStore.FetchModuleSource(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		backup[key] = data
+	}
+	return backup, nil
+}
+
+// restoreSources puts back what storage held before a failed publish. Restoring continues when the client has gone
+// away, failures are logged as the error that failed the publish is the one reported.
+func (m *ModuleAPI) restoreSources(r *http.Request, backup map[string][]byte) {
+	for key, data := range backup {
+		var err error
+		if data == nil {
+			err = m.FileStore.DeleteModuleSource(context.Background(), key)
+		} else {
+			err = m.FileStore.StoreModuleSource(context.Background(), key, data)
+		}
+		if err != nil {
+			logging.FromContext(r.Context(), m.Logger).WithError(err).WithField("key", key).Error("failed restoring module source after a failed publish")
+		}
+	}
+}
+
+// SignatureHandler returns the detached signature of a version archive so that clients can verify its provenance
+// against the organization's trusted keys
+func (m *ModuleAPI) SignatureHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		module, ok := m.readModuleVersion(rw, r)
+		if !ok {
+			return
+		}
+		if module.Signature == nil {
+			m.ErrorHandler.Write(rw, errors.New("module version is not signed"), http.StatusNotFound)
+			return
+		}
+		signature, err := m.FileStore.FetchModuleSource(r.Context(), module.Signature.SignatureKey)
+		if err != nil {
+			logging.FromContext(r.Context(), m.Logger).WithError(err).WithField("key", module.Signature.SignatureKey).Error("failed fetching module signature from file store")
+			m.ErrorHandler.Write(rw, errors.New("failed fetching module signature from file store"), http.StatusInternalServerError)
+			return
+		}
+		m.ResponseHandler.WriteRaw(rw, &modules.SignatureResponse{
+			Type:      module.Signature.Type,
+			KeyID:     module.Signature.KeyID,
+			Signature: signature,
+			Checksum:  module.Checksum,
+		}, http.StatusOK)
+	})
+}
+
+// KeysHandler lists the public keys trusted to sign archives of an organization
+func (m *ModuleAPI) KeysHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		keys := m.TrustedKeys.Keys(mux.Vars(r)["organization_name"])
+		if keys == nil {
+			keys = []*signing.PublicKey{}
+		}
+		m.ResponseHandler.WriteRaw(rw, &KeysResponse{Keys: keys}, http.StatusOK)
 	})
 }
 
+// StatsHandler reports how often each version of a module has been downloaded per day. It is used to find versions
+// still in use before they are retired.
+func (m *ModuleAPI) StatsHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		counts, err := m.StatsStore.ReadDownloadCounts(r.Context(), params["organization_name"], params["name"], params["provider"])
+		if err != nil {
+			logging.FromContext(r.Context(), m.Logger).WithError(err).Error("failed reading download statistics")
+			m.ErrorHandler.Write(rw, errors.New("failed reading download statistics"), http.StatusInternalServerError)
+			return
+		}
+		resp := &stats.ModuleStatsResponse{
+			Organization: params["organization_name"],
+			Name:         params["name"],
+			Provider:     params["provider"],
+			Versions:     []*stats.VersionStatsItem{},
+		}
+		var current *stats.VersionStatsItem
+		for _, count := range counts {
+			if current == nil || current.Version != count.Version {
+				current = &stats.VersionStatsItem{Version: count.Version}
+				resp.Versions = append(resp.Versions, current)
+			}
+			current.Days = append(current.Days, &stats.DayItem{Date: count.Date, Downloads: count.Downloads})
+			current.Downloads += count.Downloads
+			resp.Downloads += count.Downloads
+		}
+		m.ResponseHandler.WriteRaw(rw, resp, http.StatusOK)
+	})
+}
+
+// clientIdentity identifies the downloader of a module. Authenticated callers are identified by their subject,
+// anonymous callers by a keyed hash of their address so that distinct clients can be counted without storing addresses.
+func (m *ModuleAPI) clientIdentity(r *http.Request) string {
+	if identity := auth.IdentityFromContext(r.Context()); identity != nil {
+		return fmt.Sprintf("%s:%s", identity.Type, identity.Subject)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + m.clients.hash(host, time.Now())
+}
+
+// clientHasher hashes client addresses with an HMAC key drawn at random for each UTC day and never stored. Hashes
+// of the same address match within a day, while the recorded hashes cannot be reversed by enumerating addresses once
+// the key of their day is gone.
+type clientHasher struct {
+	mu  sync.Mutex
+	day string
+	key []byte
+}
+
+func (c *clientHasher) hash(address string, now time.Time) string {
+	day := now.UTC().Format("2006-01-02")
+	c.mu.Lock()
+	if c.day != day {
+		c.key = make([]byte, 32)
+		if _, err := rand.Read(c.key); err != nil {
+			// Without randomness no key can be kept secret, so no client is recorded
+			c.mu.Unlock()
+			return "unknown"
+		}
+		c.day = day
+	}
+	mac := hmac.New(sha256.New, c.key)
+	c.mu.Unlock()
+	mac.Write([]byte(address))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// readModuleVersion looks up the version named by the route variables, writing the error response when it cannot
+func (m *ModuleAPI) readModuleVersion(rw http.ResponseWriter, r *http.Request) (*modules.Module, bool) {
+	params := mux.Vars(r)
+	module, err := m.ModuleStore.ReadModuleVersion(r.Context(), params["organization_name"], params["name"], params["provider"], params["version"])
+	if errors.Is(err, stores.ErrModuleVersionNotFound) {
+		m.ErrorHandler.Write(rw, err, http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		logging.FromContext(r.Context(), m.Logger).WithError(err).Error("failed finding module source")
+		m.ErrorHandler.Write(rw, errors.New("failed finding module source"), http.StatusInternalServerError)
+		return nil, false
+	}
+	return module, true
+}
+
+// readServableVersion is readModuleVersion for routes serving archives, which refuse versions that are not approved
+// and unsigned versions when signatures are required
+func (m *ModuleAPI) readServableVersion(rw http.ResponseWriter, r *http.Request) (*modules.Module, bool) {
+	module, ok := m.readModuleVersion(rw, r)
+	if !ok {
+		return nil, false
+	}
+	if module.Lifecycle != nil {
+		switch module.Lifecycle.State {
+		case modules.VersionPending:
+			m.ErrorHandler.Write(rw, errors.New("module version is pending approval"), http.StatusForbidden)
+			return nil, false
+		case modules.VersionRejected:
+			m.ErrorHandler.Write(rw, errors.New("module version was rejected"), http.StatusForbidden)
+			return nil, false
+		}
+	}
+	if m.RequireSigned && module.Signature == nil {
+		m.ErrorHandler.Write(rw, errors.New("module version is not signed"), http.StatusForbidden)
+		return nil, false
+	}
+	return module, true
+}
+
+// verifySignature checks the signature sent with a published archive against the keys trusted for its organization
+// and sets the signature details on the module. It returns the signature to store alongside the archive.
+func (m *ModuleAPI) verifySignature(r *http.Request, module *modules.Module, data []byte) ([]byte, error) {
+	encoded := r.Header.Get(SignatureHeader)
+	if encoded == "" {
+		if m.RequireSigned {
+			return nil, errors.New("the registry only accepts signed module versions")
+		}
+		return nil, nil
+	}
+	keyType, err := signing.ParseKeyType(r.Header.Get(SignatureTypeHeader))
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be base64 encoded", SignatureHeader)
+	}
+	keyID, err := m.TrustedKeys.Verify(module.Organization, keyType, data, signature)
+	if err != nil {
+		return nil, err
+	}
+	module.Signature = &modules.ModuleSignature{
+		Type:         string(keyType),
+		KeyID:        keyID,
+		SignatureKey: module.Source + ".sig",
+		SignedAt:     time.Now().UTC(),
+	}
+	return signature, nil
+}
+
+// checkPolicy evaluates the policy of the organization, if it has one, against the module in a published archive.
+// Violations are returned as a policy.ViolationError so that clients receive each of them.
+func (m *ModuleAPI) checkPolicy(orgName string, data []byte) error {
+	rules := m.Policies.Policy(orgName)
+	if rules == nil {
+		return nil
+	}
+	module, err := policy.LoadZip(data)
+	if err != nil {
+		return err
+	}
+	if violations := rules.Evaluate(module); len(violations) > 0 {
+		return &policy.ViolationError{Violations: violations}
+	}
+	return nil
+}
+
+// validateModuleVersion restricts names and versions of published modules as they become part of storage keys
+func validateModuleVersion(module *modules.Module) error {
+	for field, value := range map[string]string{"organization": module.Organization, "name": module.Name, "provider": module.Provider} {
+		if !validName.MatchString(value) {
+			return fmt.Errorf("%s %q may only contain letters, digits, dashes and underscores", field, value)
+		}
+	}
+	if !validVersion.MatchString(module.Version) {
+		return fmt.Errorf("version %q is not a semantic version", module.Version)
+	}
+	return nil
+}
+
+// requiresApproval reports whether new versions of the module must be approved before they are served
+func (m *ModuleAPI) requiresApproval(module *modules.Module) bool {
+	address := path.Join(module.Organization, module.Name, module.Provider)
+	for _, pattern := range m.Regulated {
+		if matched, _ := path.Match(pattern, address); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// emit notifies Events of an event when it is set
+func (m *ModuleAPI) emit(event *events.Event) {
+	if m.Events != nil {
+		m.Events.Emit(event)
+	}
+}
+
+func publishedItem(module *modules.Module) *PublishedVersion {
+	state := modules.VersionActive
+	if module.Lifecycle != nil {
+		state = module.Lifecycle.State
+	}
+	return &PublishedVersion{
+		ModuleVersionRef: modules.ModuleVersionRef{
+			Organization: module.Organization,
+			Name:         module.Name,
+			Provider:     module.Provider,
+			Version:      module.Version,
+		},
+		Checksum: module.Checksum,
+		State:    state,
+	}
+}
+
+// checksum returns the hex encoded SHA-256 of an archive
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// deprecationNotice builds the protocol deprecation notice of a version, folding any suggested replacement into the
+// reason as the protocol has no field for it
+func deprecationNotice(lifecycle *modules.VersionLifecycle) *modules.ModuleDeprecation {
+	reason := lifecycle.Reason
+	if reason == "" {
+		reason = "This version is deprecated"
+	}
+	if lifecycle.Replacement != "" {
+		reason = fmt.Sprintf("%s. Use %s instead", strings.TrimSuffix(reason, "."), lifecycle.Replacement)
+	}
+	return &modules.ModuleDeprecation{Reason: reason, Link: lifecycle.Link}
+}
+
+// requestScheme returns the scheme the client used to reach the registry. The scheme will already have been set
+// on the request URL from X-Forwarded-Proto when running behind a trusted proxy.
+func requestScheme(r *http.Request) string {
+	if r.URL.Scheme != "" {
+		return r.URL.Scheme
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
 // SetupRoutes Sets up the various endpoints for the modules API by registering handlers from this struct to it's
 // corresponding routes. This will register the routes required by the module registry protocol as defined here
 // https://www.terraform.io/internals/module-registry-protocol Additional routes not part of the specification will also be registered.
 // These are used to provide additional functionality for a more complete registry experience
 func (m *ModuleAPI) SetupRoutes() {
 	m.Router.StrictSlash(true)
-	m.Router.Handle("/{organization_name}/{name}/{provider}/versions", m.GetModuleVersionHandler()).Methods(http.MethodGet)
-	m.Router.Handle("/{organization_name}/{name}/{provider}/{version}/download", m.DownloadModuleHandler()).Methods(http.MethodGet)
-	m.Router.Handle("/{organization_name}/{name}/{provider}/{version}/archive", m.ArchiveHandler()).Methods(http.MethodGet)
+	m.Router.Handle("/{organization_name}/{name}/{provider}/versions", m.requirePermission(auth.PermissionRead, m.GetModuleVersionHandler())).Methods(http.MethodGet).Name(endpoints.ModuleVersionsRoute)
+	m.Router.Handle("/{organization_name}/{name}/{provider}/{version}/download", m.requirePermission(auth.PermissionRead, m.DownloadModuleHandler())).Methods(http.MethodGet).Name(endpoints.ModuleDownloadRoute)
+	m.Router.Handle("/{organization_name}/{name}/{provider}/{version}/archive", m.requirePermission(auth.PermissionRead, m.ArchiveHandler())).Methods(http.MethodGet).Name(endpoints.ModuleArchiveRoute)
+	m.Router.Handle("/{organization_name}/{name}/{provider}/{version}", m.requirePermission(auth.PermissionPublish, m.PublishHandler())).Methods(http.MethodPut).Name(endpoints.ModulePublishRoute)
+	m.Router.Handle("/{organization_name}/{name}/{provider}/{version}/signature", m.requirePermission(auth.PermissionRead, m.SignatureHandler())).Methods(http.MethodGet).Name(endpoints.ModuleSignatureRoute)
+	m.Router.Handle("/{organization_name}/keys", m.requirePermission(auth.PermissionRead, m.KeysHandler())).Methods(http.MethodGet).Name(endpoints.ModuleKeysRoute)
+	m.Router.Handle("/{organization_name}/{name}/{provider}/stats", m.requirePermission(auth.PermissionRead, m.StatsHandler())).Methods(http.MethodGet).Name(endpoints.ModuleStatsRoute)
+}
+
+// requirePermission guards a handler so it is only reachable by callers holding the permission on the requested organization
+func (m *ModuleAPI) requirePermission(permission auth.Permission, next http.Handler) http.Handler {
+	return auth.RequirePermission(m.Authorizer, permission, m.ErrorHandler, next)
 }
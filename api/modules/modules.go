@@ -4,19 +4,26 @@ package modules
 
 import (
 	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/terrariumcloud/terrarium-lite/internal/auth"
+	"github.com/terrariumcloud/terrarium-lite/internal/versionlock"
 	"github.com/terrariumcloud/terrarium-lite/pkg/registry/drivers"
 	"github.com/terrariumcloud/terrarium-lite/pkg/registry/responses"
 	"github.com/terrariumcloud/terrarium-lite/pkg/registry/stores"
 )
 
 // NewModuleAPI Creates a new instance of the module API setting up routes as well as any backend storage and responses.
-func NewModuleAPI(router *mux.Router, path string, store stores.ModuleStore, fileStore drivers.TerrariumStorageDriver, responseHandler responses.APIResponseWriter, errorHandler responses.APIErrorWriter) *ModuleAPI {
+func NewModuleAPI(router *mux.Router, path string, store stores.ModuleStore, statsStore stores.StatsStore, fileStore drivers.TerrariumStorageDriver, authorizer auth.Authorizer, responseHandler responses.APIResponseWriter, errorHandler responses.APIErrorWriter, logger logrus.FieldLogger) *ModuleAPI {
 	m := &ModuleAPI{
 		Router:          router.PathPrefix(path).Subrouter(),
 		ModuleStore:     store,
+		StatsStore:      statsStore,
 		FileStore:       fileStore,
+		Authorizer:      authorizer,
 		ErrorHandler:    errorHandler,
 		ResponseHandler: responseHandler,
+		Logger:          logger,
+		VersionLocks:    &versionlock.Locks{},
 	}
 	m.SetupRoutes()
 	return m
@@ -0,0 +1,156 @@
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/terrariumcloud/terrarium-lite/internal/auth"
+	"github.com/terrariumcloud/terrarium-lite/internal/eventstream"
+	"github.com/terrariumcloud/terrarium-lite/internal/logging"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/events"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/responses"
+)
+
+// LastEventIDHeader carries the ID of the last event a reconnecting client received
+const LastEventIDHeader string = "Last-Event-ID"
+
+// ResetEvent is sent to a resuming client when events following its last event ID are no longer logged. The client
+// should refresh whatever it derives from the events, for example by listing versions again, before relying on them.
+const ResetEvent string = "reset"
+
+// heartbeatInterval is how often a comment is sent on an idle stream so that proxies do not close it
+const heartbeatInterval = 30 * time.Second
+
+// StreamAPI is a struct implementing the handlers for the StreamAPIInterface from the endpoints package in Terrarium
+type StreamAPI struct {
+	Stream       *eventstream.Stream
+	Authorizer   auth.Authorizer
+	ErrorHandler responses.APIErrorWriter
+	Logger       logrus.FieldLogger
+}
+
+// ResetData is the payload of a reset event
+type ResetData struct {
+	Reason string `json:"reason"`
+}
+
+// EventsHandler streams registry events as server-sent events named after their type, with the event as JSON data.
+// Events are limited to the organizations given by the organization query parameter, which may be repeated, and
+// require the read permission on each of them. Without it events of every organization are streamed, which requires
+// the read permission on all of them. A Last-Event-ID header, or a last_event_id query parameter for clients unable to
+// set headers, first replays the events logged since.
+func (s *StreamAPI) EventsHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		flusher, ok := rw.(http.Flusher)
+		if !ok {
+			s.ErrorHandler.Write(rw, errors.New("streaming is not supported"), http.StatusInternalServerError)
+			return
+		}
+		organizations := r.URL.Query()["organization"]
+		if len(organizations) == 0 {
+			organizations = []string{auth.AnyOrganization}
+		}
+		for _, organization := range organizations {
+			if err := s.Authorizer.Authorize(r.Context(), organization, auth.PermissionRead); err != nil {
+				auth.WriteAuthorizationError(rw, err, s.ErrorHandler)
+				return
+			}
+		}
+		lastEventID := r.Header.Get(LastEventIDHeader)
+		if lastEventID == "" {
+			lastEventID = r.URL.Query().Get("last_event_id")
+		}
+		var last uint64
+		if lastEventID != "" {
+			var err error
+			if last, err = strconv.ParseUint(lastEventID, 10, 64); err != nil {
+				s.ErrorHandler.Write(rw, fmt.Errorf("invalid last event ID %q", lastEventID), http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Subscribing before reading the log ensures no event falls between the two
+		subscription := s.Stream.Subscribe()
+		defer s.Stream.Unsubscribe(subscription)
+		var replay []*events.Logged
+		complete := true
+		if lastEventID != "" {
+			var err error
+			if replay, complete, err = s.Stream.ReadAfter(r.Context(), last); err != nil {
+				logging.FromContext(r.Context(), s.Logger).WithError(err).Error("failed reading event log")
+				s.ErrorHandler.Write(rw, errors.New("failed reading event log"), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		rw.Header().Set("Content-Type", "text/event-stream")
+		rw.Header().Set("Cache-Control", "no-cache")
+		// Keeps reverse proxies such as nginx from buffering the stream
+		rw.Header().Set("X-Accel-Buffering", "no")
+		rw.WriteHeader(http.StatusOK)
+		if !complete {
+			writeEvent(rw, "", ResetEvent, &ResetData{Reason: "events following the last event ID are no longer available"})
+			// The last event ID may be one the log never handed out, events are followed from the replay onwards
+			last = 0
+		}
+		for _, logged := range replay {
+			if matches(organizations, logged.Event) {
+				writeEvent(rw, strconv.FormatUint(logged.Sequence, 10), string(logged.Event.Type), logged.Event)
+			}
+			last = logged.Sequence
+		}
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-heartbeat.C:
+				fmt.Fprint(rw, ": heartbeat\n\n")
+			case logged, ok := <-subscription.Events:
+				if !ok {
+					// The stream is closing or the client fell behind, it resumes from the last event it received
+					return
+				}
+				if logged.Sequence <= last {
+					continue
+				}
+				last = logged.Sequence
+				if !matches(organizations, logged.Event) {
+					continue
+				}
+				writeEvent(rw, strconv.FormatUint(logged.Sequence, 10), string(logged.Event.Type), logged.Event)
+			}
+			flusher.Flush()
+		}
+	})
+}
+
+// matches reports whether an event belongs to one of the organizations streamed
+func matches(organizations []string, event *events.Event) bool {
+	for _, organization := range organizations {
+		if organization == auth.AnyOrganization || organization == event.Organization {
+			return true
+		}
+	}
+	return false
+}
+
+// writeEvent writes a server-sent event. The JSON encoding of data holds no newlines so it fits a single data field.
+func writeEvent(rw http.ResponseWriter, id string, name string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	if id != "" {
+		fmt.Fprintf(rw, "id: %s\n", id)
+	}
+	fmt.Fprintf(rw, "event: %s\ndata: %s\n\n", name, payload)
+}
@@ -0,0 +1,28 @@
+// Package stream implements the registry event stream, a server-sent events endpoint pushing changes to module
+// versions to clients such as dashboards and caching proxies as they happen so that they do not have to poll the
+// versions endpoints. The events are those delivered to webhooks. Clients resume after a disconnect by presenting
+// the ID of the last event they received in the Last-Event-ID header, as browsers do automatically.
+package stream
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/terrariumcloud/terrarium-lite/internal/auth"
+	"github.com/terrariumcloud/terrarium-lite/internal/endpoints"
+	"github.com/terrariumcloud/terrarium-lite/internal/eventstream"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/responses"
+)
+
+// NewStreamAPI Creates a new instance of the stream API serving the events of stream on the given path
+func NewStreamAPI(router *mux.Router, path string, stream *eventstream.Stream, authorizer auth.Authorizer, errorHandler responses.APIErrorWriter, logger logrus.FieldLogger) *StreamAPI {
+	s := &StreamAPI{
+		Stream:       stream,
+		Authorizer:   authorizer,
+		ErrorHandler: errorHandler,
+		Logger:       logger,
+	}
+	router.Handle(path, s.EventsHandler()).Methods(http.MethodGet).Name(endpoints.EventsRoute)
+	return s
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/terrariumcloud/terrarium-lite/api/admin"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/modules"
+)
+
+// approveCmd makes a module version pending approval available
+var approveCmd = &cobra.Command{
+	Use:   "approve <organization>/<name>/<provider> <version>",
+	Short: "Approves a module version pending approval",
+	Long: `Approves a module version of a regulated module on a running registry so that it is listed and downloadable. The
+approver must be a different identity than the publisher of the version. Requires the admin role on the organization.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		decideVersion(cmd, args, "approve", nil)
+	},
+}
+
+// rejectCmd refuses a module version pending approval
+var rejectCmd = &cobra.Command{
+	Use:   "reject <organization>/<name>/<provider> <version>",
+	Short: "Rejects a module version pending approval",
+	Long: `Rejects a module version of a regulated module on a running registry, recording the reason. The version is never
+served but may be published again for another review. Requires the admin role on the organization and a different
+identity than the publisher of the version.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		reason, _ := cmd.Flags().GetString("reason")
+		decideVersion(cmd, args, "reject", &admin.RejectionRequest{Reason: reason})
+	},
+}
+
+// pendingCmd lists the module versions of an organization awaiting approval
+var pendingCmd = &cobra.Command{
+	Use:   "pending <organization>",
+	Short: "Lists module versions pending approval",
+	Long:  `Lists the module versions of an organization awaiting approval on a running registry. Requires the admin role on the organization.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var pending []*admin.PendingVersion
+		cobra.CheckErr(newRegistryClient(cmd).do(http.MethodGet, fmt.Sprintf("/v1/admin/modules/%s/pending", url.PathEscape(args[0])), nil, &pending))
+		if len(pending) == 0 {
+			fmt.Printf("No versions of %s are pending approval\n", args[0])
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "MODULE\tVERSION\tPUBLISHED BY\tPUBLISHED AT")
+		for _, version := range pending {
+			fmt.Fprintf(w, "%s/%s/%s\t%s\t%s\t%s\n", version.Organization, version.Name, version.Provider, version.Version,
+				version.RequestedBy, version.RequestedAt.Format(time.RFC3339))
+		}
+		w.Flush()
+	},
+}
+
+func decideVersion(cmd *cobra.Command, args []string, decision string, req interface{}) {
+	orgName, moduleName, providerName, err := parseModuleAddress(args[0])
+	cobra.CheckErr(err)
+	path := fmt.Sprintf("/v1/admin/modules/%s/%s/%s/%s/%s",
+		url.PathEscape(orgName), url.PathEscape(moduleName), url.PathEscape(providerName), url.PathEscape(args[1]), decision)
+	lifecycle := &modules.VersionLifecycle{}
+	cobra.CheckErr(newRegistryClient(cmd).do(http.MethodPost, path, req, lifecycle))
+	fmt.Printf("%s %s is now %s\n", args[0], args[1], lifecycle.State)
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{approveCmd, rejectCmd, pendingCmd} {
+		addRegistryFlags(cmd)
+		rootCmd.AddCommand(cmd)
+	}
+	rejectCmd.Flags().String("reason", "", "Why the version is rejected, recorded with the rejection")
+	cobra.CheckErr(rejectCmd.MarkFlagRequired("reason"))
+}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/terrariumcloud/terrarium-lite/api/admin"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/audit"
+)
+
+// auditCmd queries and exports the audit trail of a running registry
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Queries the audit trail of a registry",
+	Long: `Lists the changes made to a running registry: publishes, admin overrides of published content, deprecations,
+approvals and deletions, with who made them, from where and the state of the version before and after. Requests
+presenting invalid credentials and changes to the role bindings of organizations, recorded when the registry starts
+with changed bindings, are listed too. Use --format
+jsonl or csv with --output to export the trail. Requires the admin role on the organization queried, or on every
+organization when --organization is not given.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		query := url.Values{}
+		for flag, param := range map[string]string{"organization": "organization", "module": "module", "actor": "actor", "action": "action", "since": "since", "until": "until"} {
+			if value, _ := cmd.Flags().GetString(flag); value != "" {
+				query.Set(param, value)
+			}
+		}
+		if limit, _ := cmd.Flags().GetInt("limit"); limit > 0 {
+			query.Set("limit", strconv.Itoa(limit))
+		}
+		format, _ := cmd.Flags().GetString("format")
+		if format != "table" && format != "json" && format != "jsonl" && format != "csv" {
+			cobra.CheckErr(fmt.Errorf("unknown format %q, expected table, json, jsonl or csv", format))
+		}
+		out := os.Stdout
+		if output, _ := cmd.Flags().GetString("output"); output != "" {
+			file, err := os.Create(output)
+			cobra.CheckErr(err)
+			defer file.Close()
+			out = file
+		}
+		client := newRegistryClient(cmd)
+
+		switch format {
+		case "jsonl", "csv":
+			query.Set("format", format)
+			resp, data, err := client.request(http.MethodGet, "/v1/admin/audit?"+query.Encode(), nil, nil)
+			cobra.CheckErr(err)
+			_, err = out.Write(data)
+			cobra.CheckErr(err)
+			if resp.Header.Get(admin.AuditTruncatedHeader) != "" {
+				fmt.Fprintln(os.Stderr, "Older events were left out, narrow the time range or raise --limit")
+			}
+		default:
+			resp := &admin.AuditResponse{}
+			cobra.CheckErr(client.do(http.MethodGet, "/v1/admin/audit?"+query.Encode(), nil, resp))
+			if format == "json" {
+				encoder := json.NewEncoder(out)
+				encoder.SetIndent("", "  ")
+				cobra.CheckErr(encoder.Encode(resp))
+			} else {
+				printAuditEvents(out, resp.Events)
+			}
+			if resp.Truncated {
+				fmt.Fprintln(os.Stderr, "Older events were left out, narrow the time range or raise --limit")
+			}
+		}
+	},
+}
+
+// printAuditEvents lists audit events as a table showing how the state of each version changed
+func printAuditEvents(out *os.File, events []*audit.Event) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tACTION\tACTOR\tSOURCE IP\tMODULE\tVERSION\tCHANGE")
+	for _, event := range events {
+		module := event.Organization
+		if event.Name != "" {
+			module = fmt.Sprintf("%s/%s/%s", event.Organization, event.Name, event.Provider)
+		}
+		change := fmt.Sprintf("%s -> %s", describeSnapshot(event.Before), describeSnapshot(event.After))
+		if event.Reason != "" {
+			change = event.Reason
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", event.Timestamp.Format(time.RFC3339), event.Action, event.Actor,
+			event.SourceIP, module, event.Version, change)
+	}
+	w.Flush()
+}
+
+// describeSnapshot summarises the state of a version, or the number of roles granted on an organization, in an audit
+// event
+func describeSnapshot(snapshot *audit.Snapshot) string {
+	if snapshot == nil {
+		return "none"
+	}
+	if len(snapshot.Grants) > 0 {
+		return fmt.Sprintf("%d grants", len(snapshot.Grants))
+	}
+	state := "active"
+	if snapshot.Lifecycle != nil {
+		state = string(snapshot.Lifecycle.State)
+	}
+	if len(snapshot.Checksum) > 12 {
+		return fmt.Sprintf("%s(%s)", state, snapshot.Checksum[:12])
+	}
+	return state
+}
+
+func init() {
+	addRegistryFlags(auditCmd)
+	auditCmd.Flags().String("organization", "", "Only list changes to modules of this organization")
+	auditCmd.Flags().String("module", "", "Only list changes to modules with this name")
+	auditCmd.Flags().String("actor", "", "Only list changes made by this identity")
+	auditCmd.Flags().String("action", "", "Only list changes of this kind, such as module.publish or module.delete")
+	auditCmd.Flags().String("since", "", "Only list changes made at or after this RFC 3339 time")
+	auditCmd.Flags().String("until", "", "Only list changes made before this RFC 3339 time")
+	auditCmd.Flags().Int("limit", 0, fmt.Sprintf("Largest number of most recent changes to list, the registry defaults to %d", admin.DefaultAuditLimit))
+	auditCmd.Flags().String("format", "table", "Output format: table, json, jsonl or csv")
+	auditCmd.Flags().String("output", "", "Write to this file instead of standard output")
+	rootCmd.AddCommand(auditCmd)
+}
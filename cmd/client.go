@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// maxResponseSize bounds the size of registry responses read by the CLI, which includes module archives
+const maxResponseSize int64 = 128 << 20
+
+// registryClient calls the API of a running Terrarium registry on behalf of the CLI commands managing it
+type registryClient struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+// addRegistryFlags adds the flags locating the registry and authenticating to it. They default to the
+// TERRARIUM_REGISTRY_URL and TERRARIUM_TOKEN environment variables so that tokens need not appear in shell history.
+func addRegistryFlags(cmd *cobra.Command) {
+	registryURL := os.Getenv("TERRARIUM_REGISTRY_URL")
+	if registryURL == "" {
+		registryURL = "http://localhost:3000"
+	}
+	cmd.Flags().String("registry", registryURL, "Base URL of the Terrarium registry, defaults to $TERRARIUM_REGISTRY_URL")
+	cmd.Flags().String("token", os.Getenv("TERRARIUM_TOKEN"), "Bearer token used to authenticate, defaults to $TERRARIUM_TOKEN")
+}
+
+func newRegistryClient(cmd *cobra.Command) *registryClient {
+	registryURL, _ := cmd.Flags().GetString("registry")
+	token, _ := cmd.Flags().GetString("token")
+	c := &registryClient{
+		baseURL: strings.TrimSuffix(registryURL, "/"),
+		token:   token,
+	}
+	c.client = &http.Client{
+		Timeout: 30 * time.Second,
+		// Redirects keep the token for subdomains of the registry by default, it is only kept for the registry itself
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			if !c.isRegistry(req.URL) {
+				req.Header.Del("Authorization")
+			}
+			return nil
+		},
+	}
+	return c
+}
+
+// do sends a request to the registry, encoding body as JSON when set, and decodes the data of the response envelope
+// into out when set. Error responses are returned as errors carrying the message of the registry.
+func (c *registryClient) do(method string, path string, body interface{}, out interface{}) error {
+	if body == nil {
+		return c.send(method, path, nil, nil, out)
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return c.send(method, path, http.Header{"Content-Type": {"application/json"}}, bytes.NewReader(data), out)
+}
+
+// send is do for request bodies that are not JSON, such as module archives
+func (c *registryClient) send(method string, path string, header http.Header, body io.Reader, out interface{}) error {
+	_, data, err := c.request(method, path, header, body)
+	if err != nil || out == nil {
+		return err
+	}
+	envelope := struct {
+		Data json.RawMessage `json:"data"`
+	}{}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return fmt.Errorf("failed decoding registry response - %w", err)
+	}
+	return json.Unmarshal(envelope.Data, out)
+}
+
+// request sends a request to the registry and returns the response with its body. Paths may also be absolute URLs,
+// such as those returned in X-Terraform-Get, which are only sent the token when they point at the registry itself.
+// Error responses are returned as errors carrying the registry's message.
+func (c *registryClient) request(method string, path string, header http.Header, body io.Reader) (*http.Response, []byte, error) {
+	target := path
+	if !strings.Contains(path, "://") {
+		target = c.baseURL + path
+	}
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if c.token != "" && c.isRegistry(req.URL) {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		failure := &registryError{StatusCode: resp.StatusCode}
+		json.Unmarshal(data, failure)
+		return nil, nil, failure
+	}
+	return resp, data, nil
+}
+
+// isRegistry reports whether a URL has the scheme and host of the registry, so that the token is never sent to the
+// storage a download URL points to or to any other host
+func (c *registryClient) isRegistry(target *url.URL) bool {
+	base, err := url.Parse(c.baseURL)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(target.Scheme, base.Scheme) && strings.EqualFold(target.Host, base.Host)
+}
+
+// registryError is an error response of the registry, with the structured details some errors carry. Module routes
+// answer with the errors of the registry protocols, other routes with a message.
+type registryError struct {
+	StatusCode int             `json:"-"`
+	Message    string          `json:"message"`
+	Errors     []string        `json:"errors"`
+	Details    json.RawMessage `json:"details"`
+	// Data is set by errors reporting what was done before the request failed, such as partial deletions
+	Data json.RawMessage `json:"data"`
+}
+
+func (e *registryError) Error() string {
+	if e.Message == "" && len(e.Errors) > 0 {
+		return fmt.Sprintf("registry returned %d: %s", e.StatusCode, strings.Join(e.Errors, "; "))
+	}
+	if e.Message == "" {
+		return fmt.Sprintf("registry returned %d", e.StatusCode)
+	}
+	return fmt.Sprintf("registry returned %d: %s", e.StatusCode, e.Message)
+}
+
+// parseModuleAddress splits an organization/name/provider module address
+func parseModuleAddress(address string) (string, string, string, error) {
+	parts := strings.Split(address, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", "", "", fmt.Errorf("module address %q must have the form organization/name/provider", address)
+	}
+	return parts[0], parts[1], parts[2], nil
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/terrariumcloud/terrarium-lite/internal/config"
+	"gopkg.in/yaml.v2"
+)
+
+// configCmd groups commands inspecting the resolved configuration
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the Terrarium configuration",
+	Long:  `Inspect the configuration resolved from the config file, TERRARIUM_* environment variables and defaults`,
+}
+
+// configValidateCmd validates the resolved configuration
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validates the configuration",
+	Long:  `Validates the resolved configuration, listing every problem found. Exits non-zero when the configuration is invalid`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, err := config.Load(viper.GetViper()); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		fmt.Println("Configuration is valid")
+	},
+}
+
+// configPrintCmd prints the resolved configuration
+var configPrintCmd = &cobra.Command{
+	Use:   "print",
+	Short: "Prints the resolved configuration as YAML",
+	Long:  `Prints the configuration resolved from the config file, environment and defaults as YAML. The output can be used as a starting point for a config file`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := &config.Config{}
+		cobra.CheckErr(viper.Unmarshal(cfg))
+		data, err := yaml.Marshal(cfg)
+		cobra.CheckErr(err)
+		fmt.Print(string(data))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configPrintCmd)
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/terrariumcloud/terrarium-lite/api/admin"
+)
+
+// deleteCmd removes module versions from a running registry
+var deleteCmd = &cobra.Command{
+	Use:   "delete <organization>[/<name>/<provider>] [version]",
+	Short: "Deletes a module version, a module or an organization",
+	Long: `Deletes a single module version, every version of a module or every module of an organization from a running
+registry. Deleted versions can no longer be downloaded, consider yanking versions that may still be locked instead.
+Use --dry-run to list what would be deleted. Requires the admin role on the organization.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		var segments []string
+		if strings.Contains(args[0], "/") {
+			orgName, moduleName, providerName, err := parseModuleAddress(args[0])
+			cobra.CheckErr(err)
+			segments = []string{orgName, moduleName, providerName}
+			if len(args) == 2 {
+				segments = append(segments, args[1])
+			}
+		} else {
+			if len(args) == 2 {
+				cobra.CheckErr(fmt.Errorf("a version can only be deleted from a module given as organization/name/provider"))
+			}
+			segments = []string{args[0]}
+		}
+		for i := range segments {
+			segments[i] = url.PathEscape(segments[i])
+		}
+		path := fmt.Sprintf("/v1/admin/modules/%s?dry_run=%t", strings.Join(segments, "/"), dryRun)
+		resp := &admin.DeletionResponse{}
+		err := newRegistryClient(cmd).do(http.MethodDelete, path, nil, resp)
+		var failure *registryError
+		if errors.As(err, &failure) && len(failure.Data) > 0 {
+			// Versions deleted before the one that failed are still reported
+			json.Unmarshal(failure.Data, resp)
+		}
+		verb := "Deleted"
+		if resp.DryRun {
+			verb = "Would delete"
+		}
+		for _, version := range resp.Versions {
+			fmt.Printf("%s %s/%s/%s %s\n", verb, version.Organization, version.Name, version.Provider, version.Version)
+		}
+		if resp.Failed != nil {
+			err = fmt.Errorf("failed deleting %s/%s/%s %s - %w", resp.Failed.Organization, resp.Failed.Name, resp.Failed.Provider, resp.Failed.Version, err)
+		}
+		cobra.CheckErr(err)
+	},
+}
+
+func init() {
+	addRegistryFlags(deleteCmd)
+	deleteCmd.Flags().Bool("dry-run", false, "List the versions that would be deleted without deleting them")
+	rootCmd.AddCommand(deleteCmd)
+}
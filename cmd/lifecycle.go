@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/spf13/cobra"
+	"github.com/terrariumcloud/terrarium-lite/api/admin"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/modules"
+)
+
+// deprecateCmd marks a module version as deprecated
+var deprecateCmd = &cobra.Command{
+	Use:   "deprecate <organization>/<name>/<provider> <version>",
+	Short: "Deprecates a module version",
+	Long: `Deprecates a module version on a running registry. The version stays listed and downloadable but Terraform
+warns users of it with the given reason. Requires the admin role on the organization.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		reason, _ := cmd.Flags().GetString("reason")
+		replacement, _ := cmd.Flags().GetString("replacement")
+		link, _ := cmd.Flags().GetString("link")
+		updateLifecycle(cmd, args, &admin.LifecycleRequest{
+			State:       modules.VersionDeprecated,
+			Reason:      reason,
+			Replacement: replacement,
+			Link:        link,
+		})
+	},
+}
+
+// yankCmd hides a module version from version listings
+var yankCmd = &cobra.Command{
+	Use:   "yank <organization>/<name>/<provider> <version>",
+	Short: "Yanks a module version",
+	Long: `Yanks a module version on a running registry. The version is no longer listed, so version constraints will not
+select it, but it stays downloadable by exact version so existing lock files keep working. Requires the admin role on
+the organization.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		reason, _ := cmd.Flags().GetString("reason")
+		updateLifecycle(cmd, args, &admin.LifecycleRequest{
+			State:  modules.VersionYanked,
+			Reason: reason,
+		})
+	},
+}
+
+// restoreCmd returns a deprecated or yanked module version to active
+var restoreCmd = &cobra.Command{
+	Use:   "restore <organization>/<name>/<provider> <version>",
+	Short: "Restores a deprecated or yanked module version",
+	Long:  `Clears the deprecation or yank of a module version on a running registry. Requires the admin role on the organization.`,
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		updateLifecycle(cmd, args, &admin.LifecycleRequest{State: modules.VersionActive})
+	},
+}
+
+func updateLifecycle(cmd *cobra.Command, args []string, req *admin.LifecycleRequest) {
+	orgName, moduleName, providerName, err := parseModuleAddress(args[0])
+	cobra.CheckErr(err)
+	path := fmt.Sprintf("/v1/admin/modules/%s/%s/%s/%s/lifecycle",
+		url.PathEscape(orgName), url.PathEscape(moduleName), url.PathEscape(providerName), url.PathEscape(args[1]))
+	lifecycle := &modules.VersionLifecycle{}
+	cobra.CheckErr(newRegistryClient(cmd).do(http.MethodPut, path, req, lifecycle))
+	fmt.Printf("%s %s is now %s\n", args[0], args[1], lifecycle.State)
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{deprecateCmd, yankCmd, restoreCmd} {
+		addRegistryFlags(cmd)
+		rootCmd.AddCommand(cmd)
+	}
+	deprecateCmd.Flags().String("reason", "", "Why the version is deprecated, shown to its users")
+	deprecateCmd.Flags().String("replacement", "", "What to use instead, for example a newer version")
+	deprecateCmd.Flags().String("link", "", "URL of further information such as release notes or an advisory")
+	yankCmd.Flags().String("reason", "", "Why the version is yanked")
+	cobra.CheckErr(deprecateCmd.MarkFlagRequired("reason"))
+	cobra.CheckErr(yankCmd.MarkFlagRequired("reason"))
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/terrariumcloud/terrarium-lite/internal/archive"
+	"github.com/terrariumcloud/terrarium-lite/internal/policy"
+)
+
+// lintCmd checks a module against policy rules the same way the registry does when it is published
+var lintCmd = &cobra.Command{
+	Use:   "lint [directory|archive.zip]",
+	Short: "Checks a module against policy rules",
+	Long: `Checks a module directory or zip archive, defaulting to the current directory, against the same policy rules the
+registry enforces when modules are published. Rules are read from --rules-file, or from the rules file of
+--organization in the policy rules directory. Zip archives are also checked for unsafe content. Exits non-zero when
+the module violates any rule.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		target := "."
+		if len(args) > 0 {
+			target = args[0]
+		}
+		rules, err := lintPolicy(cmd)
+		cobra.CheckErr(err)
+
+		var module *policy.Module
+		if strings.HasSuffix(target, ".zip") {
+			data, err := os.ReadFile(target)
+			cobra.CheckErr(err)
+			if validation := archive.Validate(data, archive.DefaultLimits); !validation.Valid {
+				cobra.CheckErr(fmt.Errorf("invalid module archive - %s", validation.Reason))
+			}
+			module, err = policy.LoadZip(data)
+			cobra.CheckErr(err)
+		} else {
+			module, err = policy.LoadDirectory(target)
+			cobra.CheckErr(err)
+		}
+		violations := rules.Evaluate(module)
+		for _, violation := range violations {
+			fmt.Println(violation.String())
+		}
+		if len(violations) > 0 {
+			fmt.Printf("%d policy violation(s)\n", len(violations))
+			os.Exit(1)
+		}
+		fmt.Println("No policy violations")
+	},
+}
+
+// lintPolicy loads the rules selected by the flags of the lint command
+func lintPolicy(cmd *cobra.Command) (*policy.Policy, error) {
+	if rulesFile, _ := cmd.Flags().GetString("rules-file"); rulesFile != "" {
+		return policy.LoadPolicy(rulesFile)
+	}
+	orgName, _ := cmd.Flags().GetString("organization")
+	if orgName == "" {
+		return nil, errors.New("either --rules-file or --organization must be given")
+	}
+	rulesDir, _ := cmd.Flags().GetString("policy-rules-dir")
+	if rulesDir == "" {
+		rulesDir = viper.GetString("policy.rules_dir")
+	}
+	if rulesDir == "" {
+		return nil, errors.New("--organization requires --policy-rules-dir or policy.rules_dir in the configuration")
+	}
+	for _, ext := range []string{".yaml", ".yml"} {
+		rulesFile := filepath.Join(rulesDir, orgName+ext)
+		if _, err := os.Stat(rulesFile); err == nil {
+			return policy.LoadPolicy(rulesFile)
+		}
+	}
+	return nil, fmt.Errorf("no policy rules for organization %s in %s", orgName, rulesDir)
+}
+
+// printPolicyViolations lists the policy violations carried by an error response of the registry, if any
+func printPolicyViolations(err error) {
+	var failure *registryError
+	if !errors.As(err, &failure) || len(failure.Details) == 0 {
+		return
+	}
+	var violations []policy.Violation
+	if json.Unmarshal(failure.Details, &violations) != nil {
+		return
+	}
+	for _, violation := range violations {
+		fmt.Fprintln(os.Stderr, violation.String())
+	}
+}
+
+func init() {
+	lintCmd.Flags().String("rules-file", "", "Path to a policy rules file to check against")
+	lintCmd.Flags().String("organization", "", "Check against the rules of this organization in the policy rules directory")
+	lintCmd.Flags().String("policy-rules-dir", "", "Directory of policy rules files, defaults to policy.rules_dir from the configuration")
+	rootCmd.AddCommand(lintCmd)
+}
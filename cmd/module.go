@@ -1,64 +1,269 @@
 package cmd
 
 import (
-	"log"
+	"context"
+	"errors"
+	"net/http"
+	"os/signal"
+	"syscall"
 
 	"github.com/terrariumcloud/terrarium-lite/api"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/terrariumcloud/terrarium-lite/internal/auth"
+	"github.com/terrariumcloud/terrarium-lite/internal/auth/mtls"
+	"github.com/terrariumcloud/terrarium-lite/internal/auth/oidc"
+	"github.com/terrariumcloud/terrarium-lite/internal/cache"
+	"github.com/terrariumcloud/terrarium-lite/internal/certs"
+	"github.com/terrariumcloud/terrarium-lite/internal/config"
 	fs_db "github.com/terrariumcloud/terrarium-lite/internal/database/filesystem"
+	"github.com/terrariumcloud/terrarium-lite/internal/logging"
+	"github.com/terrariumcloud/terrarium-lite/internal/metrics"
+	"github.com/terrariumcloud/terrarium-lite/internal/policy"
+	"github.com/terrariumcloud/terrarium-lite/internal/ratelimit"
 	"github.com/terrariumcloud/terrarium-lite/internal/responder"
+	"github.com/terrariumcloud/terrarium-lite/internal/signing"
 	fs_storage "github.com/terrariumcloud/terrarium-lite/internal/storage/filesystem"
+	"github.com/terrariumcloud/terrarium-lite/internal/tracing"
+	"github.com/terrariumcloud/terrarium-lite/internal/webhook"
 	"github.com/terrariumcloud/terrarium-lite/pkg/registry/drivers"
 )
 
-var storageFilesystemRootPath string
-var certFile string
-var keyFile string
-
 // moduleCmd represents the module command
 var moduleCmd = &cobra.Command{
 	Use:   "serve",
 	Short: "Starts the Terrarium Module API",
-	Long:  `The Terrarium Module API allows users to manage Terraform modules in a private registry using Terrarium`,
+	Long: `The Terrarium Module API allows users to manage Terraform modules in a private registry using Terrarium.
+
+Publishing and administration require authentication through OIDC tokens or client certificates. A registry without
+any authentication configured is read only.
+
+Every flag can also be set in the config file or through a TERRARIUM_* environment variable, see "terrarium config print"
+for the available keys.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		var driver drivers.TerrariumDatabaseDriver
 		var storage drivers.TerrariumStorageDriver
 		var err error
 
-		if storageFilesystemRootPath == "" {
-			log.Fatal("ERROR: No root path specified")
+		cfg, err := config.Load(viper.GetViper())
+		if err != nil {
+			logging.Default().Fatalf("ERROR: %s", err.Error())
 		}
-
-		if certFile == "" {
-			log.Fatal("ERROR: No certificate file specified")
+		logger, err := logging.New(cfg.Logging.Level, cfg.Logging.Format)
+		if err != nil {
+			logging.Default().Fatalf("Error initialising logging - %s", err.Error())
 		}
 
-		if keyFile == "" {
-			log.Fatal("ERROR: No private key file specified")
+		driver, err = fs_db.New(cfg.Database.Filesystem.Root, logger.WithField("component", "database"))
+		if err != nil {
+			logger.Fatalf("Error initializing the filesystem database driver - %s", err.Error())
 		}
 
-		driver, err = fs_db.New(storageFilesystemRootPath)
+		storage, err = fs_storage.New(cfg.Storage.Filesystem.Root, logger.WithField("component", "storage"))
 		if err != nil {
-			log.Fatalf("Error initializing the filesystem database driver - %s", err.Error())
+			logger.Fatalf("Error initialising filesystem storage backend - %s", err.Error())
 		}
 
-		storage, err = fs_storage.New(storageFilesystemRootPath)
-		if err != nil {
-			log.Fatalf("Error initialising filesystem storage backend - %s", err.Error())
+		var certificates *certs.Store
+		if !cfg.Listener.Plaintext {
+			keyPairs := make([]certs.KeyPair, len(cfg.TLS.CertificateFiles))
+			for i := range cfg.TLS.CertificateFiles {
+				keyPairs[i] = certs.KeyPair{CertFile: cfg.TLS.CertificateFiles[i], KeyFile: cfg.TLS.KeyFiles[i]}
+			}
+			certificates, err = certs.New(keyPairs, cfg.TLS.ReloadInterval, logger.WithField("component", "certs"))
+			if err != nil {
+				logger.Fatalf("Error loading TLS certificates - %s", err.Error())
+			}
 		}
 
-		terrarium := api.NewTerrarium(443, certFile, keyFile, driver, storage, &responder.TerrariumAPIResponseWriter{}, &responder.TerrariumAPIErrorHandler{})
-		err = terrarium.Serve()
-		if err != nil {
-			log.Fatal(err)
+		terrarium := api.NewTerrarium(cfg.Listener.BindAddress, cfg.Listener.Port, certificates, driver, storage, &responder.TerrariumAPIResponseWriter{Logger: logger}, &responder.TerrariumAPIErrorHandler{Logger: logger})
+		terrarium.ProtocolErrorer = &responder.RegistryErrorHandler{Logger: logger}
+		terrarium.Logger = logger
+		terrarium.Plaintext = cfg.Listener.Plaintext
+		terrarium.TrustProxy = cfg.Listener.TrustProxyHeaders
+		terrarium.AccessLog = cfg.Logging.AccessLog
+		if cfg.Auth.OIDC.Issuer != "" {
+			authenticator, err := oidc.New(context.Background(), &oidc.Config{
+				Issuer:     cfg.Auth.OIDC.Issuer,
+				Audience:   cfg.Auth.OIDC.Audience,
+				JWKSURL:    cfg.Auth.OIDC.JWKSURL,
+				JWKSFile:   cfg.Auth.OIDC.JWKSFile,
+				PolicyFile: cfg.Auth.OIDC.PolicyFile,
+				TeamsClaim: cfg.Auth.OIDC.TeamsClaim,
+			})
+			if err != nil {
+				logger.Fatalf("Error initialising OIDC authentication - %s", err.Error())
+			}
+			terrarium.Authenticators = append(terrarium.Authenticators, authenticator)
+		}
+		if cfg.TLS.ClientAuth.CAFile != "" {
+			terrarium.ClientVerifier, err = mtls.New(&mtls.Config{
+				CAFile:            cfg.TLS.ClientAuth.CAFile,
+				CRLFiles:          cfg.TLS.ClientAuth.CRLFiles,
+				CRLReloadInterval: cfg.TLS.ClientAuth.CRLReloadInterval,
+				IdentitySource:    mtls.IdentitySource(cfg.TLS.ClientAuth.IdentitySource),
+			}, logger.WithField("component", "mtls"))
+			if err != nil {
+				logger.Fatalf("Error initialising client certificate authentication - %s", err.Error())
+			}
+			terrarium.Authenticators = append(terrarium.Authenticators, terrarium.ClientVerifier)
+		}
+		if cfg.Auth.RBACFile != "" {
+			terrarium.RoleBindings, err = auth.LoadRoleBindings(cfg.Auth.RBACFile)
+			if err != nil {
+				logger.Fatalf("Error loading role bindings - %s", err.Error())
+			}
+		}
+		if cfg.Metrics.Enabled {
+			terrarium.Metrics = metrics.New(cfg.Metrics.ModuleDownloads)
+		}
+		if cfg.Tracing.Enabled {
+			terrarium.Tracing, err = tracing.New(context.Background(), &tracing.Config{
+				Endpoint:    cfg.Tracing.Endpoint,
+				Insecure:    cfg.Tracing.Insecure,
+				ServiceName: cfg.Tracing.ServiceName,
+				SampleRatio: cfg.Tracing.SampleRatio,
+			})
+			if err != nil {
+				logger.Fatalf("Error initialising tracing - %s", err.Error())
+			}
+		}
+		if cfg.Signing.TrustedKeysFile != "" {
+			terrarium.TrustedKeys, err = signing.LoadTrustedKeys(cfg.Signing.TrustedKeysFile)
+			if err != nil {
+				logger.Fatalf("Error loading trusted signing keys - %s", err.Error())
+			}
+		}
+		terrarium.RequireSigned = cfg.Signing.RequireSigned
+		terrarium.Regulated = cfg.Approval.RequiredFor
+		if cfg.Policy.RulesDir != "" {
+			terrarium.Policies, err = policy.LoadEngine(cfg.Policy.RulesDir)
+			if err != nil {
+				logger.Fatalf("Error loading policy rules - %s", err.Error())
+			}
+		}
+		if cfg.Webhooks.EndpointsFile != "" {
+			endpoints, err := webhook.LoadEndpoints(cfg.Webhooks.EndpointsFile)
+			if err != nil {
+				logger.Fatalf("Error loading webhook endpoints - %s", err.Error())
+			}
+			terrarium.Webhooks = webhook.New(endpoints, driver.Webhooks(), webhook.Config{
+				MaxAttempts:    cfg.Webhooks.MaxAttempts,
+				InitialBackoff: cfg.Webhooks.InitialBackoff,
+				MaxBackoff:     cfg.Webhooks.MaxBackoff,
+				Timeout:        cfg.Webhooks.Timeout,
+			}, logger.WithField("component", "webhooks"))
+		}
+		if cfg.RateLimit.Enabled {
+			limits := ratelimit.Config{
+				Classes:      map[ratelimit.Class]ratelimit.Limit{},
+				DefaultQuota: ratelimit.Quota{Bytes: cfg.RateLimit.Quotas.Default.Bytes, Period: cfg.RateLimit.Quotas.Default.Period},
+				Quotas:       map[string]ratelimit.Quota{},
+			}
+			for class, limit := range cfg.RateLimit.Classes {
+				limits.Classes[ratelimit.Class(class)] = ratelimit.Limit{Rate: limit.Rate, Burst: limit.Burst}
+			}
+			for orgName, quota := range cfg.RateLimit.Quotas.Organizations {
+				limits.Quotas[orgName] = ratelimit.Quota{Bytes: quota.Bytes, Period: quota.Period}
+			}
+			terrarium.RateLimits = ratelimit.New(limits)
+		}
+		if cfg.Cache.Enabled {
+			terrarium.Cache = &cache.Config{ArchiveBytes: cfg.Cache.ArchiveBytes, VersionsTTL: cfg.Cache.VersionsTTL}
+		}
+		terrarium.DrainTimeout = cfg.Listener.DrainTimeout
+		terrarium.ShutdownDelay = cfg.Listener.ShutdownDelay
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		err = terrarium.Serve(ctx)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatal(err)
 		}
 	},
 }
 
+// bindFlag binds a flag to one or more configuration keys so that it takes precedence over the config file and environment
+func bindFlag(cmd *cobra.Command, name string, keys ...string) {
+	for _, key := range keys {
+		cobra.CheckErr(viper.BindPFlag(key, cmd.Flags().Lookup(name)))
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(moduleCmd)
-	moduleCmd.Flags().StringVarP(&storageFilesystemRootPath, "filesystem-storage-root", "", "/terrarium/store", "Path to the storage for the filesystem storage")
-	moduleCmd.Flags().StringVarP(&certFile, "certificate-file", "", "", "Path to the SSL certificate file")
-	moduleCmd.Flags().StringVarP(&keyFile, "key-file", "", "", "Path to the SSL private key file")
+	d := config.Defaults()
+	flags := moduleCmd.Flags()
+	flags.String("filesystem-storage-root", d.Storage.Filesystem.Root, "Path to the storage for the filesystem storage")
+	flags.String("bind-address", d.Listener.BindAddress, "Address to listen on. Listens on all interfaces when not set")
+	flags.Int("port", d.Listener.Port, "Port to listen on")
+	flags.Bool("plaintext", d.Listener.Plaintext, "Serve plain HTTP, for use behind a TLS terminating load balancer or ingress")
+	flags.Bool("trust-proxy-headers", d.Listener.TrustProxyHeaders, "Trust X-Forwarded-For, X-Forwarded-Proto and X-Forwarded-Host headers, only safe behind a proxy that overwrites them")
+	flags.Duration("drain-timeout", d.Listener.DrainTimeout, "How long in flight requests are given to complete on shutdown")
+	flags.Duration("shutdown-delay", d.Listener.ShutdownDelay, "How long to keep serving after reporting not ready on shutdown, so load balancers stop sending new requests")
+	flags.StringSlice("certificate-file", d.TLS.CertificateFiles, "Path to the SSL certificate file. May be repeated with matching --key-file flags to serve several hostnames selected by SNI")
+	flags.StringSlice("key-file", d.TLS.KeyFiles, "Path to the SSL private key file. May be repeated, in the same order as --certificate-file")
+	flags.Duration("certificate-reload-interval", d.TLS.ReloadInterval, "How often certificate files are checked for changes and reloaded")
+	flags.String("oidc-issuer", d.Auth.OIDC.Issuer, "Issuer URL of OIDC tokens accepted as bearer tokens. Enables authentication when set")
+	flags.String("oidc-audience", d.Auth.OIDC.Audience, "Audience OIDC tokens must be issued for")
+	flags.String("oidc-jwks-url", d.Auth.OIDC.JWKSURL, "URL of the OIDC issuer key set. Discovered from the issuer when not set")
+	flags.String("oidc-jwks-file", d.Auth.OIDC.JWKSFile, "Path to a file containing the OIDC issuer key set")
+	flags.String("oidc-policy-file", d.Auth.OIDC.PolicyFile, "Path to the policy file mapping OIDC token claims to organization permissions")
+	flags.String("oidc-teams-claim", d.Auth.OIDC.TeamsClaim, "OIDC token claim listing the teams of the subject, used for role bindings")
+	flags.String("client-ca-file", d.TLS.ClientAuth.CAFile, "Path to a CA bundle client certificates must be signed by. Enables mutual TLS when set")
+	flags.StringSlice("client-crl-file", d.TLS.ClientAuth.CRLFiles, "Path to a revocation list for client certificates. May be repeated")
+	flags.Duration("client-crl-reload-interval", d.TLS.ClientAuth.CRLReloadInterval, "How often client certificate revocation lists are reloaded")
+	flags.String("client-identity-source", d.TLS.ClientAuth.IdentitySource, "Client certificate attribute used as identity, either subject or san")
+	flags.String("rbac-file", d.Auth.RBACFile, "Path to the file granting reader, publisher and admin roles per organization")
+	flags.Bool("access-log", d.Logging.AccessLog, "Write an access log line for every request")
+	flags.String("log-level", d.Logging.Level, "Minimum level logged, one of trace, debug, info, warn or error")
+	flags.String("log-format", d.Logging.Format, "Format of log lines, either text or json")
+	flags.Bool("metrics", d.Metrics.Enabled, "Expose Prometheus metrics on /metrics")
+	flags.Bool("tracing", d.Tracing.Enabled, "Export OpenTelemetry traces over OTLP/HTTP")
+	flags.String("tracing-endpoint", d.Tracing.Endpoint, "Host and port of the OTLP/HTTP collector traces are exported to")
+	flags.String("trusted-keys-file", d.Signing.TrustedKeysFile, "Path to the file listing public keys trusted to sign module archives per organization")
+	flags.Bool("require-signed", d.Signing.RequireSigned, "Refuse to publish or serve module versions without a verified signature")
+	flags.StringSlice("approval-required-for", d.Approval.RequiredFor, "Pattern of organization/name/provider, such as acme/*/*, of modules whose new versions must be approved by an organization admin other than their publisher. May be repeated")
+	flags.String("policy-rules-dir", d.Policy.RulesDir, "Directory of policy rules files, named after the organization they apply to, checked when modules are published")
+	flags.String("webhook-endpoints-file", d.Webhooks.EndpointsFile, "Path to the file listing webhook endpoints registry events are delivered to")
+	flags.Bool("rate-limit", d.RateLimit.Enabled, "Rate limit requests per client and route class and apply download quotas per organization, as set under rate_limit in the config file")
+	flags.Bool("cache", d.Cache.Enabled, "Cache archives and version lists in memory in front of the storage and database backends")
+	flags.Bool("metrics-module-downloads", d.Metrics.ModuleDownloads, "Export a download counter per module version. Adds a metric series for every version downloaded")
+
+	bindFlag(moduleCmd, "filesystem-storage-root", "database.filesystem.root", "storage.filesystem.root")
+	bindFlag(moduleCmd, "bind-address", "listener.bind_address")
+	bindFlag(moduleCmd, "port", "listener.port")
+	bindFlag(moduleCmd, "plaintext", "listener.plaintext")
+	bindFlag(moduleCmd, "trust-proxy-headers", "listener.trust_proxy_headers")
+	bindFlag(moduleCmd, "drain-timeout", "listener.drain_timeout")
+	bindFlag(moduleCmd, "shutdown-delay", "listener.shutdown_delay")
+	bindFlag(moduleCmd, "certificate-file", "tls.certificate_files")
+	bindFlag(moduleCmd, "key-file", "tls.key_files")
+	bindFlag(moduleCmd, "certificate-reload-interval", "tls.reload_interval")
+	bindFlag(moduleCmd, "oidc-issuer", "auth.oidc.issuer")
+	bindFlag(moduleCmd, "oidc-audience", "auth.oidc.audience")
+	bindFlag(moduleCmd, "oidc-jwks-url", "auth.oidc.jwks_url")
+	bindFlag(moduleCmd, "oidc-jwks-file", "auth.oidc.jwks_file")
+	bindFlag(moduleCmd, "oidc-policy-file", "auth.oidc.policy_file")
+	bindFlag(moduleCmd, "oidc-teams-claim", "auth.oidc.teams_claim")
+	bindFlag(moduleCmd, "client-ca-file", "tls.client_auth.ca_file")
+	bindFlag(moduleCmd, "client-crl-file", "tls.client_auth.crl_files")
+	bindFlag(moduleCmd, "client-crl-reload-interval", "tls.client_auth.crl_reload_interval")
+	bindFlag(moduleCmd, "client-identity-source", "tls.client_auth.identity_source")
+	bindFlag(moduleCmd, "rbac-file", "auth.rbac_file")
+	bindFlag(moduleCmd, "access-log", "logging.access_log")
+	bindFlag(moduleCmd, "log-level", "logging.level")
+	bindFlag(moduleCmd, "log-format", "logging.format")
+	bindFlag(moduleCmd, "metrics", "metrics.enabled")
+	bindFlag(moduleCmd, "tracing", "tracing.enabled")
+	bindFlag(moduleCmd, "tracing-endpoint", "tracing.endpoint")
+	bindFlag(moduleCmd, "metrics-module-downloads", "metrics.module_downloads")
+	bindFlag(moduleCmd, "trusted-keys-file", "signing.trusted_keys_file")
+	bindFlag(moduleCmd, "require-signed", "signing.require_signed")
+	bindFlag(moduleCmd, "policy-rules-dir", "policy.rules_dir")
+	bindFlag(moduleCmd, "approval-required-for", "approval.required_for")
+	bindFlag(moduleCmd, "webhook-endpoints-file", "webhooks.endpoints_file")
+	bindFlag(moduleCmd, "rate-limit", "rate_limit.enabled")
+	bindFlag(moduleCmd, "cache", "cache.enabled")
 }
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/spf13/cobra"
+	apimodules "github.com/terrariumcloud/terrarium-lite/api/modules"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/modules"
+)
+
+// publishCmd uploads a module archive to a running registry
+var publishCmd = &cobra.Command{
+	Use:   "publish <organization>/<name>/<provider> <version> <archive.zip>",
+	Short: "Publishes a module version",
+	Long: `Uploads a zip archive as a new module version to a running registry. Published versions are immutable, publishing
+different content for an existing version fails unless --force is given by an organization admin. Violations of the
+organization's policy rules are listed, see the lint command to check them before publishing. Requires the publisher
+role on the organization.`,
+	Args: cobra.ExactArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+		orgName, moduleName, providerName, err := parseModuleAddress(args[0])
+		cobra.CheckErr(err)
+		force, _ := cmd.Flags().GetBool("force")
+		archive, err := os.Open(args[2])
+		cobra.CheckErr(err)
+		defer archive.Close()
+		path := fmt.Sprintf("/v1/modules/%s/%s/%s/%s?force=%t",
+			url.PathEscape(orgName), url.PathEscape(moduleName), url.PathEscape(providerName), url.PathEscape(args[1]), force)
+		header := http.Header{}
+		if signatureFile, _ := cmd.Flags().GetString("signature-file"); signatureFile != "" {
+			signature, err := os.ReadFile(signatureFile)
+			cobra.CheckErr(err)
+			signatureType, _ := cmd.Flags().GetString("signature-type")
+			header.Set(apimodules.SignatureHeader, base64.StdEncoding.EncodeToString(signature))
+			header.Set(apimodules.SignatureTypeHeader, signatureType)
+		}
+		header.Set("Content-Type", "application/zip")
+		published := &apimodules.PublishedVersion{}
+		err = newRegistryClient(cmd).send(http.MethodPut, path, header, archive, published)
+		printPolicyViolations(err)
+		cobra.CheckErr(err)
+		fmt.Printf("Published %s %s sha256:%s\n", args[0], published.Version, published.Checksum)
+		if published.State == modules.VersionPending {
+			fmt.Println("The version is pending approval by an organization admin before it is served")
+		}
+	},
+}
+
+func init() {
+	addRegistryFlags(publishCmd)
+	publishCmd.Flags().String("signature-file", "", "Path to a detached signature of the archive, raw or base64 encoded")
+	publishCmd.Flags().String("signature-type", "ed25519", "Type of key the signature was made with, ed25519 or pgp")
+	publishCmd.Flags().Bool("force", false, "Replace the content of an existing version. Requires the admin role")
+	rootCmd.AddCommand(publishCmd)
+}
@@ -1,10 +1,12 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
 	"github.com/spf13/cobra"
+	"github.com/terrariumcloud/terrarium-lite/internal/config"
 
 	"github.com/spf13/viper"
 )
@@ -53,10 +55,16 @@ func initConfig() {
 		viper.SetConfigName(".terrarium")
 	}
 
-	viper.AutomaticEnv() // read in environment variables that match
+	config.SetDefaults(viper.GetViper())
+	config.ConfigureEnv(viper.GetViper()) // read in TERRARIUM_* environment variables that match
 
-	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
+	// If a config file is found, read it in. A config file given explicitly must exist and parse.
+	err := viper.ReadInConfig()
+	var notFound viper.ConfigFileNotFoundError
+	switch {
+	case err == nil:
 		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
+	case cfgFile != "" || !errors.As(err, &notFound):
+		cobra.CheckErr(fmt.Errorf("failed reading config file - %w", err))
 	}
 }
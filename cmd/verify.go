@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	fs_db "github.com/terrariumcloud/terrarium-lite/internal/database/filesystem"
+)
+
+// verifyCmd checks module archives on disk against the checksums recorded by the registry
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Detects module archives changed on disk",
+	Long: `Compares every module archive of the filesystem backend against the SHA-256 checksum recorded when it was first
+indexed or published. Archives that were replaced or removed behind the registry's back are reported and the command
+exits non-zero, as are archives failing validation which the registry refuses to serve. Archives added since the
+registry last started are listed as unrecorded.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		root, _ := cmd.Flags().GetString("filesystem-storage-root")
+		if root == "" {
+			root = viper.GetString("database.filesystem.root")
+		}
+		report, err := fs_db.Verify(root)
+		cobra.CheckErr(err)
+		for _, source := range report.Mismatched {
+			fmt.Printf("MODIFIED   %s\n", source)
+		}
+		for _, source := range report.Missing {
+			fmt.Printf("MISSING    %s\n", source)
+		}
+		for _, source := range report.Unrecorded {
+			fmt.Printf("UNRECORDED %s\n", source)
+		}
+		for _, module := range report.Invalid {
+			fmt.Printf("INVALID    %s: %s\n", module.Source, module.Validation.Reason)
+		}
+		fmt.Printf("%d verified, %d modified, %d missing, %d unrecorded, %d invalid\n", len(report.Verified), len(report.Mismatched), len(report.Missing), len(report.Unrecorded), len(report.Invalid))
+		if report.Tampered() || len(report.Invalid) > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	verifyCmd.Flags().String("filesystem-storage-root", "", "Modules path to verify, defaults to database.filesystem.root from the configuration")
+	rootCmd.AddCommand(verifyCmd)
+}
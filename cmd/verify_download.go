@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/spf13/cobra"
+	apimodules "github.com/terrariumcloud/terrarium-lite/api/modules"
+	"github.com/terrariumcloud/terrarium-lite/internal/signing"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/modules"
+)
+
+// verifyDownloadCmd downloads a module version the way Terraform does and verifies its checksum and signature
+var verifyDownloadCmd = &cobra.Command{
+	Use:   "verify-download <organization>/<name>/<provider> <version>",
+	Short: "Downloads a module version and verifies its provenance",
+	Long: `Downloads a module version from a running registry, checks the archive against the checksum the registry recorded
+for it and verifies its detached signature. Signatures are checked against the keys in --trusted-keys-file when given,
+otherwise against the keys the registry lists for the organization, which only proves the archive was signed by a key
+the registry trusts. Exits non-zero when any check fails.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		orgName, moduleName, providerName, err := parseModuleAddress(args[0])
+		cobra.CheckErr(err)
+		client := newRegistryClient(cmd)
+		versionPath := fmt.Sprintf("/v1/modules/%s/%s/%s/%s",
+			url.PathEscape(orgName), url.PathEscape(moduleName), url.PathEscape(providerName), url.PathEscape(args[1]))
+
+		resp, _, err := client.request(http.MethodGet, versionPath+"/download", nil, nil)
+		cobra.CheckErr(err)
+		archiveURL := resp.Header.Get("X-Terraform-Get")
+		recorded := resp.Header.Get(apimodules.ChecksumHeader)
+		if archiveURL == "" {
+			cobra.CheckErr(errors.New("registry did not return a download location"))
+		}
+		_, archive, err := client.request(http.MethodGet, archiveURL, nil, nil)
+		cobra.CheckErr(err)
+		sum := sha256.Sum256(archive)
+		actual := hex.EncodeToString(sum[:])
+		if recorded == "" {
+			cobra.CheckErr(errors.New("registry did not return a checksum for the archive"))
+		}
+		if actual != recorded {
+			cobra.CheckErr(fmt.Errorf("archive checksum %s does not match the recorded checksum %s", actual, recorded))
+		}
+		fmt.Printf("Checksum  sha256:%s OK\n", actual)
+
+		_, data, err := client.request(http.MethodGet, versionPath+"/signature", nil, nil)
+		cobra.CheckErr(err)
+		signature := &modules.SignatureResponse{}
+		cobra.CheckErr(json.Unmarshal(data, signature))
+		keys, err := trustedKeysFor(cmd, client, orgName)
+		cobra.CheckErr(err)
+		keyType, err := signing.ParseKeyType(signature.Type)
+		cobra.CheckErr(err)
+		keyID, err := keys.Verify(orgName, keyType, archive, signature.Signature)
+		cobra.CheckErr(err)
+		fmt.Printf("Signature %s key %s OK\n", signature.Type, keyID)
+
+		if output, _ := cmd.Flags().GetString("output"); output != "" {
+			cobra.CheckErr(os.WriteFile(output, archive, 0o644))
+			fmt.Printf("Archive written to %s\n", output)
+		}
+	},
+}
+
+// trustedKeysFor returns the keys to verify signatures with, preferring a local file over the registry's keys
+func trustedKeysFor(cmd *cobra.Command, client *registryClient, orgName string) (*signing.TrustedKeys, error) {
+	if path, _ := cmd.Flags().GetString("trusted-keys-file"); path != "" {
+		return signing.LoadTrustedKeys(path)
+	}
+	_, data, err := client.request(http.MethodGet, fmt.Sprintf("/v1/modules/%s/keys", url.PathEscape(orgName)), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	keys := &apimodules.KeysResponse{}
+	if err := json.Unmarshal(data, keys); err != nil {
+		return nil, fmt.Errorf("failed decoding trusted keys - %w", err)
+	}
+	return &signing.TrustedKeys{Organizations: map[string][]*signing.PublicKey{orgName: keys.Keys}}, nil
+}
+
+func init() {
+	addRegistryFlags(verifyDownloadCmd)
+	verifyDownloadCmd.Flags().String("trusted-keys-file", "", "Path to a trusted keys file to verify signatures against instead of the registry's keys")
+	verifyDownloadCmd.Flags().StringP("output", "o", "", "Write the verified archive to this path")
+	rootCmd.AddCommand(verifyDownloadCmd)
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/webhooks"
+)
+
+// webhooksCmd groups the commands inspecting webhook deliveries
+var webhooksCmd = &cobra.Command{
+	Use:   "webhooks",
+	Short: "Inspects and redelivers webhook deliveries",
+}
+
+// deliveriesCmd lists webhook deliveries
+var deliveriesCmd = &cobra.Command{
+	Use:   "deliveries",
+	Short: "Lists webhook deliveries",
+	Long:  `Lists the queued and recent webhook deliveries of a running registry, most recent first. Requires the admin role on every organization.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		path := "/v1/admin/webhooks/deliveries"
+		if status, _ := cmd.Flags().GetString("status"); status != "" {
+			path += "?status=" + url.QueryEscape(status)
+		}
+		var deliveries []*webhooks.Delivery
+		cobra.CheckErr(newRegistryClient(cmd).do(http.MethodGet, path, nil, &deliveries))
+		if len(deliveries) == 0 {
+			fmt.Println("No webhook deliveries")
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tENDPOINT\tEVENT\tMODULE\tVERSION\tSTATUS\tATTEMPTS\tCREATED AT\tLAST ERROR")
+		for _, d := range deliveries {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s/%s/%s\t%s\t%s\t%d\t%s\t%s\n", d.ID, d.Endpoint, d.Event.Type, d.Event.Organization, d.Event.Name,
+				d.Event.Provider, d.Event.Version, d.Status, d.Attempts, d.CreatedAt.Format(time.RFC3339), d.LastError)
+		}
+		w.Flush()
+	},
+}
+
+// redeliverCmd sends the event of a webhook delivery again
+var redeliverCmd = &cobra.Command{
+	Use:   "redeliver <delivery-id>",
+	Short: "Sends the event of a webhook delivery again",
+	Long:  `Queues the event of a delivered or failed webhook delivery again as a new delivery to the same endpoint. Requires the admin role on every organization.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		delivery := &webhooks.Delivery{}
+		cobra.CheckErr(newRegistryClient(cmd).do(http.MethodPost, fmt.Sprintf("/v1/admin/webhooks/deliveries/%s/redeliver", url.PathEscape(args[0])), nil, delivery))
+		fmt.Printf("Queued delivery %s of event %s to %s\n", delivery.ID, delivery.Event.ID, delivery.Endpoint)
+	},
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{deliveriesCmd, redeliverCmd} {
+		addRegistryFlags(cmd)
+		webhooksCmd.AddCommand(cmd)
+	}
+	deliveriesCmd.Flags().String("status", "", "Only list deliveries with this status: pending, delivered or failed")
+	rootCmd.AddCommand(webhooksCmd)
+}
@@ -0,0 +1,399 @@
+// Package archive checks module archives for content that is unsafe to extract or that cannot be a Terraform module
+// before the registry serves them. Zip archives as well as plain and gzip compressed tarballs are understood.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/modules"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/responses"
+)
+
+// Format is the container format of an archive
+type Format string
+
+const (
+	FormatZip   Format = "zip"
+	FormatTar   Format = "tar"
+	FormatTarGz Format = "tar.gz"
+)
+
+// Limits bounds the resources an archive may claim once extracted
+type Limits struct {
+	// MaxSize is the largest archive accepted, in bytes
+	MaxSize int64
+	// MaxUncompressedSize is the largest total size of the extracted files, in bytes
+	MaxUncompressedSize int64
+	// MaxCompressionRatio is the largest ratio of extracted to archive size. It is only enforced once the extracted
+	// files exceed ratioThreshold so that small, highly compressible modules are not rejected.
+	MaxCompressionRatio int64
+	// MaxEntries is the largest number of entries in the archive
+	MaxEntries int
+}
+
+// DefaultMaxSize is the largest archive accepted by DefaultLimits
+const DefaultMaxSize int64 = 64 << 20
+
+// DefaultLimits are generous for Terraform modules while refusing archive bombs
+var DefaultLimits = Limits{
+	MaxSize:             DefaultMaxSize,
+	MaxUncompressedSize: 256 << 20,
+	MaxCompressionRatio: 100,
+	MaxEntries:          10000,
+}
+
+// ratioThreshold is the extracted size below which the compression ratio is not checked
+const ratioThreshold int64 = 1 << 20
+
+// maxLinkTarget is the longest symlink target read from a zip entry
+const maxLinkTarget int64 = 4096
+
+// maxLinkHops is the most symlinks followed while resolving a single path, as extracting would give up with too many
+// levels of symbolic links
+const maxLinkHops = 40
+
+var windowsDrive = regexp.MustCompile(`^[A-Za-z]:`)
+
+// ErrUnknownFormat is returned for data that is neither a zip archive nor a tarball
+var ErrUnknownFormat = responses.NewStatusError(http.StatusUnprocessableEntity, "archive is not a zip file or tarball")
+
+// Validate checks an archive held in memory and returns the outcome. Invalid archives carry the reason they were
+// rejected.
+func Validate(data []byte, limits Limits) *modules.ArchiveValidation {
+	result := &modules.ArchiveValidation{ValidatedAt: time.Now().UTC()}
+	if int64(len(data)) > limits.MaxSize {
+		return reject(result, fmt.Errorf("archive is %d bytes, larger than the maximum of %d bytes", len(data), limits.MaxSize))
+	}
+	format, err := detectFormat(data)
+	if err != nil {
+		return reject(result, err)
+	}
+	result.Format = string(format)
+	v := &validator{limits: limits, archiveSize: int64(len(data))}
+	switch format {
+	case FormatZip:
+		err = v.zip(data)
+	case FormatTarGz:
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(bytes.NewReader(data)); err == nil {
+			err = v.tar(gz)
+		}
+	default:
+		err = v.tar(bytes.NewReader(data))
+	}
+	if err == nil {
+		err = v.resolveLinks()
+	}
+	if err == nil && v.modules == 0 {
+		err = errors.New("archive contains no .tf files")
+	}
+	result.Files = v.files
+	result.UncompressedSize = v.size
+	if err != nil {
+		return reject(result, err)
+	}
+	result.Valid = true
+	return result
+}
+
+// ValidateFile checks an archive on disk, refusing oversize archives before reading them
+func ValidateFile(name string, limits Limits) (*modules.ArchiveValidation, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > limits.MaxSize {
+		result := &modules.ArchiveValidation{ValidatedAt: time.Now().UTC()}
+		return reject(result, fmt.Errorf("archive is %d bytes, larger than the maximum of %d bytes", info.Size(), limits.MaxSize)), nil
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return Validate(data, limits), nil
+}
+
+func reject(result *modules.ArchiveValidation, err error) *modules.ArchiveValidation {
+	result.Valid = false
+	result.Reason = err.Error()
+	return result
+}
+
+func detectFormat(data []byte) (Format, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")), bytes.HasPrefix(data, []byte("PK\x05\x06")):
+		return FormatZip, nil
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		return FormatTarGz, nil
+	case len(data) > 262 && bytes.Equal(data[257:262], []byte("ustar")):
+		return FormatTar, nil
+	default:
+		return "", ErrUnknownFormat
+	}
+}
+
+// validator accumulates the totals of an archive while its entries are checked
+type validator struct {
+	limits      Limits
+	archiveSize int64
+	entries     int
+	files       int
+	modules     int
+	size        int64
+	// links holds the target of every symlink by the cleaned name of the link, and paths the names of the entries and
+	// hard link targets to resolve through them once the whole archive has been read
+	links map[string]string
+	paths []string
+	hops  int
+}
+
+func (v *validator) zip(data []byte) error {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return fmt.Errorf("failed reading zip archive - %w", err)
+	}
+	for _, entry := range reader.File {
+		if err := v.entry(entry.Name); err != nil {
+			return err
+		}
+		mode := entry.Mode()
+		switch {
+		case mode.IsDir():
+		case mode&os.ModeSymlink != 0:
+			target, err := readZipEntry(entry, maxLinkTarget)
+			if err != nil {
+				return err
+			}
+			if err := v.link(entry.Name, string(target)); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			rc, err := entry.Open()
+			if err != nil {
+				return fmt.Errorf("failed reading %s - %w", entry.Name, err)
+			}
+			err = v.file(entry.Name, rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%s is not a regular file, directory or symlink", entry.Name)
+		}
+	}
+	return nil
+}
+
+func (v *validator) tar(r io.Reader) error {
+	reader := tar.NewReader(r)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed reading tar archive - %w", err)
+		}
+		if err := v.entry(header.Name); err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir, tar.TypeXGlobalHeader:
+		case tar.TypeSymlink:
+			if err := v.link(header.Name, header.Linkname); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			// Hard link targets name another entry relative to the root of the archive
+			if err := checkPath(header.Linkname); err != nil {
+				return fmt.Errorf("hard link %s - %w", header.Name, err)
+			}
+			v.paths = append(v.paths, header.Linkname)
+		case tar.TypeReg, tar.TypeRegA:
+			if err := v.file(header.Name, reader); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%s is not a regular file, directory or link", header.Name)
+		}
+	}
+}
+
+// entry checks the name of every archive entry and counts it
+func (v *validator) entry(name string) error {
+	v.entries++
+	if v.entries > v.limits.MaxEntries {
+		return fmt.Errorf("archive has more than %d entries", v.limits.MaxEntries)
+	}
+	if err := checkPath(name); err != nil {
+		return err
+	}
+	v.paths = append(v.paths, name)
+	return nil
+}
+
+// link checks the target of a symlink on its own and records it to be resolved along with the other links
+func (v *validator) link(name string, target string) error {
+	if err := checkLink(name, target); err != nil {
+		return err
+	}
+	if v.links == nil {
+		v.links = map[string]string{}
+	}
+	v.links[path.Clean(strings.ReplaceAll(name, `\`, "/"))] = strings.ReplaceAll(target, `\`, "/")
+	return nil
+}
+
+// resolveLinks follows every symlink and entry name through the symlinks of the archive the way extracting it would.
+// Targets checked one at a time may each stay within the archive root and still escape it once chained, such as a
+// link a to . and a link b to a/.. which resolves to the parent of the root.
+func (v *validator) resolveLinks() error {
+	if len(v.links) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(v.links))
+	for name := range v.links {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		target := v.links[name]
+		if err := v.resolve(path.Dir(name) + "/" + target); err != nil {
+			return fmt.Errorf("symlink %s points to %s - %w", name, target, err)
+		}
+	}
+	for _, name := range v.paths {
+		if err := v.resolve(strings.ReplaceAll(name, `\`, "/")); err != nil {
+			return fmt.Errorf("%s - %w", name, err)
+		}
+	}
+	return nil
+}
+
+// resolve walks a path from the archive root without cleaning it first, so that .. applies to where a symlink
+// actually leads rather than to its name
+func (v *validator) resolve(name string) error {
+	v.hops = 0
+	_, err := v.walk(nil, strings.Split(name, "/"))
+	return err
+}
+
+func (v *validator) walk(resolved []string, components []string) ([]string, error) {
+	for _, component := range components {
+		switch component {
+		case "", ".":
+		case "..":
+			if len(resolved) == 0 {
+				return nil, errors.New("escapes the archive root through a symlink")
+			}
+			resolved = resolved[:len(resolved)-1]
+		default:
+			resolved = append(resolved, component)
+			target, ok := v.links[strings.Join(resolved, "/")]
+			if !ok {
+				continue
+			}
+			v.hops++
+			if v.hops > maxLinkHops {
+				return nil, errors.New("too many levels of symlinks")
+			}
+			var err error
+			if resolved, err = v.walk(resolved[:len(resolved)-1], strings.Split(target, "/")); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return resolved, nil
+}
+
+// file reads a regular file to its end, measuring what it actually extracts to rather than trusting the sizes
+// declared in the archive
+func (v *validator) file(name string, r io.Reader) error {
+	v.files++
+	if isTerraformFile(name) {
+		v.modules++
+	}
+	ratioLimit := v.archiveSize * v.limits.MaxCompressionRatio
+	if ratioLimit < ratioThreshold {
+		ratioLimit = ratioThreshold
+	}
+	budget := v.limits.MaxUncompressedSize
+	if ratioLimit < budget {
+		budget = ratioLimit
+	}
+	// Reading stops just past the budget so that an archive bomb is never fully inflated
+	n, err := io.Copy(io.Discard, io.LimitReader(r, budget-v.size+1))
+	v.size += n
+	if err != nil {
+		return fmt.Errorf("failed reading %s - %w", name, err)
+	}
+	if v.size > v.limits.MaxUncompressedSize {
+		return fmt.Errorf("archive extracts to more than the maximum of %d bytes", v.limits.MaxUncompressedSize)
+	}
+	if v.size > ratioLimit {
+		return fmt.Errorf("archive compression ratio exceeds the maximum of %d:1", v.limits.MaxCompressionRatio)
+	}
+	return nil
+}
+
+// checkPath rejects names that are absolute or that escape the directory the archive is extracted to
+func checkPath(name string) error {
+	normalized := strings.ReplaceAll(name, `\`, "/")
+	if normalized == "" {
+		return errors.New("archive contains an entry without a name")
+	}
+	if strings.HasPrefix(normalized, "/") || windowsDrive.MatchString(normalized) {
+		return fmt.Errorf("%s is an absolute path", name)
+	}
+	if escapes(path.Clean(normalized)) {
+		return fmt.Errorf("%s escapes the archive root", name)
+	}
+	return nil
+}
+
+// checkLink rejects symlinks whose target resolves outside the directory the archive is extracted to
+func checkLink(name string, target string) error {
+	normalized := strings.ReplaceAll(target, `\`, "/")
+	if strings.HasPrefix(normalized, "/") || windowsDrive.MatchString(normalized) {
+		return fmt.Errorf("symlink %s points to absolute path %s", name, target)
+	}
+	dir := path.Dir(path.Clean(strings.ReplaceAll(name, `\`, "/")))
+	if escapes(path.Join(dir, normalized)) {
+		return fmt.Errorf("symlink %s points to %s outside the archive root", name, target)
+	}
+	return nil
+}
+
+func escapes(cleaned string) bool {
+	return cleaned == ".." || strings.HasPrefix(cleaned, "../")
+}
+
+func isTerraformFile(name string) bool {
+	return strings.HasSuffix(name, ".tf") || strings.HasSuffix(name, ".tf.json")
+}
+
+func readZipEntry(entry *zip.File, limit int64) ([]byte, error) {
+	rc, err := entry.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed reading %s - %w", entry.Name, err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed reading %s - %w", entry.Name, err)
+	}
+	return data, nil
+}
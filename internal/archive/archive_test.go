@@ -0,0 +1,206 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"strings"
+	"testing"
+)
+
+// testEntry is an archive entry, a symlink when link is set and a directory when its name ends with a slash
+type testEntry struct {
+	name     string
+	content  string
+	link     string
+	hardLink bool
+}
+
+func file(name string) testEntry {
+	return testEntry{name: name, content: `variable "name" {}`}
+}
+
+func symlink(name string, target string) testEntry {
+	return testEntry{name: name, link: target}
+}
+
+func tarball(t *testing.T, entries ...testEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.content)), Typeflag: tar.TypeReg}
+		switch {
+		case entry.hardLink:
+			header.Typeflag, header.Linkname, header.Size = tar.TypeLink, entry.link, 0
+		case entry.link != "":
+			header.Typeflag, header.Linkname, header.Size = tar.TypeSymlink, entry.link, 0
+		case strings.HasSuffix(entry.name, "/"):
+			header.Typeflag, header.Mode = tar.TypeDir, 0755
+		}
+		if err := w.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(entry.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zipArchive(t *testing.T, entries ...testEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+		content := entry.content
+		switch {
+		case entry.link != "":
+			header.SetMode(os.ModeSymlink | 0777)
+			content = entry.link
+		case strings.HasSuffix(entry.name, "/"):
+			header.SetMode(os.ModeDir | 0755)
+		default:
+			header.SetMode(0644)
+		}
+		fw, err := w.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestValidatePaths(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []testEntry
+		wantErr string
+	}{
+		{"module", []testEntry{file("main.tf"), file("modules/vpc/main.tf")}, ""},
+		{"dot segments within the root", []testEntry{file("main.tf"), file("modules/../variables.tf")}, ""},
+		{"no terraform files", []testEntry{{name: "README.md", content: "# vpc"}}, "archive contains no .tf files"},
+		{"parent traversal", []testEntry{file("main.tf"), file("../evil.tf")}, "../evil.tf escapes the archive root"},
+		{"nested parent traversal", []testEntry{file("main.tf"), file("modules/../../evil.tf")}, "escapes the archive root"},
+		{"absolute path", []testEntry{file("/etc/main.tf")}, "/etc/main.tf is an absolute path"},
+		{"windows drive", []testEntry{file(`C:\main.tf`)}, "is an absolute path"},
+		{"backslash traversal", []testEntry{file("main.tf"), file(`modules\..\..\evil.tf`)}, "escapes the archive root"},
+	}
+	for _, tt := range tests {
+		for format, data := range map[string][]byte{"tar": tarball(t, tt.entries...), "zip": zipArchive(t, tt.entries...)} {
+			t.Run(tt.name+"/"+format, func(t *testing.T) {
+				assertValidation(t, Validate(data, DefaultLimits).Reason, tt.wantErr)
+			})
+		}
+	}
+}
+
+func TestValidateLinks(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []testEntry
+		wantErr string
+	}{
+		{"link to a sibling", []testEntry{file("main.tf"), symlink("current.tf", "main.tf")}, ""},
+		{"link to a parent within the root", []testEntry{file("main.tf"), symlink("modules/root", "..")}, ""},
+		{"link to the root", []testEntry{file("main.tf"), symlink("self", ".")}, ""},
+		{"chained links within the root", []testEntry{file("modules/vpc/main.tf"), symlink("a", "modules"), symlink("b", "a/vpc/..")}, ""},
+		{"entry through a link within the root", []testEntry{file("main.tf"), symlink("lib", "modules"), file("lib/vpc.tf")}, ""},
+
+		{"absolute target", []testEntry{file("main.tf"), symlink("passwd", "/etc/passwd")}, "points to absolute path /etc/passwd"},
+		{"windows drive target", []testEntry{file("main.tf"), symlink("hosts", `C:\Windows\hosts`)}, "points to absolute path"},
+		{"parent target", []testEntry{file("main.tf"), symlink("up", "..")}, "outside the archive root"},
+		{"nested parent target", []testEntry{file("main.tf"), symlink("modules/up", "../../etc")}, "outside the archive root"},
+		{"chained through a link to the root", []testEntry{file("main.tf"), symlink("a", "."), symlink("b", "a/..")}, "symlink b points to a/.. - escapes the archive root through a symlink"},
+		{"chained through a nested link", []testEntry{file("main.tf"), symlink("x/a", "."), symlink("x/b", "a/../..")}, "escapes the archive root through a symlink"},
+		{"chained in reverse order", []testEntry{file("main.tf"), symlink("b", "a/.."), symlink("a", ".")}, "escapes the archive root through a symlink"},
+		{"entry through a link", []testEntry{file("main.tf"), symlink("c/a", "."), file("c/a/../../evil.tf")}, "c/a/../../evil.tf - escapes the archive root through a symlink"},
+		{"link loop", []testEntry{file("main.tf"), symlink("a", "b"), symlink("b", "a")}, "too many levels of symlinks"},
+	}
+	for _, tt := range tests {
+		for format, data := range map[string][]byte{"tar": tarball(t, tt.entries...), "zip": zipArchive(t, tt.entries...)} {
+			t.Run(tt.name+"/"+format, func(t *testing.T) {
+				assertValidation(t, Validate(data, DefaultLimits).Reason, tt.wantErr)
+			})
+		}
+	}
+}
+
+func TestValidateHardLinks(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []testEntry
+		wantErr string
+	}{
+		{"link to an entry", []testEntry{file("main.tf"), {name: "copy.tf", link: "main.tf", hardLink: true}}, ""},
+		{"parent target", []testEntry{file("main.tf"), {name: "passwd", link: "../etc/passwd", hardLink: true}}, "hard link passwd - ../etc/passwd escapes the archive root"},
+		{"absolute target", []testEntry{file("main.tf"), {name: "passwd", link: "/etc/passwd", hardLink: true}}, "is an absolute path"},
+		{"target through a symlink", []testEntry{file("main.tf"), symlink("a", "."), {name: "passwd", link: "a/../etc/passwd", hardLink: true}}, "escapes the archive root through a symlink"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertValidation(t, Validate(tarball(t, tt.entries...), DefaultLimits).Reason, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateLimits(t *testing.T) {
+	bomb := testEntry{name: "main.tf", content: strings.Repeat("a", 4<<20)}
+	compress := func(data []byte) []byte {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	tests := []struct {
+		name    string
+		data    []byte
+		limits  Limits
+		wantErr string
+	}{
+		{"gzip tarball", compress(tarball(t, file("main.tf"))), DefaultLimits, ""},
+		{"unknown format", []byte("terraform"), DefaultLimits, "archive is not a zip file or tarball"},
+		{"oversize archive", tarball(t, file("main.tf")), Limits{MaxSize: 512, MaxUncompressedSize: 1 << 20, MaxCompressionRatio: 100, MaxEntries: 10}, "larger than the maximum of 512 bytes"},
+		{"too many entries", tarball(t, file("a.tf"), file("b.tf"), file("c.tf")), Limits{MaxSize: 1 << 20, MaxUncompressedSize: 1 << 20, MaxCompressionRatio: 100, MaxEntries: 2}, "archive has more than 2 entries"},
+		{"uncompressed size", zipArchive(t, bomb), Limits{MaxSize: 1 << 20, MaxUncompressedSize: 1 << 20, MaxCompressionRatio: 1 << 20, MaxEntries: 10}, "archive extracts to more than the maximum of 1048576 bytes"},
+		{"compression ratio", zipArchive(t, bomb), DefaultLimits, "compression ratio exceeds the maximum of 100:1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertValidation(t, Validate(tt.data, tt.limits).Reason, tt.wantErr)
+		})
+	}
+}
+
+func assertValidation(t *testing.T, reason string, wantErr string) {
+	t.Helper()
+	if wantErr == "" {
+		if reason != "" {
+			t.Fatalf("Validate() rejected the archive: %s", reason)
+		}
+		return
+	}
+	if reason == "" {
+		t.Fatalf("Validate() accepted the archive, want reason containing %q", wantErr)
+	}
+	if !strings.Contains(reason, wantErr) {
+		t.Fatalf("Validate() reason = %q, want it to contain %q", reason, wantErr)
+	}
+}
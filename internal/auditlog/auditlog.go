@@ -0,0 +1,179 @@
+// Package auditlog records the changes made through the Terrarium APIs to the audit trail kept by the database
+// driver, attributing each to the caller, client address and request it was made by.
+package auditlog
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/terrariumcloud/terrarium-lite/internal/auth"
+	"github.com/terrariumcloud/terrarium-lite/internal/logging"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/audit"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/modules"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/stores"
+)
+
+// Recorder writes audit events to an AuditStore. A nil Recorder or one without a store records nothing.
+type Recorder struct {
+	Store  stores.AuditStore
+	Logger logrus.FieldLogger
+}
+
+// Record writes an event for a change made by a request. The change has already been applied when it is recorded so
+// failures are logged as errors rather than failing the request. The event is written even when the client has gone
+// away in the meantime.
+func (r *Recorder) Record(req *http.Request, action audit.Action, ref modules.ModuleVersionRef, before *audit.Snapshot, after *audit.Snapshot) {
+	if r == nil || r.Store == nil {
+		return
+	}
+	event := newRequestEvent(req, action)
+	event.ModuleVersionRef = ref
+	event.Before = before
+	event.After = after
+	r.write(req.Context(), event)
+}
+
+// AuthFailures is middleware recording requests whose credentials failed validation in auth.Middleware. It runs
+// after rate limiting so that a client guessing credentials cannot flood the audit trail.
+func (r *Recorder) AuthFailures(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if err := auth.FailureFromContext(req.Context()); err != nil && r != nil && r.Store != nil {
+			event := newRequestEvent(req, audit.ActionAuthFailure)
+			event.Reason = err.Error()
+			r.write(req.Context(), event)
+		}
+		next.ServeHTTP(rw, req)
+	})
+}
+
+// RecordRoleChanges compares the role bindings the registry started with to those recorded by the last start and
+// records an event for each organization whose bindings changed, attributed to ConfigActor. Nil bindings grant no
+// roles.
+func (r *Recorder) RecordRoleChanges(ctx context.Context, bindings *auth.RoleBindings) {
+	if r == nil || r.Store == nil {
+		return
+	}
+	recorded, err := r.Store.ReadEvents(ctx, &audit.Filter{Action: audit.ActionRoles})
+	if err != nil {
+		logging.FromContext(ctx, r.Logger).WithError(err).Error("failed reading recorded role bindings")
+		return
+	}
+	previous := map[string]*audit.Snapshot{}
+	for _, event := range recorded {
+		previous[event.Organization] = event.After
+	}
+	current := map[string]*audit.Snapshot{}
+	if bindings != nil {
+		for orgName := range bindings.Organizations {
+			if grants := grantsOf(bindings, orgName); len(grants) > 0 {
+				current[orgName] = &audit.Snapshot{Grants: grants}
+			}
+		}
+	}
+	orgNames := make([]string, 0, len(previous)+len(current))
+	for orgName := range previous {
+		orgNames = append(orgNames, orgName)
+	}
+	for orgName := range current {
+		if _, ok := previous[orgName]; !ok {
+			orgNames = append(orgNames, orgName)
+		}
+	}
+	sort.Strings(orgNames)
+	for _, orgName := range orgNames {
+		before, after := previous[orgName], current[orgName]
+		if sameGrants(before, after) {
+			continue
+		}
+		r.write(ctx, &audit.Event{
+			ID:               newEventID(),
+			Timestamp:        time.Now().UTC(),
+			Action:           audit.ActionRoles,
+			Actor:            ConfigActor,
+			ModuleVersionRef: modules.ModuleVersionRef{Organization: orgName},
+			Before:           before,
+			After:            after,
+		})
+	}
+}
+
+// ConfigActor is the actor recorded for changes made by changing the configuration of the registry
+const ConfigActor string = "config"
+
+// grantsOf lists the roles bound on an organization, sorted
+func grantsOf(bindings *auth.RoleBindings, orgName string) []string {
+	var grants []string
+	for _, binding := range bindings.Organizations[orgName] {
+		for kind, patterns := range map[string][]string{"user": binding.Users, "team": binding.Teams, "token": binding.Tokens} {
+			for _, pattern := range patterns {
+				grants = append(grants, fmt.Sprintf("%s %s:%s", binding.Role, kind, pattern))
+			}
+		}
+	}
+	sort.Strings(grants)
+	return grants
+}
+
+func sameGrants(a *audit.Snapshot, b *audit.Snapshot) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if len(a.Grants) != len(b.Grants) {
+		return false
+	}
+	for i := range a.Grants {
+		if a.Grants[i] != b.Grants[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestEvent starts an event attributed to the caller, client address and ID of a request
+func newRequestEvent(req *http.Request, action audit.Action) *audit.Event {
+	return &audit.Event{
+		ID:        newEventID(),
+		Timestamp: time.Now().UTC(),
+		Action:    action,
+		Actor:     auth.Actor(req.Context()),
+		SourceIP:  SourceIP(req),
+		RequestID: logging.RequestID(req.Context()),
+	}
+}
+
+// write stores an event, logging failures as errors
+func (r *Recorder) write(ctx context.Context, event *audit.Event) {
+	if err := r.Store.RecordEvent(context.Background(), event); err != nil {
+		logging.FromContext(ctx, r.Logger).WithError(err).WithFields(logrus.Fields{
+			"action":       event.Action,
+			"organization": event.Organization,
+			"module":       event.Name,
+			"provider":     event.Provider,
+			"version":      event.Version,
+		}).Error("failed recording audit event")
+	}
+}
+
+// SourceIP returns the address of the client of a request. Behind a trusted proxy this is the forwarded address.
+func SourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func newEventID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(id)
+}
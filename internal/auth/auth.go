@@ -0,0 +1,124 @@
+// Package auth provides authentication and authorization primitives for the Terrarium APIs. Authenticators resolve
+// the credentials presented on a request into an Identity which is then made available to handlers through the
+// request context. Authorizers decide whether an identity may perform an action against an organization.
+package auth
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/responses"
+)
+
+// Permission is an action that can be granted to an identity on an organization
+type Permission string
+
+const (
+	// PermissionRead allows listing and downloading modules belonging to an organization
+	PermissionRead Permission = "read"
+	// PermissionPublish allows publishing new module versions to an organization
+	PermissionPublish Permission = "publish"
+	// PermissionAdmin allows destructive and administrative operations such as deleting modules
+	PermissionAdmin Permission = "admin"
+)
+
+// IdentityType distinguishes the kinds of principal roles can be bound to
+type IdentityType string
+
+const (
+	// IdentityUser is a person, typically authenticated interactively or through a client certificate
+	IdentityUser IdentityType = "user"
+	// IdentityToken is a workload authenticated by a token such as a CI issued OIDC token
+	IdentityToken IdentityType = "token"
+)
+
+// AnyOrganization can be used as an organization name in grants to apply permissions to every organization
+const AnyOrganization string = "*"
+
+// ErrUnauthenticated is returned when a request must carry credentials but none were presented
+var ErrUnauthenticated = responses.NewStatusError(http.StatusUnauthorized, "authentication required")
+
+// ErrInvalidCredentials is returned by an Authenticator when credentials were presented but could not be validated
+var ErrInvalidCredentials = responses.NewStatusError(http.StatusUnauthorized, "invalid credentials")
+
+// Identity represents the caller of a request once its credentials have been validated
+type Identity struct {
+	// Subject uniquely identifies the caller within the method used to authenticate it
+	Subject string
+	// Type is the kind of principal the identity represents
+	Type IdentityType
+	// Method is the name of the authenticator that produced this identity e.g. "oidc"
+	Method string
+	// Teams lists the teams the caller is a member of
+	Teams []string
+	// Claims holds any additional attributes asserted about the caller by the authenticator
+	Claims map[string]interface{}
+	// Grants maps organization names to the permissions the caller holds on them
+	Grants map[string][]Permission
+}
+
+// Grant adds the given permissions on an organization to the identity
+func (i *Identity) Grant(orgName string, permissions ...Permission) {
+	if i.Grants == nil {
+		i.Grants = make(map[string][]Permission)
+	}
+	i.Grants[orgName] = append(i.Grants[orgName], permissions...)
+}
+
+// Can reports whether the identity holds a permission on the given organization
+func (i *Identity) Can(orgName string, permission Permission) bool {
+	if i == nil {
+		return false
+	}
+	for _, name := range []string{orgName, AnyOrganization} {
+		for _, granted := range i.Grants[name] {
+			if granted == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Authenticator resolves credentials presented on a request into an Identity. Implementations must return a nil
+// identity and nil error when the request carries no credentials they understand so that other authenticators can
+// be tried, and ErrInvalidCredentials (optionally wrapped) when credentials they understand fail validation.
+type Authenticator interface {
+	Name() string
+	Authenticate(r *http.Request) (*Identity, error)
+}
+
+// Authorizer decides whether the identity attached to a context may perform an action on an organization.
+// A nil error means the action is permitted.
+type Authorizer interface {
+	Authorize(ctx context.Context, orgName string, permission Permission) error
+}
+
+type contextKey int
+
+const (
+	identityKey contextKey = iota
+	failureKey
+)
+
+// WithIdentity returns a copy of the context carrying the given identity
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey, identity)
+}
+
+// IdentityFromContext returns the identity attached to the context or nil for anonymous callers
+func IdentityFromContext(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(identityKey).(*Identity)
+	return identity
+}
+
+// Anonymous is the actor recorded for changes made by unauthenticated callers
+const Anonymous string = "anonymous"
+
+// Actor names the caller for the records kept of the changes it makes
+func Actor(ctx context.Context) string {
+	if identity := IdentityFromContext(ctx); identity != nil {
+		return identity.Subject
+	}
+	return Anonymous
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/responses"
+)
+
+// ErrForbidden is returned by an Authorizer when an authenticated identity lacks the required permission
+var ErrForbidden = responses.NewStatusError(http.StatusForbidden, "access denied")
+
+// ReadOnly is an Authorizer permitting anyone to read every organization and nobody to change them. It is used when no
+// authentication has been configured so that the registry behaves as an open, read only registry.
+type ReadOnly struct{}
+
+// Authorize permits reads and rejects every other action with ErrUnauthenticated
+func (a *ReadOnly) Authorize(_ context.Context, _ string, permission Permission) error {
+	if permission == PermissionRead {
+		return nil
+	}
+	return ErrUnauthenticated
+}
+
+// RoleAuthorizer is an Authorizer permitting an action when the identity attached to the request either holds the
+// permission directly through grants made by its authenticator, or is bound to a role including it. Anonymous
+// requests are rejected with ErrUnauthenticated.
+type RoleAuthorizer struct {
+	Bindings *RoleBindings
+}
+
+// Authorize permits the action when the identity holds the permission on the organization
+func (a *RoleAuthorizer) Authorize(ctx context.Context, orgName string, permission Permission) error {
+	identity := IdentityFromContext(ctx)
+	if identity == nil {
+		return ErrUnauthenticated
+	}
+	if identity.Can(orgName, permission) {
+		return nil
+	}
+	if a.Bindings != nil {
+		for _, role := range a.Bindings.Roles(identity, orgName) {
+			if role.Includes(permission) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w: %s %q does not have %s access to organization %q", ErrForbidden, identity.Type, identity.Subject, permission, orgName)
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRoleAuthorizer(t *testing.T) {
+	bindings := &RoleBindings{Organizations: map[string][]*RoleBinding{
+		"acme": {
+			{Role: RoleAdmin, Teams: []string{"platform"}},
+			{Role: RolePublisher, Users: []string{"alice"}},
+			{Role: RoleReader, Tokens: []string{"repo:acme/*"}},
+		},
+		AnyOrganization: {
+			{Role: RoleReader, Teams: []string{"everyone"}},
+		},
+	}}
+	authorizer := &RoleAuthorizer{Bindings: bindings}
+	user := func(subject string, teams ...string) *Identity {
+		return &Identity{Subject: subject, Type: IdentityUser, Teams: teams}
+	}
+	token := func(subject string) *Identity {
+		return &Identity{Subject: subject, Type: IdentityToken}
+	}
+	granted := &Identity{Subject: "ci", Type: IdentityToken}
+	granted.Grant("acme", PermissionPublish)
+
+	tests := []struct {
+		name       string
+		identity   *Identity
+		org        string
+		permission Permission
+		wantErr    error
+	}{
+		{"team admin deletes", user("bob", "platform"), "acme", PermissionAdmin, nil},
+		{"team admin reads", user("bob", "platform"), "acme", PermissionRead, nil},
+		{"publisher publishes", user("alice"), "acme", PermissionPublish, nil},
+		{"publisher reads", user("alice"), "acme", PermissionRead, nil},
+		{"token pattern reads", token("repo:acme/vpc"), "acme", PermissionRead, nil},
+		{"wildcard organization binding", user("carol", "everyone"), "globex", PermissionRead, nil},
+		{"direct grant", granted, "acme", PermissionPublish, nil},
+
+		{"anonymous", nil, "acme", PermissionRead, ErrUnauthenticated},
+		{"publisher administers", user("alice"), "acme", PermissionAdmin, ErrForbidden},
+		{"binding scoped to its organization", user("bob", "platform"), "globex", PermissionAdmin, ErrForbidden},
+		{"reader publishes", token("repo:acme/vpc"), "acme", PermissionPublish, ErrForbidden},
+		{"token pattern of another organization", token("repo:globex/vpc"), "acme", PermissionRead, ErrForbidden},
+		{"user binding does not match tokens", token("alice"), "acme", PermissionPublish, ErrForbidden},
+		{"token binding does not match users", user("repo:acme/vpc"), "acme", PermissionRead, ErrForbidden},
+		{"pattern does not cross slashes", token("repo:acme/vpc/fork"), "acme", PermissionRead, ErrForbidden},
+		{"wildcard binding grants only its role", user("carol", "everyone"), "globex", PermissionPublish, ErrForbidden},
+		{"direct grant is scoped to its organization", granted, "globex", PermissionPublish, ErrForbidden},
+		{"direct grant is scoped to its permission", granted, "acme", PermissionAdmin, ErrForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.identity != nil {
+				ctx = WithIdentity(ctx, tt.identity)
+			}
+			err := authorizer.Authorize(ctx, tt.org, tt.permission)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("Authorize() unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authorize() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	tests := []struct {
+		permission Permission
+		wantErr    error
+	}{
+		{PermissionRead, nil},
+		{PermissionPublish, ErrUnauthenticated},
+		{PermissionAdmin, ErrUnauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.permission), func(t *testing.T) {
+			if err := (&ReadOnly{}).Authorize(context.Background(), "acme", tt.permission); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authorize() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadRoleBindings(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		wantErr string
+	}{
+		{"valid", "organizations:\n  acme:\n    - role: admin\n      teams: [platform]\n", ""},
+		{"unknown role", "organizations:\n  acme:\n    - role: owner\n      teams: [platform]\n", `unknown role "owner"`},
+		{"malformed pattern", "organizations:\n  acme:\n    - role: reader\n      users: [\"[\"]\n", `pattern "["`},
+		{"unknown field", "organizations:\n  acme:\n    - role: reader\n      groups: [platform]\n", "failed parsing role bindings"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "rbac.yaml")
+			if err := os.WriteFile(name, []byte(tt.file), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadRoleBindings(name)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("LoadRoleBindings() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("LoadRoleBindings() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
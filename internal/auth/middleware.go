@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/terrariumcloud/terrarium-lite/internal/logging"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/responses"
+)
+
+// BearerToken returns the token presented in the Authorization header of a request or an empty string
+func BearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(header[7:])
+}
+
+// Middleware tries each authenticator in turn and attaches the first resolved identity to the request context.
+// Requests without credentials are passed through anonymously and left to the Authorizer of each route. Requests
+// presenting credentials that fail validation are passed through anonymously too, marked so that
+// RejectInvalidCredentials rejects them. Keeping the two apart lets middleware such as rate limiting run in between,
+// so that clients guessing credentials are limited like any other anonymous client.
+func Middleware(authenticators []Authenticator) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			for _, authenticator := range authenticators {
+				identity, err := authenticator.Authenticate(r)
+				if err != nil {
+					logging.FromContext(r.Context(), nil).WithError(err).WithField("method", authenticator.Name()).Warn("authentication failed")
+					r = r.WithContext(context.WithValue(r.Context(), failureKey, err))
+					break
+				}
+				if identity != nil {
+					r = r.WithContext(WithIdentity(r.Context(), identity))
+					break
+				}
+			}
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// FailureFromContext returns why the credentials presented with a request failed validation, or nil when they did not
+func FailureFromContext(ctx context.Context) error {
+	err, _ := ctx.Value(failureKey).(error)
+	return err
+}
+
+// RejectInvalidCredentials rejects requests whose credentials failed validation in Middleware with a 401. Rejections
+// are written by the error writer selected for the request.
+func RejectInvalidCredentials(errorHandlers responses.ErrorWriterSelector) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if err := FailureFromContext(r.Context()); err != nil {
+				rw.Header().Set("WWW-Authenticate", "Bearer")
+				errorHandlers(r).Write(rw, ErrInvalidCredentials, http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// RequirePermission wraps a handler so that it is only called when the authorizer permits the given permission
+// on the organization named by the organization_name route variable
+func RequirePermission(authorizer Authorizer, permission Permission, errorHandler responses.APIErrorWriter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		orgName := mux.Vars(r)["organization_name"]
+		if err := authorizer.Authorize(r.Context(), orgName, permission); err != nil {
+			WriteAuthorizationError(rw, err, errorHandler)
+			return
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// WriteAuthorizationError writes the response matching an error returned from an Authorizer
+func WriteAuthorizationError(rw http.ResponseWriter, err error, errorHandler responses.APIErrorWriter) {
+	if errors.Is(err, ErrUnauthenticated) {
+		rw.Header().Set("WWW-Authenticate", "Bearer")
+		errorHandler.Write(rw, err, http.StatusUnauthorized)
+		return
+	}
+	errorHandler.Write(rw, err, http.StatusForbidden)
+}
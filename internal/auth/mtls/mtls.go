@@ -0,0 +1,255 @@
+// Package mtls implements mutual TLS client authentication for Terrarium. Client certificates must chain to a
+// configured CA bundle and must not be revoked by any of the configured CRLs, which are reloaded periodically.
+// The certificate subject or a SAN is mapped to an identity used for authorization.
+package mtls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/terrariumcloud/terrarium-lite/internal/auth"
+)
+
+// IdentitySource selects which certificate attribute becomes the subject of the identity
+type IdentitySource string
+
+const (
+	// IdentityFromSubject uses the common name of the certificate subject
+	IdentityFromSubject IdentitySource = "subject"
+	// IdentityFromSAN uses the first URI, email or DNS subject alternative name of the certificate
+	IdentityFromSAN IdentitySource = "san"
+)
+
+// Config holds the settings required to authenticate clients by certificate
+type Config struct {
+	// CAFile is a PEM bundle of the certificate authorities trusted to sign client certificates
+	CAFile string
+	// CRLFiles are paths to PEM or DER encoded certificate revocation lists issued by the trusted authorities
+	CRLFiles []string
+	// CRLReloadInterval is how often revocation lists are reloaded from disk
+	CRLReloadInterval time.Duration
+	// IdentitySource selects the certificate attribute mapped to the identity subject
+	IdentitySource IdentitySource
+}
+
+// ClientVerifier verifies client certificates presented during the TLS handshake and maps them to identities
+type ClientVerifier struct {
+	cfg     *Config
+	pool    *x509.CertPool
+	cas     []*x509.Certificate
+	mu      sync.RWMutex
+	revoked map[string]map[string]struct{}
+	stop    chan struct{}
+	once    sync.Once
+	logger  logrus.FieldLogger
+}
+
+// New loads the CA bundle and revocation lists and starts periodic revocation list reloads
+func New(cfg *Config, logger logrus.FieldLogger) (*ClientVerifier, error) {
+	if cfg.CAFile == "" {
+		return nil, errors.New("no client CA file specified")
+	}
+	switch cfg.IdentitySource {
+	case "":
+		cfg.IdentitySource = IdentityFromSubject
+	case IdentityFromSubject, IdentityFromSAN:
+	default:
+		return nil, fmt.Errorf("unknown client identity source %q", cfg.IdentitySource)
+	}
+	cas, err := loadCertificates(cfg.CAFile)
+	if err != nil {
+		return nil, err
+	}
+	v := &ClientVerifier{
+		cfg:    cfg,
+		pool:   x509.NewCertPool(),
+		cas:    cas,
+		stop:   make(chan struct{}),
+		logger: logger,
+	}
+	for _, ca := range cas {
+		v.pool.AddCert(ca)
+	}
+	if err := v.reloadCRLs(); err != nil {
+		return nil, err
+	}
+	if len(cfg.CRLFiles) > 0 && cfg.CRLReloadInterval > 0 {
+		go v.watch()
+	}
+	return v, nil
+}
+
+// ConfigureTLS requires clients to present a certificate signed by the trusted authorities and not revoked
+func (v *ClientVerifier) ConfigureTLS(tlsConfig *tls.Config) {
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	tlsConfig.ClientCAs = v.pool
+	tlsConfig.VerifyPeerCertificate = v.verifyPeerCertificate
+}
+
+// Close stops reloading revocation lists
+func (v *ClientVerifier) Close() error {
+	v.once.Do(func() { close(v.stop) })
+	return nil
+}
+
+// Name returns the name of the authentication method
+func (v *ClientVerifier) Name() string {
+	return "mtls"
+}
+
+// Authenticate maps the verified client certificate of the connection to an identity. Organizational units of
+// the certificate subject are mapped to teams.
+func (v *ClientVerifier) Authenticate(r *http.Request) (*auth.Identity, error) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil, nil
+	}
+	cert := r.TLS.PeerCertificates[0]
+	subject := v.subject(cert)
+	if subject == "" {
+		return nil, fmt.Errorf("%w: client certificate has no %s identity", auth.ErrInvalidCredentials, v.cfg.IdentitySource)
+	}
+	return &auth.Identity{
+		Subject: subject,
+		Type:    auth.IdentityUser,
+		Method:  v.Name(),
+		Teams:   cert.Subject.OrganizationalUnit,
+		Claims: map[string]interface{}{
+			"subject": cert.Subject.String(),
+			"serial":  cert.SerialNumber.String(),
+		},
+	}, nil
+}
+
+func (v *ClientVerifier) subject(cert *x509.Certificate) string {
+	if v.cfg.IdentitySource == IdentityFromSAN {
+		switch {
+		case len(cert.URIs) > 0:
+			return cert.URIs[0].String()
+		case len(cert.EmailAddresses) > 0:
+			return cert.EmailAddresses[0]
+		case len(cert.DNSNames) > 0:
+			return cert.DNSNames[0]
+		}
+		return ""
+	}
+	return cert.Subject.CommonName
+}
+
+// verifyPeerCertificate runs after the standard chain verification and rejects revoked certificates
+func (v *ClientVerifier) verifyPeerCertificate(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	for _, chain := range verifiedChains {
+		for _, cert := range chain {
+			if v.isRevoked(cert) {
+				return fmt.Errorf("certificate %s serial %s has been revoked", cert.Subject.String(), cert.SerialNumber.String())
+			}
+		}
+	}
+	return nil
+}
+
+func (v *ClientVerifier) isRevoked(cert *x509.Certificate) bool {
+	serials, ok := v.revoked[string(cert.RawIssuer)]
+	if !ok {
+		return false
+	}
+	_, revoked := serials[cert.SerialNumber.String()]
+	return revoked
+}
+
+func (v *ClientVerifier) watch() {
+	ticker := time.NewTicker(v.cfg.CRLReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := v.reloadCRLs(); err != nil {
+				// Keep serving with the previously loaded lists rather than failing open or closed on a bad reload
+				v.logger.WithError(err).Error("failed reloading revocation lists, keeping previous lists")
+			}
+		case <-v.stop:
+			return
+		}
+	}
+}
+
+func (v *ClientVerifier) reloadCRLs() error {
+	revoked := make(map[string]map[string]struct{})
+	for _, crlFile := range v.cfg.CRLFiles {
+		crl, issuer, err := v.loadCRL(crlFile)
+		if err != nil {
+			return err
+		}
+		if crl.NextUpdate.Before(time.Now()) {
+			v.logger.WithField("crl_file", crlFile).Warn("revocation list is past its next update time")
+		}
+		key := string(issuer.RawSubject)
+		if revoked[key] == nil {
+			revoked[key] = make(map[string]struct{})
+		}
+		for _, entry := range crl.RevokedCertificateEntries {
+			revoked[key][entry.SerialNumber.String()] = struct{}{}
+		}
+	}
+	v.mu.Lock()
+	v.revoked = revoked
+	v.mu.Unlock()
+	return nil
+}
+
+// loadCRL parses a PEM or DER encoded revocation list and returns it with the trusted authority that signed it
+func (v *ClientVerifier) loadCRL(crlFile string) (*x509.RevocationList, *x509.Certificate, error) {
+	data, err := os.ReadFile(crlFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	if block, _ := pem.Decode(data); block != nil && block.Type == "X509 CRL" {
+		data = block.Bytes
+	}
+	crl, err := x509.ParseRevocationList(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed parsing revocation list %s - %w", crlFile, err)
+	}
+	for _, ca := range v.cas {
+		if crl.CheckSignatureFrom(ca) == nil {
+			return crl, ca, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("revocation list %s is not signed by a trusted client CA", crlFile)
+}
+
+func loadCertificates(certFile string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing certificate in %s - %w", certFile, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates found in %s", certFile)
+	}
+	return certs, nil
+}
@@ -0,0 +1,244 @@
+package mtls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type testAuthority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestAuthority(t *testing.T, name string) *testAuthority {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testAuthority{cert: cert, key: key}
+}
+
+// issue signs a client certificate with the given serial number
+func (a *testAuthority) issue(t *testing.T, serial int64, template *x509.Certificate) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(serial)
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	der, err := x509.CreateCertificate(rand.Reader, template, a.cert, &key.PublicKey, a.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// revoke returns a DER encoded revocation list of the authority revoking the given serial numbers
+func (a *testAuthority) revoke(t *testing.T, serials ...int64) []byte {
+	t.Helper()
+	entries := make([]x509.RevocationListEntry, 0, len(serials))
+	for _, serial := range serials {
+		entries = append(entries, x509.RevocationListEntry{SerialNumber: big.NewInt(serial), RevocationTime: time.Now()})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(time.Now().UnixNano()),
+		ThisUpdate:                time.Now(),
+		NextUpdate:                time.Now().Add(time.Hour),
+		RevokedCertificateEntries: entries,
+	}, a.cert, a.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func writeFile(t *testing.T, dir string, name string, data []byte) string {
+	t.Helper()
+	name = filepath.Join(dir, name)
+	if err := os.WriteFile(name, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func pemEncode(blockType string, der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+}
+
+func TestRevocation(t *testing.T) {
+	dir := t.TempDir()
+	ca, other := newTestAuthority(t, "Terrarium Clients"), newTestAuthority(t, "Other")
+	caFile := writeFile(t, dir, "ca.crt", pemEncode("CERTIFICATE", ca.cert.Raw))
+	alice := ca.issue(t, 2, &x509.Certificate{Subject: pkix.Name{CommonName: "alice"}})
+	bob := ca.issue(t, 3, &x509.Certificate{Subject: pkix.Name{CommonName: "bob"}})
+	// Serial numbers are only unique per issuer, revoking bob must not revoke the same serial of another authority
+	stranger := other.issue(t, 3, &x509.Certificate{Subject: pkix.Name{CommonName: "stranger"}})
+
+	tests := []struct {
+		name        string
+		crls        map[string][]byte
+		wantErr     string
+		wantRevoked []*x509.Certificate
+	}{
+		{"no revocation lists", nil, "", nil},
+		{"PEM revocation list", map[string][]byte{"crl.pem": pemEncode("X509 CRL", ca.revoke(t, 3))}, "", []*x509.Certificate{bob}},
+		{"DER revocation list", map[string][]byte{"crl.der": ca.revoke(t, 3)}, "", []*x509.Certificate{bob}},
+		{"several revoked serials", map[string][]byte{"crl.der": ca.revoke(t, 2, 3)}, "", []*x509.Certificate{alice, bob}},
+		{"empty revocation list", map[string][]byte{"crl.der": ca.revoke(t)}, "", nil},
+
+		{"signed by another authority", map[string][]byte{"crl.der": other.revoke(t, 2)}, "is not signed by a trusted client CA", nil},
+		{"malformed revocation list", map[string][]byte{"crl.pem": pemEncode("X509 CRL", []byte("not a crl"))}, "failed parsing revocation list", nil},
+		{"missing revocation list", map[string][]byte{"missing.der": nil}, "no such file", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var crlFiles []string
+			for name, data := range tt.crls {
+				if data == nil {
+					crlFiles = append(crlFiles, filepath.Join(dir, name))
+					continue
+				}
+				crlFiles = append(crlFiles, writeFile(t, t.TempDir(), name, data))
+			}
+			v, err := New(&Config{CAFile: caFile, CRLFiles: crlFiles}, logrus.New())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("New() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("New() unexpected error: %v", err)
+			}
+			defer v.Close()
+			for _, cert := range []*x509.Certificate{alice, bob} {
+				revoked := false
+				for _, want := range tt.wantRevoked {
+					revoked = revoked || want == cert
+				}
+				err := v.verifyPeerCertificate(nil, [][]*x509.Certificate{{cert, ca.cert}})
+				if revoked && err == nil {
+					t.Fatalf("verifyPeerCertificate() accepted revoked certificate %s", cert.Subject.CommonName)
+				}
+				if !revoked && err != nil {
+					t.Fatalf("verifyPeerCertificate() rejected %s: %v", cert.Subject.CommonName, err)
+				}
+			}
+			if v.isRevoked(stranger) {
+				t.Fatalf("isRevoked() revoked a certificate of another authority with a revoked serial number")
+			}
+		})
+	}
+}
+
+func TestRevocationReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestAuthority(t, "Terrarium Clients")
+	caFile := writeFile(t, dir, "ca.crt", pemEncode("CERTIFICATE", ca.cert.Raw))
+	alice := ca.issue(t, 2, &x509.Certificate{Subject: pkix.Name{CommonName: "alice"}})
+	crlFile := writeFile(t, dir, "crl.der", ca.revoke(t))
+	v, err := New(&Config{CAFile: caFile, CRLFiles: []string{crlFile}}, logrus.New())
+	if err != nil {
+		t.Fatalf("New() unexpected error: %v", err)
+	}
+	defer v.Close()
+	chains := [][]*x509.Certificate{{alice, ca.cert}}
+
+	steps := []struct {
+		name        string
+		crl         []byte
+		wantErr     bool
+		wantRevoked bool
+	}{
+		{"revoked", ca.revoke(t, 2), false, true},
+		{"bad reload keeps the previous list", []byte("garbage"), true, true},
+		{"revocation lifted", ca.revoke(t), false, false},
+	}
+	for _, step := range steps {
+		writeFile(t, dir, "crl.der", step.crl)
+		if err := v.reloadCRLs(); (err != nil) != step.wantErr {
+			t.Fatalf("%s: reloadCRLs() error = %v, want error %t", step.name, err, step.wantErr)
+		}
+		if revoked := v.verifyPeerCertificate(nil, chains) != nil; revoked != step.wantRevoked {
+			t.Fatalf("%s: certificate revoked = %t, want %t", step.name, revoked, step.wantRevoked)
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	ca := newTestAuthority(t, "Terrarium Clients")
+	spiffe, _ := url.Parse("spiffe://acme/ci")
+	tests := []struct {
+		name        string
+		source      IdentitySource
+		cert        *x509.Certificate
+		wantSubject string
+		wantErr     string
+	}{
+		{"common name", IdentityFromSubject, ca.issue(t, 2, &x509.Certificate{Subject: pkix.Name{CommonName: "alice", OrganizationalUnit: []string{"platform"}}}), "alice", ""},
+		{"URI SAN first", IdentityFromSAN, ca.issue(t, 3, &x509.Certificate{URIs: []*url.URL{spiffe}, EmailAddresses: []string{"ci@acme.io"}}), "spiffe://acme/ci", ""},
+		{"email SAN", IdentityFromSAN, ca.issue(t, 4, &x509.Certificate{EmailAddresses: []string{"alice@acme.io"}, DNSNames: []string{"alice.acme.io"}}), "alice@acme.io", ""},
+		{"DNS SAN", IdentityFromSAN, ca.issue(t, 5, &x509.Certificate{DNSNames: []string{"ci.acme.io"}}), "ci.acme.io", ""},
+		{"no common name", IdentityFromSubject, ca.issue(t, 6, &x509.Certificate{DNSNames: []string{"ci.acme.io"}}), "", "client certificate has no subject identity"},
+		{"no SAN", IdentityFromSAN, ca.issue(t, 7, &x509.Certificate{Subject: pkix.Name{CommonName: "alice"}}), "", "client certificate has no san identity"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &ClientVerifier{cfg: &Config{IdentitySource: tt.source}}
+			r := &http.Request{TLS: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{tt.cert}}}
+			identity, err := v.Authenticate(r)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Authenticate() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate() unexpected error: %v", err)
+			}
+			if identity.Subject != tt.wantSubject {
+				t.Fatalf("Authenticate() subject = %q, want %q", identity.Subject, tt.wantSubject)
+			}
+		})
+	}
+}
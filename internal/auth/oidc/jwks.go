@@ -0,0 +1,254 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// minRefreshInterval bounds how often a remote key set is refetched when tokens reference unknown key IDs
+const minRefreshInterval = time.Minute
+
+// jsonWebKey is the subset of RFC 7517 key parameters required to verify RSA and EC signatures
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// SigningKey is a public key of the issuer. Algorithm restricts the key to a single signing algorithm when its JWK
+// names one.
+type SigningKey struct {
+	Public    crypto.PublicKey
+	Algorithm string
+}
+
+// KeySet resolves the public key used to sign a token by its key ID
+type KeySet interface {
+	Key(ctx context.Context, kid string) (*SigningKey, error)
+}
+
+// staticKeySet is a key set loaded once, typically from a file
+type staticKeySet struct {
+	keys map[string]*SigningKey
+}
+
+func (s *staticKeySet) Key(_ context.Context, kid string) (*SigningKey, error) {
+	return lookupKey(s.keys, kid)
+}
+
+// NewFileKeySet loads a JWKS document from disk. This is mostly useful for testing or air gapped installations
+// where the issuer keys are distributed out of band.
+func NewFileKeySet(path string) (KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := parseKeySet(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing JWKS file %s - %w", path, err)
+	}
+	return &staticKeySet{keys: keys}, nil
+}
+
+// remoteKeySet fetches a JWKS document over HTTP and refetches it when a token references an unknown key so
+// that issuer key rotation is picked up without a restart. Fetches run outside the lock so that lookups of known
+// keys never wait on the issuer, and lookups of unknown keys arriving during a fetch wait for that fetch.
+type remoteKeySet struct {
+	url         string
+	client      *http.Client
+	mu          sync.Mutex
+	keys        map[string]*SigningKey
+	lastFetched time.Time
+	fetching    *keyFetch
+}
+
+// keyFetch is a fetch of the key set in progress
+type keyFetch struct {
+	done chan struct{}
+	err  error
+}
+
+// NewRemoteKeySet creates a key set backed by the JWKS document served at the given URL
+func NewRemoteKeySet(url string, client *http.Client) KeySet {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &remoteKeySet{url: url, client: client}
+}
+
+func (s *remoteKeySet) Key(ctx context.Context, kid string) (*SigningKey, error) {
+	s.mu.Lock()
+	if key, err := lookupKey(s.keys, kid); err == nil {
+		s.mu.Unlock()
+		return key, nil
+	}
+	f := s.fetching
+	if f == nil {
+		if time.Since(s.lastFetched) < minRefreshInterval {
+			s.mu.Unlock()
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		f = &keyFetch{done: make(chan struct{})}
+		s.fetching = f
+		s.lastFetched = time.Now()
+		go s.refresh(f)
+	}
+	s.mu.Unlock()
+	select {
+	case <-f.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return lookupKey(s.keys, kid)
+}
+
+// refresh fetches the key set and replaces the known keys with it. The fetch is not tied to the request which
+// started it so that its client going away does not fail the requests waiting on it, the client timeout bounds it.
+func (s *remoteKeySet) refresh(f *keyFetch) {
+	keys, err := s.fetch(context.Background())
+	s.mu.Lock()
+	if err == nil {
+		s.keys = keys
+	}
+	s.fetching = nil
+	s.mu.Unlock()
+	f.err = err
+	close(f.done)
+}
+
+func (s *remoteKeySet) fetch(ctx context.Context) (map[string]*SigningKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed fetching JWKS from %s - %w", s.url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed fetching JWKS from %s - unexpected status %d", s.url, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	return parseKeySet(data)
+}
+
+func lookupKey(keys map[string]*SigningKey, kid string) (*SigningKey, error) {
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	// Tokens without a key ID can only be matched when the issuer publishes a single key
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func parseKeySet(data []byte) (map[string]*SigningKey, error) {
+	var set jsonWebKeySet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*SigningKey)
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q - %w", jwk.Kid, err)
+		}
+		if jwk.Alg != "" {
+			if err := checkKeyAlgorithm(jwk.Alg, key); err != nil {
+				return nil, fmt.Errorf("key %q - %w", jwk.Kid, err)
+			}
+		}
+		keys[jwk.Kid] = &SigningKey{Public: key, Algorithm: jwk.Alg}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no signing keys found")
+	}
+	return keys, nil
+}
+
+func (k *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,190 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func rsaJWK(t *testing.T, kid string, alg string, key *rsa.PublicKey) jsonWebKey {
+	t.Helper()
+	return jsonWebKey{
+		Kty: "RSA",
+		Kid: kid,
+		Alg: alg,
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ecJWK(t *testing.T, kid string, alg string, key *ecdsa.PublicKey) jsonWebKey {
+	t.Helper()
+	size := (key.Curve.Params().BitSize + 7) / 8
+	x, y := make([]byte, size), make([]byte, size)
+	key.X.FillBytes(x)
+	key.Y.FillBytes(y)
+	return jsonWebKey{
+		Kty: "EC",
+		Kid: kid,
+		Alg: alg,
+		Crv: key.Curve.Params().Name,
+		X:   base64.RawURLEncoding.EncodeToString(x),
+		Y:   base64.RawURLEncoding.EncodeToString(y),
+	}
+}
+
+func TestParseKeySet(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		keys    []jsonWebKey
+		wantErr string
+	}{
+		{"RSA key without algorithm", []jsonWebKey{rsaJWK(t, "a", "", &rsaKey.PublicKey)}, ""},
+		{"RSA key restricted to RS256", []jsonWebKey{rsaJWK(t, "a", "RS256", &rsaKey.PublicKey)}, ""},
+		{"EC key restricted to ES256", []jsonWebKey{ecJWK(t, "a", "ES256", &p256.PublicKey)}, ""},
+		{"RSA key declaring an EC algorithm", []jsonWebKey{rsaJWK(t, "a", "ES256", &rsaKey.PublicKey)}, "does not match algorithm ES256"},
+		{"EC key declaring an RSA algorithm", []jsonWebKey{ecJWK(t, "a", "RS256", &p256.PublicKey)}, "does not match algorithm RS256"},
+		{"P-256 key declaring ES384", []jsonWebKey{ecJWK(t, "a", "ES384", &p256.PublicKey)}, "does not match algorithm ES384"},
+		{"key declaring an unsupported algorithm", []jsonWebKey{rsaJWK(t, "a", "HS256", &rsaKey.PublicKey)}, "unsupported signing algorithm"},
+		{"encryption keys only", []jsonWebKey{func() jsonWebKey {
+			jwk := rsaJWK(t, "a", "", &rsaKey.PublicKey)
+			jwk.Use = "enc"
+			return jwk
+		}()}, "no signing keys found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(&jsonWebKeySet{Keys: tt.keys})
+			if err != nil {
+				t.Fatal(err)
+			}
+			keys, err := parseKeySet(data)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("parseKeySet() unexpected error: %v", err)
+				}
+				if key := keys[tt.keys[0].Kid]; key == nil || key.Algorithm != tt.keys[0].Alg {
+					t.Fatalf("parseKeySet() key = %+v, want algorithm %q", key, tt.keys[0].Alg)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("parseKeySet() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRemoteKeySet(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := json.Marshal(&jsonWebKeySet{Keys: []jsonWebKey{rsaJWK(t, "a", "", &rsaKey.PublicKey)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := json.Marshal(&jsonWebKeySet{Keys: []jsonWebKey{
+		rsaJWK(t, "a", "", &rsaKey.PublicKey),
+		rsaJWK(t, "b", "", &rsaKey.PublicKey),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var requests int32
+	fetching := make(chan struct{}, 10)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			rw.Write(first)
+			return
+		}
+		fetching <- struct{}{}
+		<-release
+		rw.Write(rotated)
+	}))
+	defer server.Close()
+	keys := NewRemoteKeySet(server.URL, nil).(*remoteKeySet)
+	ctx := context.Background()
+
+	if _, err := keys.Key(ctx, "a"); err != nil {
+		t.Fatalf("Key(a) unexpected error: %v", err)
+	}
+	if _, err := keys.Key(ctx, "b"); err == nil || !strings.Contains(err.Error(), "unknown signing key") {
+		t.Fatalf("Key(b) within the refetch interval error = %v, want unknown signing key", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Fatalf("key set fetched %d times within the refetch interval, want 1", n)
+	}
+
+	// Once the refetch interval passed, lookups of the rotated key share a single fetch
+	keys.mu.Lock()
+	keys.lastFetched = time.Now().Add(-2 * minRefreshInterval)
+	keys.mu.Unlock()
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := keys.Key(ctx, "b")
+			errs <- err
+		}()
+	}
+	<-fetching
+
+	// Known keys are served while the issuer is slow to answer
+	done := make(chan error, 1)
+	go func() {
+		_, err := keys.Key(ctx, "a")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Key(a) during a fetch unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Key(a) blocked on a fetch in progress")
+	}
+
+	// A waiter giving up does not wait for the fetch
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := keys.Key(cancelled, "b"); err != context.Canceled {
+		t.Fatalf("Key(b) with a cancelled context error = %v, want %v", err, context.Canceled)
+	}
+
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Key(b) after rotation unexpected error: %v", err)
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Fatalf("key set fetched %d times, want 2", n)
+	}
+}
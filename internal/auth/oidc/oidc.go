@@ -0,0 +1,138 @@
+// Package oidc implements an auth.Authenticator accepting OIDC identity tokens issued to CI workloads as bearer
+// tokens. Tokens are validated against the JWKS of a single trusted issuer and their claims are mapped to
+// organization permissions through a Policy. This allows pipelines to publish modules without long lived secrets.
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/terrariumcloud/terrarium-lite/internal/auth"
+)
+
+// Config holds the settings required to validate tokens from an OIDC issuer
+type Config struct {
+	// Issuer is the expected iss claim and the base URL used for discovery when no JWKS source is given
+	Issuer string
+	// Audience is the expected aud claim. CI systems usually allow this to be set per job.
+	Audience string
+	// JWKSURL is the location of the issuer key set. Takes precedence over discovery.
+	JWKSURL string
+	// JWKSFile is a path to a key set on disk. Takes precedence over JWKSURL.
+	JWKSFile string
+	// PolicyFile is a path to the YAML policy mapping claims to permissions
+	PolicyFile string
+	// TeamsClaim optionally names a claim listing the teams of the token subject for role bindings
+	TeamsClaim string
+}
+
+// Authenticator validates bearer tokens issued by a trusted OIDC issuer
+type Authenticator struct {
+	verifier   *verifier
+	policy     *Policy
+	teamsClaim string
+}
+
+// New creates an OIDC authenticator from the given configuration. When neither a JWKS file nor URL is configured
+// the key set location is discovered from the issuer's openid-configuration document.
+func New(ctx context.Context, cfg *Config) (*Authenticator, error) {
+	if cfg.Issuer == "" {
+		return nil, errors.New("no OIDC issuer specified")
+	}
+	if cfg.Audience == "" {
+		return nil, errors.New("no OIDC audience specified")
+	}
+	if cfg.PolicyFile == "" {
+		return nil, errors.New("no OIDC policy file specified")
+	}
+	policy, err := LoadPolicy(cfg.PolicyFile)
+	if err != nil {
+		return nil, err
+	}
+	var keys KeySet
+	switch {
+	case cfg.JWKSFile != "":
+		keys, err = NewFileKeySet(cfg.JWKSFile)
+	case cfg.JWKSURL != "":
+		keys = NewRemoteKeySet(cfg.JWKSURL, nil)
+	default:
+		var jwksURL string
+		jwksURL, err = discoverKeySetURL(ctx, cfg.Issuer)
+		keys = NewRemoteKeySet(jwksURL, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Authenticator{
+		verifier: &verifier{
+			issuer:   cfg.Issuer,
+			audience: cfg.Audience,
+			keys:     keys,
+			now:      time.Now,
+		},
+		policy:     policy,
+		teamsClaim: cfg.TeamsClaim,
+	}, nil
+}
+
+// Name returns the name of the authentication method
+func (a *Authenticator) Name() string {
+	return "oidc"
+}
+
+// Authenticate validates a bearer token on the request. Tokens that are not JWTs are ignored so that other
+// authenticators can handle them.
+func (a *Authenticator) Authenticate(r *http.Request) (*auth.Identity, error) {
+	token := auth.BearerToken(r)
+	if token == "" || strings.Count(token, ".") != 2 {
+		return nil, nil
+	}
+	claims, err := a.verifier.verify(r.Context(), token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", auth.ErrInvalidCredentials, err.Error())
+	}
+	identity := &auth.Identity{
+		Subject: claims.String("sub"),
+		Type:    auth.IdentityToken,
+		Method:  a.Name(),
+		Claims:  claims,
+	}
+	if a.teamsClaim != "" {
+		identity.Teams = claims.strings(a.teamsClaim)
+	}
+	a.policy.Apply(claims, identity)
+	return identity, nil
+}
+
+func discoverKeySetURL(ctx context.Context, issuer string) (string, error) {
+	discoveryURL := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return "", err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed OIDC discovery for %s - %w", issuer, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed OIDC discovery for %s - unexpected status %d", issuer, resp.StatusCode)
+	}
+	var document struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&document); err != nil {
+		return "", fmt.Errorf("failed OIDC discovery for %s - %w", issuer, err)
+	}
+	if document.JWKSURI == "" {
+		return "", fmt.Errorf("failed OIDC discovery for %s - no jwks_uri advertised", issuer)
+	}
+	return document.JWKSURI, nil
+}
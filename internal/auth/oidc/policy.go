@@ -0,0 +1,119 @@
+package oidc
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/terrariumcloud/terrarium-lite/internal/auth"
+	"gopkg.in/yaml.v2"
+)
+
+// Policy maps the claims of validated tokens to permissions on organizations. A token is granted the union of the
+// permissions of every rule it matches. Tokens matching no rule are authenticated but hold no permissions.
+//
+// An example policy granting a release pipeline publish rights on the acme organization:
+//
+//	rules:
+//	  - description: acme release pipelines
+//	    claims:
+//	      repository: acme/terraform-*
+//	      ref: refs/heads/main
+//	    organizations: [acme]
+//	    permissions: [read, publish]
+type Policy struct {
+	Rules []*PolicyRule `yaml:"rules"`
+}
+
+// PolicyRule grants permissions on organizations to tokens whose claims match every pattern in Claims. Patterns
+// use path.Match syntax. Array claims match when any of their elements matches.
+type PolicyRule struct {
+	Description   string            `yaml:"description"`
+	Claims        map[string]string `yaml:"claims"`
+	Organizations []string          `yaml:"organizations"`
+	Permissions   []auth.Permission `yaml:"permissions"`
+}
+
+// LoadPolicy reads and validates a YAML policy file
+func LoadPolicy(policyPath string) (*Policy, error) {
+	data, err := os.ReadFile(policyPath)
+	if err != nil {
+		return nil, err
+	}
+	policy := &Policy{}
+	if err := yaml.UnmarshalStrict(data, policy); err != nil {
+		return nil, fmt.Errorf("failed parsing OIDC policy %s - %w", policyPath, err)
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid OIDC policy %s - %w", policyPath, err)
+	}
+	return policy, nil
+}
+
+// Validate checks every rule for unknown permissions and malformed patterns
+func (p *Policy) Validate() error {
+	for i, rule := range p.Rules {
+		if len(rule.Claims) == 0 {
+			return fmt.Errorf("rule %d must match at least one claim", i)
+		}
+		if len(rule.Organizations) == 0 {
+			return fmt.Errorf("rule %d must name at least one organization", i)
+		}
+		for claim, pattern := range rule.Claims {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("rule %d claim %s - %w", i, claim, err)
+			}
+		}
+		for _, permission := range rule.Permissions {
+			if permission != auth.PermissionRead && permission != auth.PermissionPublish {
+				return fmt.Errorf("rule %d has unknown permission %q", i, permission)
+			}
+		}
+	}
+	return nil
+}
+
+// Apply grants the identity the permissions of every rule matched by the claims
+func (p *Policy) Apply(claims Claims, identity *auth.Identity) {
+	for _, rule := range p.Rules {
+		if !rule.matches(claims) {
+			continue
+		}
+		for _, orgName := range rule.Organizations {
+			identity.Grant(orgName, rule.Permissions...)
+		}
+	}
+}
+
+func (r *PolicyRule) matches(claims Claims) bool {
+	for name, pattern := range r.Claims {
+		if !claimMatches(claims[name], pattern) {
+			return false
+		}
+	}
+	return true
+}
+
+func claimMatches(value interface{}, pattern string) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case string:
+		matched, _ := path.Match(pattern, v)
+		return matched
+	case []interface{}:
+		for _, item := range v {
+			if claimMatches(item, pattern) {
+				return true
+			}
+		}
+		return false
+	case json.Number:
+		return claimMatches(v.String(), pattern)
+	case bool:
+		return claimMatches(fmt.Sprintf("%t", v), pattern)
+	default:
+		return false
+	}
+}
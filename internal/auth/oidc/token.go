@@ -0,0 +1,214 @@
+package oidc
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	_ "crypto/sha256" // register SHA-256 for crypto.Hash
+	_ "crypto/sha512" // register SHA-384 and SHA-512 for crypto.Hash
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// clockSkew is the leeway applied when validating time based claims
+const clockSkew = time.Minute
+
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// Claims are the decoded claims of a validated token
+type Claims map[string]interface{}
+
+// String returns a claim as a string or an empty string when it is absent or not a string
+func (c Claims) String(name string) string {
+	value, _ := c[name].(string)
+	return value
+}
+
+// strings returns a claim holding either a single string or an array of strings as a slice
+func (c Claims) strings(name string) []string {
+	switch value := c[name].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func (c Claims) time(name string) (time.Time, bool) {
+	switch value := c[name].(type) {
+	case json.Number:
+		seconds, err := value.Int64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(seconds, 0), true
+	case float64:
+		return time.Unix(int64(value), 0), true
+	}
+	return time.Time{}, false
+}
+
+// verifier validates the signature and registered claims of a compact serialized JWT
+type verifier struct {
+	issuer   string
+	audience string
+	keys     KeySet
+	now      func() time.Time
+}
+
+func (v *verifier) verify(ctx context.Context, token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var header tokenHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed token header - %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature - %w", err)
+	}
+	key, err := v.keys.Key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims - %w", err)
+	}
+	if err := v.validateClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (v *verifier) validateClaims(claims Claims) error {
+	now := v.now()
+	if issuer := claims.String("iss"); issuer != v.issuer {
+		return fmt.Errorf("unexpected issuer %q", issuer)
+	}
+	audienceMatched := false
+	for _, audience := range claims.strings("aud") {
+		if audience == v.audience {
+			audienceMatched = true
+			break
+		}
+	}
+	if !audienceMatched {
+		return fmt.Errorf("token is not intended for audience %q", v.audience)
+	}
+	expiry, ok := claims.time("exp")
+	if !ok {
+		return errors.New("token has no expiry")
+	}
+	if now.After(expiry.Add(clockSkew)) {
+		return errors.New("token has expired")
+	}
+	if notBefore, ok := claims.time("nbf"); ok && now.Add(clockSkew).Before(notBefore) {
+		return errors.New("token is not valid yet")
+	}
+	if issuedAt, ok := claims.time("iat"); ok && now.Add(clockSkew).Before(issuedAt) {
+		return errors.New("token was issued in the future")
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// checkKeyAlgorithm ensures a key may sign with an algorithm: RSA keys for the RS and PS algorithms and EC keys on the
+// curve each ES algorithm is defined for, so that a token cannot pick an algorithm its key was not meant for
+func checkKeyAlgorithm(alg string, key crypto.PublicKey) error {
+	switch alg {
+	case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512":
+		if _, ok := key.(*rsa.PublicKey); !ok {
+			return fmt.Errorf("signing key does not match algorithm %s", alg)
+		}
+		return nil
+	case "ES256", "ES384", "ES512":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("signing key does not match algorithm %s", alg)
+		}
+		bitSize := map[string]int{"ES256": 256, "ES384": 384, "ES512": 521}[alg]
+		if ecKey.Curve.Params().BitSize != bitSize {
+			return fmt.Errorf("signing key curve %s does not match algorithm %s", ecKey.Curve.Params().Name, alg)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported signing algorithm %q", alg)
+}
+
+// verifySignature verifies the signature of a token with the key named by its header. The algorithm of the header
+// must be the one the key is restricted to, if any, and suit the type of the key.
+func verifySignature(alg string, key *SigningKey, signed []byte, signature []byte) error {
+	if key.Algorithm != "" && key.Algorithm != alg {
+		return fmt.Errorf("token algorithm %s does not match signing key algorithm %s", alg, key.Algorithm)
+	}
+	if err := checkKeyAlgorithm(alg, key.Public); err != nil {
+		return err
+	}
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "PS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "PS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	hasher := hash.New()
+	hasher.Write(signed)
+	digest := hasher.Sum(nil)
+
+	switch key := key.Public.(type) {
+	case *rsa.PublicKey:
+		if alg[0] == 'P' {
+			return rsa.VerifyPSS(key, hash, digest, signature, nil)
+		}
+		return rsa.VerifyPKCS1v15(key, hash, digest, signature)
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid signature length")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("signing key does not match algorithm %s", alg)
+}
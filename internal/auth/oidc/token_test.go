@@ -0,0 +1,229 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testIssuer   = "https://issuer.example.com"
+	testAudience = "terrarium"
+)
+
+var testNow = time.Unix(1700000000, 0)
+
+type testKeys struct {
+	rsa   *rsa.PrivateKey
+	p256  *ecdsa.PrivateKey
+	p384  *ecdsa.PrivateKey
+	keys  map[string]*SigningKey
+	other *rsa.PrivateKey
+}
+
+func newTestKeys(t *testing.T) *testKeys {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testKeys{
+		rsa:   rsaKey,
+		p256:  p256,
+		p384:  p384,
+		other: otherKey,
+		keys: map[string]*SigningKey{
+			"rsa":        {Public: &rsaKey.PublicKey},
+			"rsa-rs256":  {Public: &rsaKey.PublicKey, Algorithm: "RS256"},
+			"p256":       {Public: &p256.PublicKey},
+			"p384":       {Public: &p384.PublicKey},
+			"p256-es256": {Public: &p256.PublicKey, Algorithm: "ES256"},
+		},
+	}
+}
+
+// sign serializes a token with the given header and claims, signing it with key using alg. A nil key leaves the
+// signature empty.
+func sign(t *testing.T, header map[string]interface{}, claims map[string]interface{}, alg string, key crypto.Signer) string {
+	t.Helper()
+	encode := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := encode(header) + "." + encode(claims)
+	if key == nil {
+		return signed + "."
+	}
+	var hash crypto.Hash
+	var digest []byte
+	switch alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+		sum := sha256.Sum256([]byte(signed))
+		digest = sum[:]
+	case "384":
+		hash = crypto.SHA384
+		sum := sha512.Sum384([]byte(signed))
+		digest = sum[:]
+	default:
+		hash = crypto.SHA512
+		sum := sha512.Sum512([]byte(signed))
+		digest = sum[:]
+	}
+	var signature []byte
+	var err error
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		if alg[0] == 'P' {
+			signature, err = rsa.SignPSS(rand.Reader, key, hash, digest, nil)
+		} else {
+			signature, err = rsa.SignPKCS1v15(rand.Reader, key, hash, digest)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, signErr := ecdsa.Sign(rand.Reader, key, digest)
+		err = signErr
+		size := (key.Curve.Params().BitSize + 7) / 8
+		signature = make([]byte, 2*size)
+		r.FillBytes(signature[:size])
+		s.FillBytes(signature[size:])
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss": testIssuer,
+		"aud": testAudience,
+		"sub": "repo:acme/vpc:ref:refs/heads/main",
+		"iat": testNow.Add(-time.Minute).Unix(),
+		"exp": testNow.Add(10 * time.Minute).Unix(),
+	}
+}
+
+func withClaim(name string, value interface{}) map[string]interface{} {
+	claims := validClaims()
+	if value == nil {
+		delete(claims, name)
+	} else {
+		claims[name] = value
+	}
+	return claims
+}
+
+func TestVerify(t *testing.T) {
+	keys := newTestKeys(t)
+	v := &verifier{
+		issuer:   testIssuer,
+		audience: testAudience,
+		keys:     &staticKeySet{keys: keys.keys},
+		now:      func() time.Time { return testNow },
+	}
+	header := func(alg string, kid string) map[string]interface{} {
+		return map[string]interface{}{"alg": alg, "kid": kid, "typ": "JWT"}
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{"RS256", sign(t, header("RS256", "rsa"), validClaims(), "RS256", keys.rsa), ""},
+		{"PS384", sign(t, header("PS384", "rsa"), validClaims(), "PS384", keys.rsa), ""},
+		{"ES256", sign(t, header("ES256", "p256"), validClaims(), "ES256", keys.p256), ""},
+		{"ES384", sign(t, header("ES384", "p384"), validClaims(), "ES384", keys.p384), ""},
+		{"key restricted to the token algorithm", sign(t, header("RS256", "rsa-rs256"), validClaims(), "RS256", keys.rsa), ""},
+		{"audience list", sign(t, header("RS256", "rsa"), withClaim("aud", []string{"other", testAudience}), "RS256", keys.rsa), ""},
+		{"expired within clock skew", sign(t, header("RS256", "rsa"), withClaim("exp", testNow.Add(-30*time.Second).Unix()), "RS256", keys.rsa), ""},
+
+		{"expired", sign(t, header("RS256", "rsa"), withClaim("exp", testNow.Add(-2*time.Minute).Unix()), "RS256", keys.rsa), "token has expired"},
+		{"no expiry", sign(t, header("RS256", "rsa"), withClaim("exp", nil), "RS256", keys.rsa), "token has no expiry"},
+		{"not valid yet", sign(t, header("RS256", "rsa"), withClaim("nbf", testNow.Add(5*time.Minute).Unix()), "RS256", keys.rsa), "token is not valid yet"},
+		{"issued in the future", sign(t, header("RS256", "rsa"), withClaim("iat", testNow.Add(5*time.Minute).Unix()), "RS256", keys.rsa), "token was issued in the future"},
+		{"wrong issuer", sign(t, header("RS256", "rsa"), withClaim("iss", "https://evil.example.com"), "RS256", keys.rsa), "unexpected issuer"},
+		{"wrong audience", sign(t, header("RS256", "rsa"), withClaim("aud", "other"), "RS256", keys.rsa), "not intended for audience"},
+		{"no audience", sign(t, header("RS256", "rsa"), withClaim("aud", nil), "RS256", keys.rsa), "not intended for audience"},
+
+		{"alg none", sign(t, header("none", "rsa"), validClaims(), "none", nil), "unsupported signing algorithm"},
+		{"alg HS256 with RSA key", sign(t, header("HS256", "rsa"), validClaims(), "HS256", nil), "unsupported signing algorithm"},
+		{"ES256 header with RSA key", sign(t, header("ES256", "rsa"), validClaims(), "RS256", keys.rsa), "signing key does not match algorithm ES256"},
+		{"RS256 header with EC key", sign(t, header("RS256", "p256"), validClaims(), "ES256", keys.p256), "signing key does not match algorithm RS256"},
+		{"ES384 header with P-256 key", sign(t, header("ES384", "p256"), validClaims(), "ES384", keys.p256), "does not match algorithm ES384"},
+		{"ES256 header with P-384 key", sign(t, header("ES256", "p384"), validClaims(), "ES256", keys.p384), "does not match algorithm ES256"},
+		{"algorithm other than the key's", sign(t, header("PS256", "rsa-rs256"), validClaims(), "PS256", keys.rsa), "does not match signing key algorithm RS256"},
+		{"EC algorithm other than the key's", sign(t, header("ES384", "p256-es256"), validClaims(), "ES384", keys.p256), "does not match signing key algorithm ES256"},
+		{"unknown kid", sign(t, header("RS256", "missing"), validClaims(), "RS256", keys.rsa), `unknown signing key "missing"`},
+		{"no kid with several keys", sign(t, header("RS256", ""), validClaims(), "RS256", keys.rsa), `unknown signing key ""`},
+		{"signed by another key", sign(t, header("RS256", "rsa"), validClaims(), "RS256", keys.other), "verification error"},
+		{"malformed", "not-a-token", "malformed token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := v.verify(context.Background(), tt.token)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("verify() unexpected error: %v", err)
+				}
+				if claims.String("sub") == "" {
+					t.Fatalf("verify() returned no subject")
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("verify() accepted the token, want error containing %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("verify() error = %q, want it to contain %q", err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyTamperedClaims(t *testing.T) {
+	keys := newTestKeys(t)
+	v := &verifier{
+		issuer:   testIssuer,
+		audience: testAudience,
+		keys:     &staticKeySet{keys: keys.keys},
+		now:      func() time.Time { return testNow },
+	}
+	token := sign(t, map[string]interface{}{"alg": "ES256", "kid": "p256"}, validClaims(), "ES256", keys.p256)
+	parts := strings.Split(token, ".")
+	claims := validClaims()
+	claims["sub"] = "repo:evil/vpc:ref:refs/heads/main"
+	data, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts[1] = base64.RawURLEncoding.EncodeToString(data)
+	if _, err := v.verify(context.Background(), strings.Join(parts, ".")); err == nil {
+		t.Fatal("verify() accepted a token whose claims were changed after signing")
+	}
+}
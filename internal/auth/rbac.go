@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Role is a named set of permissions that can be granted on an organization
+type Role string
+
+const (
+	// RoleReader may list and download modules
+	RoleReader Role = "reader"
+	// RolePublisher may additionally publish new module versions
+	RolePublisher Role = "publisher"
+	// RoleAdmin may additionally perform administrative operations such as deleting modules
+	RoleAdmin Role = "admin"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleReader:    {PermissionRead},
+	RolePublisher: {PermissionRead, PermissionPublish},
+	RoleAdmin:     {PermissionRead, PermissionPublish, PermissionAdmin},
+}
+
+// Permissions returns the permissions included in the role
+func (r Role) Permissions() []Permission {
+	return rolePermissions[r]
+}
+
+// Includes reports whether the role includes a permission
+func (r Role) Includes(permission Permission) bool {
+	for _, p := range rolePermissions[r] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleBinding grants a role to principals. Entries are path.Match patterns matched against the subject of user
+// and token identities and the team names of any identity.
+type RoleBinding struct {
+	Role   Role     `yaml:"role"`
+	Users  []string `yaml:"users"`
+	Teams  []string `yaml:"teams"`
+	Tokens []string `yaml:"tokens"`
+}
+
+// RoleBindings grants roles on organizations. The organization name "*" applies bindings to every organization.
+//
+// An example granting the platform team admin on acme and every CI token from acme's repositories read access:
+//
+//	organizations:
+//	  acme:
+//	    - role: admin
+//	      teams: [platform]
+//	    - role: reader
+//	      tokens: ["repo:acme/*"]
+type RoleBindings struct {
+	Organizations map[string][]*RoleBinding `yaml:"organizations"`
+}
+
+// LoadRoleBindings reads and validates a YAML role bindings file
+func LoadRoleBindings(bindingsPath string) (*RoleBindings, error) {
+	data, err := os.ReadFile(bindingsPath)
+	if err != nil {
+		return nil, err
+	}
+	bindings := &RoleBindings{}
+	if err := yaml.UnmarshalStrict(data, bindings); err != nil {
+		return nil, fmt.Errorf("failed parsing role bindings %s - %w", bindingsPath, err)
+	}
+	if err := bindings.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid role bindings %s - %w", bindingsPath, err)
+	}
+	return bindings, nil
+}
+
+// Validate checks bindings reference known roles and contain valid patterns
+func (b *RoleBindings) Validate() error {
+	for orgName, orgBindings := range b.Organizations {
+		for i, binding := range orgBindings {
+			if _, ok := rolePermissions[binding.Role]; !ok {
+				return fmt.Errorf("organization %s binding %d has unknown role %q", orgName, i, binding.Role)
+			}
+			for _, patterns := range [][]string{binding.Users, binding.Teams, binding.Tokens} {
+				for _, pattern := range patterns {
+					if _, err := path.Match(pattern, ""); err != nil {
+						return fmt.Errorf("organization %s binding %d pattern %q - %w", orgName, i, pattern, err)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Roles returns the roles bound to an identity on an organization
+func (b *RoleBindings) Roles(identity *Identity, orgName string) []Role {
+	var roles []Role
+	for _, name := range []string{orgName, AnyOrganization} {
+		for _, binding := range b.Organizations[name] {
+			if binding.matches(identity) {
+				roles = append(roles, binding.Role)
+			}
+		}
+	}
+	return roles
+}
+
+func (r *RoleBinding) matches(identity *Identity) bool {
+	switch identity.Type {
+	case IdentityUser:
+		if matchAny(r.Users, identity.Subject) {
+			return true
+		}
+	case IdentityToken:
+		if matchAny(r.Tokens, identity.Subject) {
+			return true
+		}
+	}
+	for _, team := range identity.Teams {
+		if matchAny(r.Teams, team) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, value); matched {
+			return true
+		}
+	}
+	return false
+}
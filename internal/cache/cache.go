@@ -0,0 +1,131 @@
+// Package cache provides in memory caching decorators for the storage driver and module store. Archives are kept in a
+// least recently used cache bounded by their total size and version lists for a short time to live, and concurrent
+// identical reads missing the cache are collapsed into a single read of the backend. This matters most for remote
+// backends, where many CI jobs fetch the same module version at once.
+//
+// Writes made through the decorators invalidate what they change. Writes made by other registry instances sharing the
+// backends are only seen once cached version lists expire, and replaced archives once they are evicted.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Config sizes the caches
+type Config struct {
+	// ArchiveBytes bounds the total size of the archives cached
+	ArchiveBytes int64
+	// VersionsTTL is how long version lists and versions are cached
+	VersionsTTL time.Duration
+}
+
+// flight is a read in progress shared by every caller asking for the same key
+type flight struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// group collapses concurrent calls for the same key into one
+type group struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// do calls fn once for concurrent callers of the same key and hands every one of them its result. The call runs with
+// the context of the caller starting it; callers whose own context is still live retry alone should it be cancelled.
+func (g *group) do(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	if g.flights == nil {
+		g.flights = map[string]*flight{}
+	}
+	if f, ok := g.flights[key]; ok {
+		g.mu.Unlock()
+		select {
+		case <-f.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if f.err != nil && ctx.Err() == nil && (errors.Is(f.err, context.Canceled) || errors.Is(f.err, context.DeadlineExceeded)) {
+			return fn(ctx)
+		}
+		return f.value, f.err
+	}
+	f := &flight{done: make(chan struct{})}
+	g.flights[key] = f
+	g.mu.Unlock()
+
+	f.value, f.err = fn(ctx)
+	g.mu.Lock()
+	if g.flights[key] == f {
+		delete(g.flights, key)
+	}
+	g.mu.Unlock()
+	close(f.done)
+	return f.value, f.err
+}
+
+// forget makes later callers of a key start a new call rather than wait for one in progress, which may return what
+// was just changed
+func (g *group) forget(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.flights, key)
+}
+
+type lruEntry struct {
+	key  string
+	data []byte
+}
+
+// lru holds byte slices up to a total size, evicting the least recently used first
+type lru struct {
+	maxBytes int64
+	size     int64
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+func newLRU(maxBytes int64) *lru {
+	return &lru{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  map[string]*list.Element{},
+	}
+}
+
+func (c *lru) get(key string) ([]byte, bool) {
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*lruEntry).data, true
+}
+
+// add caches data under key. Data larger than the whole cache is not cached.
+func (c *lru) add(key string, data []byte) {
+	if int64(len(data)) > c.maxBytes {
+		return
+	}
+	c.remove(key)
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, data: data})
+	c.size += int64(len(data))
+	for c.size > c.maxBytes {
+		c.remove(c.order.Back().Value.(*lruEntry).key)
+	}
+}
+
+func (c *lru) remove(key string) {
+	element, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	c.order.Remove(element)
+	delete(c.entries, key)
+	c.size -= int64(len(element.Value.(*lruEntry).data))
+}
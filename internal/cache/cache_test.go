@@ -0,0 +1,308 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/modules"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/drivers"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/stores"
+)
+
+func TestLRU(t *testing.T) {
+	type op struct {
+		add  string
+		size int
+		get  string
+	}
+	tests := []struct {
+		name     string
+		maxBytes int64
+		ops      []op
+		wantKeys []string
+		wantSize int64
+	}{
+		{"within the limit", 10, []op{{add: "a", size: 4}, {add: "b", size: 6}}, []string{"a", "b"}, 10},
+		{"evicts the oldest", 10, []op{{add: "a", size: 4}, {add: "b", size: 4}, {add: "c", size: 4}}, []string{"b", "c"}, 8},
+		{"reads refresh entries", 10, []op{{add: "a", size: 4}, {add: "b", size: 4}, {get: "a"}, {add: "c", size: 4}}, []string{"a", "c"}, 8},
+		{"evicts as many as needed", 10, []op{{add: "a", size: 3}, {add: "b", size: 3}, {add: "c", size: 3}, {add: "d", size: 9}}, []string{"d"}, 9},
+		{"replacing an entry", 10, []op{{add: "a", size: 4}, {add: "a", size: 6}}, []string{"a"}, 6},
+		{"larger than the cache", 10, []op{{add: "a", size: 4}, {add: "b", size: 11}}, []string{"a"}, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newLRU(tt.maxBytes)
+			for _, o := range tt.ops {
+				if o.add != "" {
+					c.add(o.add, make([]byte, o.size))
+				} else {
+					c.get(o.get)
+				}
+			}
+			keys := make([]string, 0, len(c.entries))
+			for key := range c.entries {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			if len(keys) != len(tt.wantKeys) || c.order.Len() != len(tt.wantKeys) {
+				t.Fatalf("cached %q, want %q", keys, tt.wantKeys)
+			}
+			for i := range keys {
+				if keys[i] != tt.wantKeys[i] {
+					t.Fatalf("cached %q, want %q", keys, tt.wantKeys)
+				}
+			}
+			if c.size != tt.wantSize {
+				t.Fatalf("size = %d, want %d", c.size, tt.wantSize)
+			}
+		})
+	}
+}
+
+// countingStore serves a single module version and counts the reads reaching it
+type countingStore struct {
+	stores.ModuleStore
+	reads  atomic.Int32
+	module *modules.Module
+	err    error
+}
+
+func (s *countingStore) ReadModuleVersions(_ context.Context, orgName string, moduleName string, providerName string) ([]*modules.Module, error) {
+	s.reads.Add(1)
+	if s.err != nil {
+		return nil, s.err
+	}
+	return []*modules.Module{s.module}, nil
+}
+
+func (s *countingStore) ReadModuleVersion(_ context.Context, orgName string, moduleName string, providerName string, version string) (*modules.Module, error) {
+	s.reads.Add(1)
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.module, nil
+}
+
+func (s *countingStore) PublishModuleVersion(context.Context, *modules.Module) error {
+	return nil
+}
+
+func (s *countingStore) UpdateVersionLifecycle(context.Context, string, string, string, string, *modules.VersionLifecycle) error {
+	return errors.New("lifecycle file unwritable")
+}
+
+func (s *countingStore) DeleteModuleVersion(context.Context, *modules.Deletion) error {
+	return nil
+}
+
+func testModule() *modules.Module {
+	return &modules.Module{
+		Organization: "acme", Name: "vpc", Provider: "aws", Version: "1.0.0",
+		Signature:  &modules.ModuleSignature{KeyID: "release"},
+		Lifecycle:  &modules.VersionLifecycle{State: modules.VersionDeprecated, Reason: "use 2.x"},
+		Validation: &modules.ArchiveValidation{Valid: true, Files: 3},
+	}
+}
+
+func TestModuleStoreCopies(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*modules.Module)
+	}{
+		{"version", func(m *modules.Module) { m.Version = "9.9.9" }},
+		{"signature", func(m *modules.Module) { m.Signature.KeyID = "forged" }},
+		{"lifecycle", func(m *modules.Module) { m.Lifecycle.State = modules.VersionActive }},
+		{"validation", func(m *modules.Module) { m.Validation.Valid = false }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := &countingStore{module: testModule()}
+			cached := ModuleStore(backend, time.Hour)
+			ctx := context.Background()
+			found, err := cached.ReadModuleVersions(ctx, "acme", "vpc", "aws")
+			if err != nil {
+				t.Fatal(err)
+			}
+			version, err := cached.ReadModuleVersion(ctx, "acme", "vpc", "aws", "1.0.0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.change(found[0])
+			tt.change(version)
+			// The module handed to the cache by the backend must not be shared either
+			tt.change(backend.module)
+			for _, read := range []func() (*modules.Module, error){
+				func() (*modules.Module, error) {
+					found, err := cached.ReadModuleVersions(ctx, "acme", "vpc", "aws")
+					if err != nil {
+						return nil, err
+					}
+					return found[0], nil
+				},
+				func() (*modules.Module, error) {
+					return cached.ReadModuleVersion(ctx, "acme", "vpc", "aws", "1.0.0")
+				},
+			} {
+				module, err := read()
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := testModule()
+				if module.Version != want.Version || *module.Signature != *want.Signature || *module.Lifecycle != *want.Lifecycle || *module.Validation != *want.Validation {
+					t.Fatalf("cached module changed through a copy: %+v", module)
+				}
+			}
+		})
+	}
+}
+
+func TestModuleStoreInvalidation(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name      string
+		ttl       time.Duration
+		write     func(stores.ModuleStore)
+		wantReads int32
+	}{
+		{"cached", time.Hour, func(stores.ModuleStore) {}, 1},
+		{"expired", 0, func(stores.ModuleStore) {}, 2},
+		{"publish", time.Hour, func(s stores.ModuleStore) { s.PublishModuleVersion(ctx, testModule()) }, 2},
+		{"failed lifecycle update", time.Hour, func(s stores.ModuleStore) {
+			s.UpdateVersionLifecycle(ctx, "acme", "vpc", "aws", "1.0.0", &modules.VersionLifecycle{State: modules.VersionYanked})
+		}, 2},
+		{"deletion", time.Hour, func(s stores.ModuleStore) {
+			s.DeleteModuleVersion(ctx, &modules.Deletion{ModuleVersionRef: modules.ModuleVersionRef{Organization: "acme", Name: "vpc", Provider: "aws", Version: "1.0.0"}})
+		}, 2},
+		{"write to another module", time.Hour, func(s stores.ModuleStore) {
+			s.PublishModuleVersion(ctx, &modules.Module{Organization: "acme", Name: "iam", Provider: "aws", Version: "1.0.0"})
+		}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := &countingStore{module: testModule()}
+			cached := ModuleStore(backend, tt.ttl)
+			if _, err := cached.ReadModuleVersions(ctx, "acme", "vpc", "aws"); err != nil {
+				t.Fatal(err)
+			}
+			tt.write(cached)
+			if _, err := cached.ReadModuleVersions(ctx, "acme", "vpc", "aws"); err != nil {
+				t.Fatal(err)
+			}
+			if reads := backend.reads.Load(); reads != tt.wantReads {
+				t.Fatalf("backend read %d times, want %d", reads, tt.wantReads)
+			}
+		})
+	}
+}
+
+func TestModuleStoreErrors(t *testing.T) {
+	backend := &countingStore{err: stores.ErrModuleNotFound}
+	cached := ModuleStore(backend, time.Hour)
+	for i := 0; i < 2; i++ {
+		if _, err := cached.ReadModuleVersions(context.Background(), "acme", "vpc", "aws"); !errors.Is(err, stores.ErrModuleNotFound) {
+			t.Fatalf("ReadModuleVersions() error = %v, want %v", err, stores.ErrModuleNotFound)
+		}
+	}
+	if reads := backend.reads.Load(); reads != 2 {
+		t.Fatalf("backend read %d times, want failed reads not to be cached", reads)
+	}
+}
+
+// blockingStorage serves archives once released, counting the fetches reaching it
+type blockingStorage struct {
+	drivers.TerrariumStorageDriver
+	fetches atomic.Int32
+	release chan struct{}
+	data    []byte
+}
+
+func (s *blockingStorage) FetchModuleSource(ctx context.Context, key string) ([]byte, error) {
+	s.fetches.Add(1)
+	select {
+	case <-s.release:
+		return s.data, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s *blockingStorage) StoreModuleSource(_ context.Context, key string, data []byte) error {
+	s.data = data
+	return nil
+}
+
+func TestStorage(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name        string
+		maxBytes    int64
+		write       bool
+		wantFetches int32
+	}{
+		{"cached", 1 << 10, false, 1},
+		{"replaced archive", 1 << 10, true, 2},
+		{"larger than the cache", 4, false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := &blockingStorage{release: make(chan struct{}), data: []byte("archive")}
+			close(backend.release)
+			cached := Storage(backend, tt.maxBytes)
+			if _, err := cached.FetchModuleSource(ctx, "acme/vpc/aws/1.0.0.zip"); err != nil {
+				t.Fatal(err)
+			}
+			if tt.write {
+				if err := cached.StoreModuleSource(ctx, "acme/vpc/aws/1.0.0.zip", []byte("replaced")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			data, err := cached.FetchModuleSource(ctx, "acme/vpc/aws/1.0.0.zip")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != string(backend.data) {
+				t.Fatalf("FetchModuleSource() = %q, want %q", data, backend.data)
+			}
+			if fetches := backend.fetches.Load(); fetches != tt.wantFetches {
+				t.Fatalf("backend fetched %d times, want %d", fetches, tt.wantFetches)
+			}
+		})
+	}
+}
+
+func TestStorageCollapsesConcurrentFetches(t *testing.T) {
+	backend := &blockingStorage{release: make(chan struct{}), data: []byte("archive")}
+	cached := Storage(backend, 1<<10)
+	const callers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := cached.FetchModuleSource(context.Background(), "acme/vpc/aws/1.0.0.zip")
+			errs <- err
+		}()
+	}
+	// Give every caller time to join the fetch in progress before it completes
+	for backend.fetches.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(backend.release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fetches := backend.fetches.Load(); fetches != 1 {
+		t.Fatalf("backend fetched %d times for concurrent callers, want 1", fetches)
+	}
+}
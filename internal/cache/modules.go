@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/modules"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/stores"
+)
+
+// ModuleStore wraps a module store so that version lists and single versions are cached for ttl. Callers get copies
+// of the cached modules so that changing them does not change the cache.
+func ModuleStore(store stores.ModuleStore, ttl time.Duration) stores.ModuleStore {
+	return &cachedModuleStore{ModuleStore: store, ttl: ttl, entries: map[versionKey]*versionsEntry{}}
+}
+
+// versionKey identifies a cached read, the list of versions of a module when version is empty
+type versionKey struct {
+	organization string
+	name         string
+	provider     string
+	version      string
+}
+
+func (k versionKey) String() string {
+	return fmt.Sprintf("%s/%s/%s@%s", k.organization, k.name, k.provider, k.version)
+}
+
+type versionsEntry struct {
+	modules []*modules.Module
+	expires time.Time
+}
+
+type cachedModuleStore struct {
+	stores.ModuleStore
+	ttl        time.Duration
+	mu         sync.Mutex
+	entries    map[versionKey]*versionsEntry
+	generation uint64
+	flights    group
+}
+
+func (s *cachedModuleStore) ReadModuleVersions(ctx context.Context, orgName string, moduleName string, providerName string) ([]*modules.Module, error) {
+	key := versionKey{organization: orgName, name: moduleName, provider: providerName}
+	return s.read(ctx, key, func(ctx context.Context) ([]*modules.Module, error) {
+		return s.ModuleStore.ReadModuleVersions(ctx, orgName, moduleName, providerName)
+	})
+}
+
+func (s *cachedModuleStore) ReadModuleVersion(ctx context.Context, orgName string, moduleName string, providerName string, version string) (*modules.Module, error) {
+	key := versionKey{organization: orgName, name: moduleName, provider: providerName, version: version}
+	found, err := s.read(ctx, key, func(ctx context.Context) ([]*modules.Module, error) {
+		module, err := s.ModuleStore.ReadModuleVersion(ctx, orgName, moduleName, providerName, version)
+		if err != nil {
+			return nil, err
+		}
+		return []*modules.Module{module}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return found[0], nil
+}
+
+// read returns a copy of the cached result of a read, reading through the wrapped store when it is missing or
+// expired. Failed reads are not cached.
+func (s *cachedModuleStore) read(ctx context.Context, key versionKey, fn func(ctx context.Context) ([]*modules.Module, error)) ([]*modules.Module, error) {
+	s.mu.Lock()
+	entry, ok := s.entries[key]
+	generation := s.generation
+	s.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return copyModules(entry.modules), nil
+	}
+	value, err := s.flights.do(ctx, key.String(), func(ctx context.Context) (interface{}, error) {
+		found, err := fn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		found = copyModules(found)
+		s.mu.Lock()
+		if s.generation == generation {
+			s.entries[key] = &versionsEntry{modules: found, expires: time.Now().Add(s.ttl)}
+		}
+		s.mu.Unlock()
+		return found, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return copyModules(value.([]*modules.Module)), nil
+}
+
+func (s *cachedModuleStore) PublishModuleVersion(ctx context.Context, module *modules.Module) error {
+	defer s.invalidate(module.Organization, module.Name, module.Provider, module.Version)
+	return s.ModuleStore.PublishModuleVersion(ctx, module)
+}
+
+func (s *cachedModuleStore) UpdateVersionLifecycle(ctx context.Context, orgName string, moduleName string, providerName string, version string, lifecycle *modules.VersionLifecycle) error {
+	defer s.invalidate(orgName, moduleName, providerName, version)
+	return s.ModuleStore.UpdateVersionLifecycle(ctx, orgName, moduleName, providerName, version, lifecycle)
+}
+
+func (s *cachedModuleStore) DeleteModuleVersion(ctx context.Context, deletion *modules.Deletion) error {
+	defer s.invalidate(deletion.Organization, deletion.Name, deletion.Provider, deletion.Version)
+	return s.ModuleStore.DeleteModuleVersion(ctx, deletion)
+}
+
+// invalidate drops the cached version list of a module and the cached version once it has been written, even when
+// the write failed part way
+func (s *cachedModuleStore) invalidate(orgName string, moduleName string, providerName string, version string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generation++
+	for _, key := range []versionKey{
+		{organization: orgName, name: moduleName, provider: providerName},
+		{organization: orgName, name: moduleName, provider: providerName, version: version},
+	} {
+		delete(s.entries, key)
+		s.flights.forget(key.String())
+	}
+	// Expired entries of other modules are dropped along the way so that the cache does not keep every module read
+	now := time.Now()
+	for key, entry := range s.entries {
+		if now.After(entry.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// copyModules deep copies a list of modules so that callers and the cache do not share them
+func copyModules(found []*modules.Module) []*modules.Module {
+	copied := make([]*modules.Module, len(found))
+	for i, module := range found {
+		copied[i] = module.Copy()
+	}
+	return copied
+}
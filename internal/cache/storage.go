@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"context"
+	"sync"
+
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/drivers"
+)
+
+// Storage wraps a storage driver so that fetched archives are cached up to maxBytes in total. Cached archives are
+// shared between callers, which must not modify them.
+func Storage(driver drivers.TerrariumStorageDriver, maxBytes int64) drivers.TerrariumStorageDriver {
+	return &cachedStorage{TerrariumStorageDriver: driver, archives: newLRU(maxBytes)}
+}
+
+type cachedStorage struct {
+	drivers.TerrariumStorageDriver
+	mu       sync.Mutex
+	archives *lru
+	// generation changes with every write so that fetches started before it do not cache what it replaced
+	generation uint64
+	flights    group
+}
+
+func (s *cachedStorage) FetchModuleSource(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	data, ok := s.archives.get(key)
+	generation := s.generation
+	s.mu.Unlock()
+	if ok {
+		return data, nil
+	}
+	value, err := s.flights.do(ctx, key, func(ctx context.Context) (interface{}, error) {
+		data, err := s.TerrariumStorageDriver.FetchModuleSource(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		if s.generation == generation {
+			s.archives.add(key, data)
+		}
+		s.mu.Unlock()
+		return data, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]byte), nil
+}
+
+func (s *cachedStorage) StoreModuleSource(ctx context.Context, key string, data []byte) error {
+	defer s.invalidate(key)
+	return s.TerrariumStorageDriver.StoreModuleSource(ctx, key, data)
+}
+
+func (s *cachedStorage) DeleteModuleSource(ctx context.Context, key string) error {
+	defer s.invalidate(key)
+	return s.TerrariumStorageDriver.DeleteModuleSource(ctx, key)
+}
+
+// invalidate drops a cached archive once it has been written, even when the write failed part way
+func (s *cachedStorage) invalidate(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generation++
+	s.archives.remove(key)
+	s.flights.forget(key)
+}
+
+// HealthCheck always checks the wrapped driver, as cached archives do not make up for storage that cannot be written
+func (s *cachedStorage) HealthCheck(ctx context.Context) error {
+	if checker, ok := s.TerrariumStorageDriver.(drivers.HealthChecker); ok {
+		return checker.HealthCheck(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+// Package certs provides a certificate store for the Terrarium TLS listener. Certificates are reloaded from disk
+// when they change, for example after rotation by cert-manager, and selected per connection by SNI so that a
+// single listener can serve several hostnames. Existing connections are unaffected by a reload.
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// KeyPair is the location of a PEM encoded certificate chain and its private key on disk
+type KeyPair struct {
+	CertFile string
+	KeyFile  string
+}
+
+type loadedPair struct {
+	KeyPair
+	cert     *tls.Certificate
+	modified time.Time
+}
+
+// Store holds the current certificates for each configured key pair and reloads them when their files change
+type Store struct {
+	mu     sync.RWMutex
+	pairs  []*loadedPair
+	stop   chan struct{}
+	once   sync.Once
+	logger logrus.FieldLogger
+}
+
+// New loads every key pair and starts polling their files for changes at the given interval. The first pair is
+// served to clients that do not send SNI or request an unknown hostname.
+func New(pairs []KeyPair, reloadInterval time.Duration, logger logrus.FieldLogger) (*Store, error) {
+	if len(pairs) == 0 {
+		return nil, errors.New("no certificates specified")
+	}
+	s := &Store{stop: make(chan struct{}), logger: logger}
+	for _, pair := range pairs {
+		loaded := &loadedPair{KeyPair: pair}
+		if err := loaded.load(); err != nil {
+			return nil, err
+		}
+		s.pairs = append(s.pairs, loaded)
+	}
+	if reloadInterval > 0 {
+		go s.watch(reloadInterval)
+	}
+	return s, nil
+}
+
+// TLSConfig returns a TLS configuration serving certificates from the store
+func (s *Store) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: s.GetCertificate,
+	}
+}
+
+// GetCertificate selects the certificate matching the server name requested by the client
+func (s *Store) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if hello.ServerName != "" {
+		for _, pair := range s.pairs {
+			if pair.cert.Leaf.VerifyHostname(strings.TrimSuffix(hello.ServerName, ".")) == nil {
+				return pair.cert, nil
+			}
+		}
+	}
+	return s.pairs[0].cert, nil
+}
+
+// Close stops watching certificate files for changes
+func (s *Store) Close() error {
+	s.once.Do(func() { close(s.stop) })
+	return nil
+}
+
+func (s *Store) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.reload()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// reload replaces the certificates of any pair whose files changed. A pair that fails to load, for instance
+// because the certificate was rotated but the key not yet, keeps serving its previous certificate.
+func (s *Store) reload() {
+	for i, pair := range s.pairs {
+		modified, err := pair.lastModified()
+		if err != nil {
+			s.logger.WithError(err).WithField("cert_file", pair.CertFile).Error("failed checking certificate for changes")
+			continue
+		}
+		if !modified.After(pair.modified) {
+			continue
+		}
+		reloaded := &loadedPair{KeyPair: pair.KeyPair}
+		if err := reloaded.load(); err != nil {
+			s.logger.WithError(err).WithField("cert_file", pair.CertFile).Error("failed reloading certificate, keeping previous certificate")
+			continue
+		}
+		s.mu.Lock()
+		s.pairs[i] = reloaded
+		s.mu.Unlock()
+		s.logger.WithFields(logrus.Fields{"cert_file": pair.CertFile, "not_after": reloaded.cert.Leaf.NotAfter.Format(time.RFC3339)}).Info("reloaded certificate")
+	}
+}
+
+func (p *loadedPair) load() error {
+	modified, err := p.lastModified()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(p.CertFile, p.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed loading certificate %s - %w", p.CertFile, err)
+	}
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("failed parsing certificate %s - %w", p.CertFile, err)
+	}
+	p.cert = &cert
+	p.modified = modified
+	return nil
+}
+
+// lastModified returns the latest modification time of the certificate and key. Stat follows symlinks so
+// rotations performed by swapping a symlinked directory, as Kubernetes does for mounted secrets, are detected.
+func (p *loadedPair) lastModified() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{p.CertFile, p.KeyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
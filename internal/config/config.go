@@ -0,0 +1,565 @@
+// Package config defines the typed configuration of the Terrarium server. Configuration is resolved by viper from,
+// in order of precedence, command line flags, TERRARIUM_* environment variables, the configuration file and the
+// defaults defined here. Nested keys map to environment variables by replacing dots with underscores, for example
+// listener.port is set by TERRARIUM_LISTENER_PORT.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/terrariumcloud/terrarium-lite/internal/auth/mtls"
+	"github.com/terrariumcloud/terrarium-lite/internal/ratelimit"
+)
+
+// EnvPrefix is the prefix of environment variables overriding configuration keys
+const EnvPrefix string = "TERRARIUM"
+
+// Config is the complete configuration of the Terrarium server
+type Config struct {
+	Listener  ListenerConfig  `mapstructure:"listener" yaml:"listener"`
+	TLS       TLSConfig       `mapstructure:"tls" yaml:"tls"`
+	Database  DatabaseConfig  `mapstructure:"database" yaml:"database"`
+	Storage   StorageConfig   `mapstructure:"storage" yaml:"storage"`
+	Auth      AuthConfig      `mapstructure:"auth" yaml:"auth"`
+	Logging   LoggingConfig   `mapstructure:"logging" yaml:"logging"`
+	Metrics   MetricsConfig   `mapstructure:"metrics" yaml:"metrics"`
+	Tracing   TracingConfig   `mapstructure:"tracing" yaml:"tracing"`
+	Signing   SigningConfig   `mapstructure:"signing" yaml:"signing"`
+	Policy    PolicyConfig    `mapstructure:"policy" yaml:"policy"`
+	Approval  ApprovalConfig  `mapstructure:"approval" yaml:"approval"`
+	Webhooks  WebhooksConfig  `mapstructure:"webhooks" yaml:"webhooks"`
+	RateLimit RateLimitConfig `mapstructure:"rate_limit" yaml:"rate_limit"`
+	Cache     CacheConfig     `mapstructure:"cache" yaml:"cache"`
+}
+
+// ListenerConfig configures the address the API listens on
+type ListenerConfig struct {
+	BindAddress string `mapstructure:"bind_address" yaml:"bind_address"`
+	Port        int    `mapstructure:"port" yaml:"port"`
+	Plaintext   bool   `mapstructure:"plaintext" yaml:"plaintext"`
+	// TrustProxyHeaders takes the client address, scheme and host from X-Forwarded-* headers. It is only safe behind a
+	// proxy overwriting them, as clients reaching the registry directly could otherwise set them to anything.
+	TrustProxyHeaders bool          `mapstructure:"trust_proxy_headers" yaml:"trust_proxy_headers"`
+	DrainTimeout      time.Duration `mapstructure:"drain_timeout" yaml:"drain_timeout"`
+	ShutdownDelay     time.Duration `mapstructure:"shutdown_delay" yaml:"shutdown_delay"`
+}
+
+// TLSConfig configures server certificates and optional client certificate authentication
+type TLSConfig struct {
+	CertificateFiles []string         `mapstructure:"certificate_files" yaml:"certificate_files"`
+	KeyFiles         []string         `mapstructure:"key_files" yaml:"key_files"`
+	ReloadInterval   time.Duration    `mapstructure:"reload_interval" yaml:"reload_interval"`
+	ClientAuth       ClientAuthConfig `mapstructure:"client_auth" yaml:"client_auth"`
+}
+
+// ClientAuthConfig configures mutual TLS. Client authentication is enabled when a CA file is set.
+type ClientAuthConfig struct {
+	CAFile            string        `mapstructure:"ca_file" yaml:"ca_file"`
+	CRLFiles          []string      `mapstructure:"crl_files" yaml:"crl_files"`
+	CRLReloadInterval time.Duration `mapstructure:"crl_reload_interval" yaml:"crl_reload_interval"`
+	IdentitySource    string        `mapstructure:"identity_source" yaml:"identity_source"`
+}
+
+// DatabaseConfig selects and configures the database backend
+type DatabaseConfig struct {
+	Backend    string                   `mapstructure:"backend" yaml:"backend"`
+	Filesystem FilesystemDatabaseConfig `mapstructure:"filesystem" yaml:"filesystem"`
+}
+
+// FilesystemDatabaseConfig configures the filesystem database backend which indexes modules found on disk
+type FilesystemDatabaseConfig struct {
+	Root string `mapstructure:"root" yaml:"root"`
+}
+
+// StorageConfig selects and configures the module storage backend
+type StorageConfig struct {
+	Backend    string                  `mapstructure:"backend" yaml:"backend"`
+	Filesystem FilesystemStorageConfig `mapstructure:"filesystem" yaml:"filesystem"`
+}
+
+// FilesystemStorageConfig configures the filesystem storage backend serving module archives from disk
+type FilesystemStorageConfig struct {
+	Root string `mapstructure:"root" yaml:"root"`
+}
+
+// AuthConfig configures authentication and authorization. Without any authentication configured the registry is read
+// only: anyone may read modules and nobody may publish, change or delete them.
+type AuthConfig struct {
+	OIDC     OIDCConfig `mapstructure:"oidc" yaml:"oidc"`
+	RBACFile string     `mapstructure:"rbac_file" yaml:"rbac_file"`
+}
+
+// OIDCConfig configures OIDC bearer token authentication. Authentication is enabled when an issuer is set.
+type OIDCConfig struct {
+	Issuer     string `mapstructure:"issuer" yaml:"issuer"`
+	Audience   string `mapstructure:"audience" yaml:"audience"`
+	JWKSURL    string `mapstructure:"jwks_url" yaml:"jwks_url"`
+	JWKSFile   string `mapstructure:"jwks_file" yaml:"jwks_file"`
+	PolicyFile string `mapstructure:"policy_file" yaml:"policy_file"`
+	TeamsClaim string `mapstructure:"teams_claim" yaml:"teams_claim"`
+}
+
+// LoggingConfig configures logging
+type LoggingConfig struct {
+	// Level is the minimum level logged, one of trace, debug, info, warn or error
+	Level string `mapstructure:"level" yaml:"level"`
+	// Format is either text or json
+	Format    string `mapstructure:"format" yaml:"format"`
+	AccessLog bool   `mapstructure:"access_log" yaml:"access_log"`
+}
+
+// MetricsConfig configures the Prometheus /metrics endpoint
+type MetricsConfig struct {
+	Enabled         bool `mapstructure:"enabled" yaml:"enabled"`
+	ModuleDownloads bool `mapstructure:"module_downloads" yaml:"module_downloads"`
+}
+
+// TracingConfig configures export of OpenTelemetry traces over OTLP/HTTP
+type TracingConfig struct {
+	Enabled     bool    `mapstructure:"enabled" yaml:"enabled"`
+	Endpoint    string  `mapstructure:"endpoint" yaml:"endpoint"`
+	Insecure    bool    `mapstructure:"insecure" yaml:"insecure"`
+	ServiceName string  `mapstructure:"service_name" yaml:"service_name"`
+	SampleRatio float64 `mapstructure:"sample_ratio" yaml:"sample_ratio"`
+}
+
+// SigningConfig configures verification of module archive signatures
+type SigningConfig struct {
+	// TrustedKeysFile lists the public keys trusted to sign archives per organization
+	TrustedKeysFile string `mapstructure:"trusted_keys_file" yaml:"trusted_keys_file"`
+	// RequireSigned refuses to publish or serve module versions without a verified signature
+	RequireSigned bool `mapstructure:"require_signed" yaml:"require_signed"`
+}
+
+// PolicyConfig configures the checks modules must pass to be published
+type PolicyConfig struct {
+	// RulesDir holds a rules file per organization named after it, such as acme.yaml. Organizations without a rules
+	// file are not checked.
+	RulesDir string `mapstructure:"rules_dir" yaml:"rules_dir"`
+}
+
+// ApprovalConfig configures which modules need new versions approved before they are served
+type ApprovalConfig struct {
+	// RequiredFor lists organization/name/provider patterns as understood by path.Match, such as acme/*/*
+	RequiredFor []string `mapstructure:"required_for" yaml:"required_for"`
+}
+
+// WebhooksConfig configures delivery of registry events to webhook endpoints
+type WebhooksConfig struct {
+	// EndpointsFile lists the endpoints events are delivered to. Webhooks are disabled when it is not set.
+	EndpointsFile string `mapstructure:"endpoints_file" yaml:"endpoints_file"`
+	// MaxAttempts is the number of times a delivery is sent before it is given up on
+	MaxAttempts int `mapstructure:"max_attempts" yaml:"max_attempts"`
+	// InitialBackoff is the wait before the first retry, doubling for every further retry up to MaxBackoff
+	InitialBackoff time.Duration `mapstructure:"initial_backoff" yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `mapstructure:"max_backoff" yaml:"max_backoff"`
+	Timeout        time.Duration `mapstructure:"timeout" yaml:"timeout"`
+}
+
+// RateLimitConfig configures rate limiting of requests per client and bandwidth quotas of archive downloads per
+// organization
+type RateLimitConfig struct {
+	Enabled bool `mapstructure:"enabled" yaml:"enabled"`
+	// Classes sets the limit of every client per class of route: protocol, archive, publish, admin or events
+	Classes map[string]RateLimitClassConfig `mapstructure:"classes" yaml:"classes"`
+	Quotas  QuotasConfig                    `mapstructure:"quotas" yaml:"quotas"`
+}
+
+// RateLimitClassConfig is a token bucket. Requests of a class with a rate of zero are not limited.
+type RateLimitClassConfig struct {
+	// Rate is the number of requests allowed per second on average
+	Rate float64 `mapstructure:"rate" yaml:"rate"`
+	// Burst is the number of requests allowed at once
+	Burst int `mapstructure:"burst" yaml:"burst"`
+}
+
+// QuotasConfig sets how many archive bytes organizations may serve
+type QuotasConfig struct {
+	// Default applies to organizations not listed in Organizations
+	Default       QuotaConfig            `mapstructure:"default" yaml:"default"`
+	Organizations map[string]QuotaConfig `mapstructure:"organizations" yaml:"organizations"`
+}
+
+// QuotaConfig allows serving Bytes of archives per Period. Downloads are not limited by a quota of zero bytes.
+type QuotaConfig struct {
+	Bytes  int64         `mapstructure:"bytes" yaml:"bytes"`
+	Period time.Duration `mapstructure:"period" yaml:"period"`
+}
+
+// CacheConfig configures in memory caching of archives and version lists in front of the storage and database
+// backends
+type CacheConfig struct {
+	Enabled bool `mapstructure:"enabled" yaml:"enabled"`
+	// ArchiveBytes bounds the total size of the archives cached
+	ArchiveBytes int64 `mapstructure:"archive_bytes" yaml:"archive_bytes"`
+	// VersionsTTL is how long version lists are cached. Changes made through other registry instances sharing the
+	// backends are seen once it expires.
+	VersionsTTL time.Duration `mapstructure:"versions_ttl" yaml:"versions_ttl"`
+}
+
+// Defaults returns the configuration used for any key that is not set
+func Defaults() *Config {
+	return &Config{
+		Listener: ListenerConfig{
+			Port:          443,
+			DrainTimeout:  30 * time.Second,
+			ShutdownDelay: 5 * time.Second,
+		},
+		TLS: TLSConfig{
+			ReloadInterval: 30 * time.Second,
+			ClientAuth: ClientAuthConfig{
+				CRLReloadInterval: 5 * time.Minute,
+				IdentitySource:    string(mtls.IdentityFromSubject),
+			},
+		},
+		Database: DatabaseConfig{
+			Backend: "filesystem",
+			Filesystem: FilesystemDatabaseConfig{
+				Root: "/terrarium/store",
+			},
+		},
+		Storage: StorageConfig{
+			Backend: "filesystem",
+			Filesystem: FilesystemStorageConfig{
+				Root: "/terrarium/store",
+			},
+		},
+		Logging: LoggingConfig{
+			Level:     "info",
+			Format:    "text",
+			AccessLog: true,
+		},
+		Metrics: MetricsConfig{
+			Enabled: true,
+		},
+		Tracing: TracingConfig{
+			Endpoint:    "localhost:4318",
+			Insecure:    true,
+			ServiceName: "terrarium",
+			SampleRatio: 1,
+		},
+		Webhooks: WebhooksConfig{
+			MaxAttempts:    10,
+			InitialBackoff: 10 * time.Second,
+			MaxBackoff:     time.Hour,
+			Timeout:        10 * time.Second,
+		},
+		RateLimit: RateLimitConfig{
+			Classes: map[string]RateLimitClassConfig{
+				string(ratelimit.ClassProtocol): {Rate: 20, Burst: 100},
+				string(ratelimit.ClassArchive):  {Rate: 5, Burst: 30},
+				string(ratelimit.ClassPublish):  {Rate: 1, Burst: 10},
+				string(ratelimit.ClassAdmin):    {Rate: 5, Burst: 20},
+				string(ratelimit.ClassEvents):   {Rate: 1, Burst: 10},
+			},
+			Quotas: QuotasConfig{
+				Default: QuotaConfig{
+					Period: 24 * time.Hour,
+				},
+			},
+		},
+		Cache: CacheConfig{
+			ArchiveBytes: 256 << 20,
+			VersionsTTL:  30 * time.Second,
+		},
+	}
+}
+
+// SetDefaults registers the defaults with viper so that every key is known and can be set through the environment
+func SetDefaults(v *viper.Viper) {
+	d := Defaults()
+	v.SetDefault("listener.bind_address", d.Listener.BindAddress)
+	v.SetDefault("listener.port", d.Listener.Port)
+	v.SetDefault("listener.plaintext", d.Listener.Plaintext)
+	v.SetDefault("listener.trust_proxy_headers", d.Listener.TrustProxyHeaders)
+	v.SetDefault("listener.drain_timeout", d.Listener.DrainTimeout)
+	v.SetDefault("listener.shutdown_delay", d.Listener.ShutdownDelay)
+	v.SetDefault("tls.certificate_files", d.TLS.CertificateFiles)
+	v.SetDefault("tls.key_files", d.TLS.KeyFiles)
+	v.SetDefault("tls.reload_interval", d.TLS.ReloadInterval)
+	v.SetDefault("tls.client_auth.ca_file", d.TLS.ClientAuth.CAFile)
+	v.SetDefault("tls.client_auth.crl_files", d.TLS.ClientAuth.CRLFiles)
+	v.SetDefault("tls.client_auth.crl_reload_interval", d.TLS.ClientAuth.CRLReloadInterval)
+	v.SetDefault("tls.client_auth.identity_source", d.TLS.ClientAuth.IdentitySource)
+	v.SetDefault("database.backend", d.Database.Backend)
+	v.SetDefault("database.filesystem.root", d.Database.Filesystem.Root)
+	v.SetDefault("storage.backend", d.Storage.Backend)
+	v.SetDefault("storage.filesystem.root", d.Storage.Filesystem.Root)
+	v.SetDefault("auth.oidc.issuer", d.Auth.OIDC.Issuer)
+	v.SetDefault("auth.oidc.audience", d.Auth.OIDC.Audience)
+	v.SetDefault("auth.oidc.jwks_url", d.Auth.OIDC.JWKSURL)
+	v.SetDefault("auth.oidc.jwks_file", d.Auth.OIDC.JWKSFile)
+	v.SetDefault("auth.oidc.policy_file", d.Auth.OIDC.PolicyFile)
+	v.SetDefault("auth.oidc.teams_claim", d.Auth.OIDC.TeamsClaim)
+	v.SetDefault("auth.rbac_file", d.Auth.RBACFile)
+	v.SetDefault("logging.level", d.Logging.Level)
+	v.SetDefault("logging.format", d.Logging.Format)
+	v.SetDefault("logging.access_log", d.Logging.AccessLog)
+	v.SetDefault("metrics.enabled", d.Metrics.Enabled)
+	v.SetDefault("metrics.module_downloads", d.Metrics.ModuleDownloads)
+	v.SetDefault("tracing.enabled", d.Tracing.Enabled)
+	v.SetDefault("tracing.endpoint", d.Tracing.Endpoint)
+	v.SetDefault("tracing.insecure", d.Tracing.Insecure)
+	v.SetDefault("tracing.service_name", d.Tracing.ServiceName)
+	v.SetDefault("tracing.sample_ratio", d.Tracing.SampleRatio)
+	v.SetDefault("signing.trusted_keys_file", d.Signing.TrustedKeysFile)
+	v.SetDefault("signing.require_signed", d.Signing.RequireSigned)
+	v.SetDefault("policy.rules_dir", d.Policy.RulesDir)
+	v.SetDefault("approval.required_for", d.Approval.RequiredFor)
+	v.SetDefault("webhooks.endpoints_file", d.Webhooks.EndpointsFile)
+	v.SetDefault("webhooks.max_attempts", d.Webhooks.MaxAttempts)
+	v.SetDefault("webhooks.initial_backoff", d.Webhooks.InitialBackoff)
+	v.SetDefault("webhooks.max_backoff", d.Webhooks.MaxBackoff)
+	v.SetDefault("webhooks.timeout", d.Webhooks.Timeout)
+	v.SetDefault("rate_limit.enabled", d.RateLimit.Enabled)
+	// Classes are set key by key so that a config file changing one setting of a class keeps the defaults of the rest
+	for class, limit := range d.RateLimit.Classes {
+		v.SetDefault("rate_limit.classes."+class+".rate", limit.Rate)
+		v.SetDefault("rate_limit.classes."+class+".burst", limit.Burst)
+	}
+	v.SetDefault("rate_limit.quotas.default.bytes", d.RateLimit.Quotas.Default.Bytes)
+	v.SetDefault("rate_limit.quotas.default.period", d.RateLimit.Quotas.Default.Period)
+	v.SetDefault("cache.enabled", d.Cache.Enabled)
+	v.SetDefault("cache.archive_bytes", d.Cache.ArchiveBytes)
+	v.SetDefault("cache.versions_ttl", d.Cache.VersionsTTL)
+}
+
+// ConfigureEnv makes viper resolve keys from TERRARIUM_* environment variables
+func ConfigureEnv(v *viper.Viper) {
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+}
+
+// Load resolves the configuration from viper and validates it
+func Load(v *viper.Viper) (*Config, error) {
+	cfg := &Config{}
+	if err := v.Unmarshal(cfg); err != nil {
+		return nil, fmt.Errorf("failed reading configuration - %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// ValidationError lists every problem found in a configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid configuration:\n  - %s", strings.Join(e.Problems, "\n  - "))
+}
+
+// Validate checks the configuration is complete and consistent, reporting every problem found at once
+func (c *Config) Validate() error {
+	var problems []string
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	fileExists := func(key string, path string) {
+		if path == "" {
+			return
+		}
+		if _, err := os.Stat(path); err != nil {
+			report("%s: cannot read %s - %s", key, path, errors.Unwrap(err))
+		}
+	}
+
+	if c.Listener.Port < 1 || c.Listener.Port > 65535 {
+		report("listener.port must be between 1 and 65535, got %d", c.Listener.Port)
+	}
+
+	if c.Listener.DrainTimeout <= 0 {
+		report("listener.drain_timeout must be greater than zero")
+	}
+	if c.Listener.ShutdownDelay < 0 {
+		report("listener.shutdown_delay must not be negative")
+	}
+
+	if !c.Listener.Plaintext {
+		if len(c.TLS.CertificateFiles) == 0 {
+			report("tls.certificate_files must list at least one certificate unless listener.plaintext is enabled")
+		}
+		if len(c.TLS.KeyFiles) == 0 {
+			report("tls.key_files must list at least one private key unless listener.plaintext is enabled")
+		}
+	}
+	if len(c.TLS.CertificateFiles) != len(c.TLS.KeyFiles) {
+		report("tls.certificate_files and tls.key_files must have the same number of entries, got %d and %d", len(c.TLS.CertificateFiles), len(c.TLS.KeyFiles))
+	}
+	for i, certFile := range c.TLS.CertificateFiles {
+		fileExists(fmt.Sprintf("tls.certificate_files[%d]", i), certFile)
+	}
+	for i, keyFile := range c.TLS.KeyFiles {
+		fileExists(fmt.Sprintf("tls.key_files[%d]", i), keyFile)
+	}
+	if c.TLS.ReloadInterval < 0 {
+		report("tls.reload_interval must not be negative")
+	}
+
+	if c.TLS.ClientAuth.CAFile != "" {
+		if c.Listener.Plaintext {
+			report("tls.client_auth.ca_file requires TLS and cannot be used with listener.plaintext")
+		}
+		fileExists("tls.client_auth.ca_file", c.TLS.ClientAuth.CAFile)
+		for i, crlFile := range c.TLS.ClientAuth.CRLFiles {
+			fileExists(fmt.Sprintf("tls.client_auth.crl_files[%d]", i), crlFile)
+		}
+		switch mtls.IdentitySource(c.TLS.ClientAuth.IdentitySource) {
+		case mtls.IdentityFromSubject, mtls.IdentityFromSAN:
+		default:
+			report("tls.client_auth.identity_source must be one of %s or %s, got %q", mtls.IdentityFromSubject, mtls.IdentityFromSAN, c.TLS.ClientAuth.IdentitySource)
+		}
+	}
+
+	if _, err := logrus.ParseLevel(c.Logging.Level); err != nil {
+		report("logging.level must be one of trace, debug, info, warn or error, got %q", c.Logging.Level)
+	}
+	switch c.Logging.Format {
+	case "text", "json":
+	default:
+		report("logging.format must be text or json, got %q", c.Logging.Format)
+	}
+
+	switch c.Database.Backend {
+	case "filesystem":
+		if c.Database.Filesystem.Root == "" {
+			report("database.filesystem.root must be set for the filesystem database backend")
+		}
+	default:
+		report("database.backend must be filesystem, got %q", c.Database.Backend)
+	}
+
+	switch c.Storage.Backend {
+	case "filesystem":
+		if c.Storage.Filesystem.Root == "" {
+			report("storage.filesystem.root must be set for the filesystem storage backend")
+		}
+	default:
+		report("storage.backend must be filesystem, got %q", c.Storage.Backend)
+	}
+
+	if c.Auth.OIDC.Issuer != "" {
+		if c.Auth.OIDC.Audience == "" {
+			report("auth.oidc.audience must be set when auth.oidc.issuer is set")
+		}
+		if c.Auth.OIDC.PolicyFile == "" {
+			report("auth.oidc.policy_file must be set when auth.oidc.issuer is set")
+		}
+		fileExists("auth.oidc.policy_file", c.Auth.OIDC.PolicyFile)
+		fileExists("auth.oidc.jwks_file", c.Auth.OIDC.JWKSFile)
+	}
+	fileExists("auth.rbac_file", c.Auth.RBACFile)
+	if c.Auth.RBACFile != "" && c.Auth.OIDC.Issuer == "" && c.TLS.ClientAuth.CAFile == "" {
+		// Roles bound to identities nobody can authenticate as would leave the registry closed to everyone
+		report("auth.rbac_file requires an authentication method, set auth.oidc.issuer or tls.client_auth.ca_file")
+	}
+
+	if c.Tracing.Enabled {
+		if c.Tracing.Endpoint == "" {
+			report("tracing.endpoint must be set when tracing is enabled")
+		}
+		if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+			report("tracing.sample_ratio must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+		}
+	}
+
+	fileExists("signing.trusted_keys_file", c.Signing.TrustedKeysFile)
+	if c.Signing.RequireSigned && c.Signing.TrustedKeysFile == "" {
+		report("signing.require_signed requires signing.trusted_keys_file")
+	}
+
+	if c.Policy.RulesDir != "" {
+		if info, err := os.Stat(c.Policy.RulesDir); err != nil {
+			report("policy.rules_dir: cannot read %s - %s", c.Policy.RulesDir, errors.Unwrap(err))
+		} else if !info.IsDir() {
+			report("policy.rules_dir: %s is not a directory", c.Policy.RulesDir)
+		}
+	}
+
+	for _, pattern := range c.Approval.RequiredFor {
+		if _, err := path.Match(pattern, ""); err != nil || strings.Count(pattern, "/") != 2 {
+			report("approval.required_for: %q must be an organization/name/provider pattern", pattern)
+		}
+	}
+
+	if c.Webhooks.EndpointsFile != "" {
+		fileExists("webhooks.endpoints_file", c.Webhooks.EndpointsFile)
+		if c.Webhooks.MaxAttempts < 1 {
+			report("webhooks.max_attempts must be at least 1, got %d", c.Webhooks.MaxAttempts)
+		}
+		if c.Webhooks.InitialBackoff <= 0 {
+			report("webhooks.initial_backoff must be greater than zero")
+		}
+		if c.Webhooks.MaxBackoff < c.Webhooks.InitialBackoff {
+			report("webhooks.max_backoff must not be less than webhooks.initial_backoff")
+		}
+		if c.Webhooks.Timeout <= 0 {
+			report("webhooks.timeout must be greater than zero")
+		}
+	}
+
+	if c.RateLimit.Enabled {
+		classes := make([]string, 0, len(c.RateLimit.Classes))
+		for class := range c.RateLimit.Classes {
+			classes = append(classes, class)
+		}
+		sort.Strings(classes)
+		for _, class := range classes {
+			limit := c.RateLimit.Classes[class]
+			known := false
+			for _, candidate := range ratelimit.Classes {
+				known = known || string(candidate) == class
+			}
+			if !known {
+				report("rate_limit.classes: unknown class %q", class)
+			}
+			if limit.Rate < 0 {
+				report("rate_limit.classes.%s.rate must not be negative", class)
+			}
+			if limit.Rate > 0 && limit.Burst < 1 {
+				report("rate_limit.classes.%s.burst must be at least 1", class)
+			}
+		}
+		quotas := map[string]QuotaConfig{"default": c.RateLimit.Quotas.Default}
+		keys := []string{"default"}
+		for orgName, quota := range c.RateLimit.Quotas.Organizations {
+			quotas["organizations."+orgName] = quota
+			keys = append(keys, "organizations."+orgName)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			quota := quotas[key]
+			if quota.Bytes < 0 {
+				report("rate_limit.quotas.%s.bytes must not be negative", key)
+			}
+			if quota.Bytes > 0 && quota.Period <= 0 {
+				report("rate_limit.quotas.%s.period must be greater than zero", key)
+			}
+		}
+	}
+
+	if c.Cache.Enabled {
+		if c.Cache.ArchiveBytes < 0 {
+			report("cache.archive_bytes must not be negative")
+		}
+		if c.Cache.VersionsTTL < 0 {
+			report("cache.versions_ttl must not be negative")
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateAuth(t *testing.T) {
+	dir := t.TempDir()
+	file := func(name string) string {
+		name = filepath.Join(dir, name)
+		if err := os.WriteFile(name, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return name
+	}
+	rbacFile, policyFile, caFile, certFile, keyFile := file("rbac.yaml"), file("policy.yaml"), file("ca.crt"), file("tls.crt"), file("tls.key")
+	oidc := func(c *Config) {
+		c.Auth.OIDC.Issuer = "https://issuer.example.com"
+		c.Auth.OIDC.Audience = "terrarium"
+		c.Auth.OIDC.PolicyFile = policyFile
+	}
+	mtls := func(c *Config) {
+		c.Listener.Plaintext = false
+		c.TLS.CertificateFiles = []string{certFile}
+		c.TLS.KeyFiles = []string{keyFile}
+		c.TLS.ClientAuth.CAFile = caFile
+	}
+	rbac := func(c *Config) {
+		c.Auth.RBACFile = rbacFile
+	}
+
+	tests := []struct {
+		name    string
+		configs []func(*Config)
+		want    []string
+	}{
+		{"no authentication", nil, nil},
+		{"oidc", []func(*Config){oidc}, nil},
+		{"rbac with oidc", []func(*Config){oidc, rbac}, nil},
+		{"rbac with client certificates", []func(*Config){mtls, rbac}, nil},
+
+		{"rbac without authentication", []func(*Config){rbac}, []string{"auth.rbac_file requires an authentication method"}},
+		{"missing rbac file", []func(*Config){oidc, func(c *Config) { c.Auth.RBACFile = filepath.Join(dir, "missing.yaml") }}, []string{"auth.rbac_file: cannot read"}},
+		{"oidc without audience and policy", []func(*Config){func(c *Config) { c.Auth.OIDC.Issuer = "https://issuer.example.com" }}, []string{"auth.oidc.audience must be set", "auth.oidc.policy_file must be set"}},
+		{"client certificates over plaintext", []func(*Config){func(c *Config) { c.TLS.ClientAuth.CAFile = caFile }}, []string{"tls.client_auth.ca_file requires TLS"}},
+		{"unknown identity source", []func(*Config){mtls, func(c *Config) { c.TLS.ClientAuth.IdentitySource = "email" }}, []string{`tls.client_auth.identity_source must be one of subject or san, got "email"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Defaults()
+			c.Listener.Plaintext = true
+			for _, configure := range tt.configs {
+				configure(c)
+			}
+			err := c.Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() unexpected error: %v", err)
+				}
+				return
+			}
+			var invalid *ValidationError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("Validate() error = %v, want a ValidationError", err)
+			}
+			if len(invalid.Problems) != len(tt.want) {
+				t.Fatalf("Validate() problems = %q, want %d", invalid.Problems, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(invalid.Problems[i], want) {
+					t.Fatalf("Validate() problem %d = %q, want it to contain %q", i, invalid.Problems[i], want)
+				}
+			}
+		})
+	}
+}
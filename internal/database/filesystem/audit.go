@@ -0,0 +1,125 @@
+package filesystem
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/audit"
+)
+
+const auditFile string = "audit.jsonl"
+
+// maxAuditLine bounds the size of a single audit record read back from the trail
+const maxAuditLine int = 1 << 20
+
+// fsAuditBackend appends audit events to a JSON lines file which is only ever appended to. Queries scan the file so
+// that the trail on disk remains the single record of what happened.
+type fsAuditBackend struct {
+	path   string
+	logger logrus.FieldLogger
+	mu     sync.Mutex
+	file   *os.File
+}
+
+func newAuditBackend(modulesPath string, logger logrus.FieldLogger) *fsAuditBackend {
+	return &fsAuditBackend{
+		path:   filepath.Join(modulesPath, stateDirectory, auditFile),
+		logger: logger,
+	}
+}
+
+// RecordEvent appends an event to the audit trail and syncs it to disk, creating the file on first use
+func (s *fsAuditBackend) RecordEvent(ctx context.Context, event *audit.Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+			return fmt.Errorf("failed creating state directory - %w", err)
+		}
+		s.file, err = os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return fmt.Errorf("failed opening audit trail - %w", err)
+		}
+	}
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed writing audit trail - %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("failed syncing audit trail - %w", err)
+	}
+	return nil
+}
+
+// ReadEvents scans the audit trail for matching events. With a limit only the most recent matches are kept.
+func (s *fsAuditBackend) ReadEvents(ctx context.Context, filter *audit.Filter) ([]*audit.Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	// Holding the lock keeps scans from reading a partially appended line
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := make([]*audit.Event, 0)
+	file, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return events, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed opening audit trail - %w", err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxAuditLine)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if line%1000 == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		event := &audit.Event{}
+		if err := json.Unmarshal(scanner.Bytes(), event); err != nil {
+			s.logger.WithError(err).WithField("line", line).Warn("ignoring invalid audit record")
+			continue
+		}
+		if !filter.Matches(event) {
+			continue
+		}
+		events = append(events, event)
+		if filter.Limit > 0 && len(events) > 2*filter.Limit {
+			events = append(events[:0], events[len(events)-filter.Limit:]...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed reading audit trail - %w", err)
+	}
+	if filter.Limit > 0 && len(events) > filter.Limit {
+		events = events[len(events)-filter.Limit:]
+	}
+	return events, nil
+}
+
+func (s *fsAuditBackend) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
@@ -0,0 +1,159 @@
+package filesystem
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/modules"
+)
+
+const checksumsFile string = "checksums.json"
+
+// VerifyReport lists the outcome of comparing every archive against its recorded checksum, by source path
+type VerifyReport struct {
+	Verified []string
+	// Mismatched archives changed on disk after their checksum was recorded
+	Mismatched []string
+	// Missing archives have a recorded checksum but no longer exist
+	Missing []string
+	// Unrecorded archives were added since the registry last indexed the modules path
+	Unrecorded []string
+	// Invalid archives failed validation and are not served, their Validation carries the reason. Invalid archives
+	// which were valid when their checksum was recorded are also listed as mismatched.
+	Invalid []*modules.Module
+}
+
+// Tampered reports whether any archive changed or disappeared since its checksum was recorded
+func (r *VerifyReport) Tampered() bool {
+	return len(r.Mismatched) > 0 || len(r.Missing) > 0
+}
+
+// fileChecksum returns the hex encoded SHA-256 of a file
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func loadChecksums(path string) (map[string]string, error) {
+	checksums := map[string]string{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return checksums, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed reading checksums - %w", err)
+	}
+	if err := json.Unmarshal(data, &checksums); err != nil {
+		return nil, fmt.Errorf("failed parsing checksums %s - %w", path, err)
+	}
+	return checksums, nil
+}
+
+// recordChecksums sets the checksum of every indexed module and returns the sources of the archives which no longer
+// match their recorded checksum. Versions seen for the first time have their checksum recorded, versions whose archive
+// changed since keep the recorded checksum so that the change is detected when the archive is downloaded rather than
+// silently served. Invalid archives are never recorded, but are checked against a checksum recorded while they were
+// valid so that tampering which also broke the archive is not mistaken for a mere invalid archive.
+func recordChecksums(modulesPath string, checksumsPath string, indexed []*modules.Module, invalid []*modules.Module, logger logrus.FieldLogger) ([]string, error) {
+	recorded, err := loadChecksums(checksumsPath)
+	if err != nil {
+		return nil, err
+	}
+	var tampered []string
+	changed := false
+	for _, module := range append(append([]*modules.Module(nil), indexed...), invalid...) {
+		current, err := fileChecksum(filepath.Join(modulesPath, module.Source))
+		if err != nil {
+			return nil, fmt.Errorf("failed computing checksum of %s - %w", module.Source, err)
+		}
+		previous, ok := recorded[module.Source]
+		switch {
+		case !ok && module.Validation.Valid:
+			recorded[module.Source] = current
+			changed = true
+		case ok && previous != current:
+			tampered = append(tampered, module.Source)
+			logger.WithFields(logrus.Fields{"path": module.Source, "recorded": previous, "current": current}).
+				Error("archive does not match its recorded checksum, downloads of this version will be refused")
+		}
+		module.Checksum = recorded[module.Source]
+	}
+	if !changed {
+		return tampered, nil
+	}
+	return tampered, writeJSONFile(checksumsPath, recorded)
+}
+
+// Verify compares every archive under the modules path against the checksums recorded by the registry without
+// modifying any state. It detects archives replaced or removed on disk behind the registry's back.
+func Verify(modulesPath string) (*VerifyReport, error) {
+	recorded, err := loadChecksums(filepath.Join(modulesPath, stateDirectory, checksumsFile))
+	if err != nil {
+		return nil, err
+	}
+	quiet := logrus.New()
+	quiet.SetOutput(io.Discard)
+	indexed, invalid, err := loadFromPath(modulesPath, quiet)
+	if err != nil {
+		return nil, err
+	}
+	report := &VerifyReport{Invalid: invalid}
+	for _, module := range append(append([]*modules.Module(nil), indexed...), invalid...) {
+		previous, ok := recorded[module.Source]
+		delete(recorded, module.Source)
+		if !ok {
+			// Invalid archives are never recorded, they are reported as invalid only
+			if module.Validation.Valid {
+				report.Unrecorded = append(report.Unrecorded, module.Source)
+			}
+			continue
+		}
+		current, err := fileChecksum(filepath.Join(modulesPath, module.Source))
+		if err != nil {
+			return nil, fmt.Errorf("failed computing checksum of %s - %w", module.Source, err)
+		}
+		if current == previous {
+			report.Verified = append(report.Verified, module.Source)
+		} else {
+			report.Mismatched = append(report.Mismatched, module.Source)
+		}
+	}
+	for source := range recorded {
+		report.Missing = append(report.Missing, source)
+	}
+	sort.Strings(report.Mismatched)
+	sort.Strings(report.Missing)
+	return report, nil
+}
+
+// writeJSONFile writes to a temporary file first so that a crash never leaves a truncated file behind
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed creating state directory - %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed writing %s - %w", path, err)
+	}
+	return os.Rename(tmp, path)
+}
@@ -3,35 +3,93 @@ package filesystem
 import (
 	"context"
 	"fmt"
+	"github.com/sirupsen/logrus"
+	"github.com/terrariumcloud/terrarium-lite/internal/archive"
 	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/modules"
 	"github.com/terrariumcloud/terrarium-lite/pkg/registry/stores"
-	"log"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 )
 
 type adapter struct {
+	modulesPath   string
 	moduleBackend fsModuleBackend
+	statsBackend  *fsStatsBackend
+	auditBackend  *fsAuditBackend
+	hookBackend   *fsWebhookBackend
+	eventBackend  *fsEventBackend
 }
 
 func (m *adapter) Connect(_ context.Context) error {
 	return nil
 }
 
+func (m *adapter) Close() error {
+	statsErr := m.statsBackend.Close()
+	if err := m.auditBackend.Close(); err != nil {
+		return err
+	}
+	return statsErr
+}
+
+// HealthCheck reports the driver as unhealthy when the modules path can no longer be listed, for example when the
+// volume holding it was unmounted. The index is loaded by New, so a driver never exists without one.
+func (m *adapter) HealthCheck(_ context.Context) error {
+	dir, err := os.Open(m.modulesPath)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	if _, err := dir.Readdirnames(1); err != nil && err != io.EOF {
+		return fmt.Errorf("failed listing %s - %w", m.modulesPath, err)
+	}
+	return nil
+}
+
+// IndexProblems returns the archives found on disk which are not served
+func (m *adapter) IndexProblems() []*modules.IndexProblem {
+	return m.moduleBackend.IndexProblems()
+}
+
+// IndexSize returns the number of module versions found on disk
+func (m *adapter) IndexSize() int {
+	return m.moduleBackend.IndexSize()
+}
+
 func (m *adapter) Modules() stores.ModuleStore {
 	return &m.moduleBackend
 }
 
-func loadFromPath(modulesPath string) ([]*modules.Module, error) {
+func (m *adapter) Stats() stores.StatsStore {
+	return m.statsBackend
+}
+
+func (m *adapter) Audit() stores.AuditStore {
+	return m.auditBackend
+}
+
+func (m *adapter) Webhooks() stores.WebhookStore {
+	return m.hookBackend
+}
+
+func (m *adapter) Events() stores.EventLogStore {
+	return m.eventBackend
+}
+
+// loadFromPath indexes every archive under the modules path. Archives failing validation are returned separately,
+// carrying the reason, so that they are never served.
+func loadFromPath(modulesPath string, logger logrus.FieldLogger) ([]*modules.Module, []*modules.Module, error) {
 	allModules := make([]*modules.Module, 0)
+	invalid := make([]*modules.Module, 0)
 
 	matches, _ := filepath.Glob(fmt.Sprintf("%s/*/*/*/*.zip", modulesPath))
 
 	for _, name := range matches {
 		sourcePath, err := filepath.Rel(modulesPath, name)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		elements := strings.Split(sourcePath, string(os.PathSeparator))
@@ -41,24 +99,89 @@ func loadFromPath(modulesPath string) ([]*modules.Module, error) {
 				Organization: elements[0],
 				Provider:     elements[2],
 				Version:      elements[3][:len(elements[3])-4], // remove .zip from the version name.
+				Source:       sourcePath,
+			}
+			validation, err := archive.ValidateFile(name, archive.DefaultLimits)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed validating %s - %w", sourcePath, err)
+			}
+			module.Validation = validation
+			if !validation.Valid {
+				invalid = append(invalid, &module)
+				logger.WithFields(logrus.Fields{"path": name, "reason": validation.Reason}).Warn("skipping invalid module archive")
+				continue
 			}
 			allModules = append(allModules, &module)
-			log.Printf("INFO: Added module %s", name)
+			logger.WithField("path", name).Info("added module")
 		} else {
-			log.Printf("WARN: Ignoring invalid module path: %s", name)
+			logger.WithField("path", name).Warn("ignoring invalid module path")
 		}
 	}
-	return allModules, nil
+	return allModules, invalid, nil
 }
 
-func New(modulesPath string) (*adapter, error) {
-	if allModules, err := loadFromPath(modulesPath); err != nil {
+// indexProblems lists the archives which failed validation, with the reason, and those which no longer match their
+// recorded checksum
+func indexProblems(invalid []*modules.Module, tampered []string) map[string]*modules.IndexProblem {
+	problems := map[string]*modules.IndexProblem{}
+	for _, module := range invalid {
+		problems[module.Source] = &modules.IndexProblem{Source: module.Source, Reason: module.Validation.Reason}
+	}
+	for _, source := range tampered {
+		problem, ok := problems[source]
+		if !ok {
+			problem = &modules.IndexProblem{Source: source, Reason: "archive does not match its recorded checksum"}
+			problems[source] = problem
+		}
+		problem.Tampered = true
+	}
+	return problems
+}
+
+func New(modulesPath string, logger logrus.FieldLogger) (*adapter, error) {
+	if allModules, invalid, err := loadFromPath(modulesPath, logger); err != nil {
 		return nil, err
 	} else {
+		statsBackend, err := newStatsBackend(modulesPath, logger)
+		if err != nil {
+			return nil, err
+		}
+		hookBackend, err := newWebhookBackend(modulesPath)
+		if err != nil {
+			return nil, err
+		}
+		eventBackend, err := newEventBackend(modulesPath, logger)
+		if err != nil {
+			return nil, err
+		}
 		driver := &adapter{
+			modulesPath: modulesPath,
 			moduleBackend: fsModuleBackend{
-				modules: allModules,
+				modules:        allModules,
+				lifecyclePath:  filepath.Join(modulesPath, stateDirectory, lifecycleFile),
+				deletionsPath:  filepath.Join(modulesPath, stateDirectory, deletionsFile),
+				checksumsPath:  filepath.Join(modulesPath, stateDirectory, checksumsFile),
+				signaturesPath: filepath.Join(modulesPath, stateDirectory, signaturesFile),
+				stats:          statsBackend,
 			},
+			statsBackend: statsBackend,
+			auditBackend: newAuditBackend(modulesPath, logger),
+			hookBackend:  hookBackend,
+			eventBackend: eventBackend,
+		}
+		if err := driver.moduleBackend.loadLifecycles(); err != nil {
+			return nil, err
+		}
+		if err := driver.moduleBackend.loadSignatures(); err != nil {
+			return nil, err
+		}
+		tampered, err := recordChecksums(modulesPath, driver.moduleBackend.checksumsPath, allModules, invalid, logger)
+		if err != nil {
+			return nil, err
+		}
+		driver.moduleBackend.problems = indexProblems(invalid, tampered)
+		if len(driver.moduleBackend.problems) > 0 {
+			logger.WithField("archives", len(driver.moduleBackend.problems)).Warn("some module archives are not served, organization admins list them through the admin API")
 		}
 		return driver, nil
 	}
@@ -0,0 +1,137 @@
+package filesystem
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/events"
+)
+
+const eventsFile string = "events.jsonl"
+
+// maxLoggedEvents bounds how many recent events are kept for event stream clients to resume from
+const maxLoggedEvents int = 1000
+
+// fsEventBackend appends events to a JSON lines file and keeps the most recent maxLoggedEvents in memory. The file is
+// rewritten with only those once it holds twice as many so that it stays bounded without rewriting it on every event.
+type fsEventBackend struct {
+	path   string
+	logger logrus.FieldLogger
+	mu     sync.Mutex
+	logged []*events.Logged
+	lines  int
+	next   uint64
+}
+
+func newEventBackend(modulesPath string, logger logrus.FieldLogger) (*fsEventBackend, error) {
+	s := &fsEventBackend{
+		path:   filepath.Join(modulesPath, stateDirectory, eventsFile),
+		logger: logger,
+		next:   1,
+	}
+	file, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed opening event log - %w", err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxAuditLine)
+	for scanner.Scan() {
+		s.lines++
+		logged := &events.Logged{}
+		if err := json.Unmarshal(scanner.Bytes(), logged); err != nil || logged.Event == nil {
+			logger.WithField("line", s.lines).Warn("ignoring invalid event log record")
+			continue
+		}
+		s.add(logged)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed reading event log - %w", err)
+	}
+	return s, nil
+}
+
+// AppendEvent logs an event under the next sequence number, compacting the file when it has grown too large
+func (s *fsEventBackend) AppendEvent(ctx context.Context, event *events.Event) (*events.Logged, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	logged := &events.Logged{Sequence: s.next, Event: event}
+	if err := appendRecord(s.path, logged); err != nil {
+		return nil, err
+	}
+	s.lines++
+	s.add(logged)
+	if s.lines >= 2*maxLoggedEvents {
+		if err := s.compact(); err != nil {
+			// The event remains logged, compacting is retried on the next append
+			s.logger.WithError(err).Warn("failed compacting event log")
+		}
+	}
+	return logged, nil
+}
+
+// ReadEventsAfter returns the logged events following a sequence number, oldest first
+func (s *fsEventBackend) ReadEventsAfter(ctx context.Context, sequence uint64) ([]*events.Logged, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sequence >= s.next {
+		return []*events.Logged{}, false, nil
+	}
+	complete := len(s.logged) == 0 || sequence+1 >= s.logged[0].Sequence
+	following := make([]*events.Logged, 0)
+	for _, logged := range s.logged {
+		if logged.Sequence > sequence {
+			following = append(following, logged)
+		}
+	}
+	return following, complete, nil
+}
+
+// add keeps a logged event in memory, discarding the oldest beyond maxLoggedEvents
+func (s *fsEventBackend) add(logged *events.Logged) {
+	s.logged = append(s.logged, logged)
+	if len(s.logged) > maxLoggedEvents {
+		s.logged = append(s.logged[:0], s.logged[len(s.logged)-maxLoggedEvents:]...)
+	}
+	if logged.Sequence >= s.next {
+		s.next = logged.Sequence + 1
+	}
+}
+
+// compact rewrites the file with only the events kept in memory
+func (s *fsEventBackend) compact() error {
+	var buffer bytes.Buffer
+	for _, logged := range s.logged {
+		data, err := json.Marshal(logged)
+		if err != nil {
+			return err
+		}
+		buffer.Write(append(data, '\n'))
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, buffer.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed writing %s - %w", s.path, err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	s.lines = len(s.logged)
+	return nil
+}
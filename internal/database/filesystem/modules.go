@@ -1,17 +1,117 @@
 package filesystem
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
 	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/modules"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/stores"
 )
 
+const lifecycleFile string = "lifecycle.json"
+
+const deletionsFile string = "deletions.jsonl"
+
+const signaturesFile string = "signatures.json"
+
 // fsModuleBackend is a struct that implements Mongo operations for Modules
 type fsModuleBackend struct {
 	modules []*modules.Module
+	// lifecyclePath is the file version lifecycles are persisted to, keyed by the source path of the version
+	lifecyclePath string
+	// deletionsPath is the file every deletion is appended to
+	deletionsPath string
+	// checksumsPath is the file the checksum of every version is persisted to
+	checksumsPath string
+	// signaturesPath is the file signature details of signed versions are persisted to
+	signaturesPath string
+	mu             sync.RWMutex
+	lifecycles     map[string]*modules.VersionLifecycle
+	// problems are the archives found when indexing which are not served, by source path. Publishing or deleting the
+	// version resolves them.
+	problems map[string]*modules.IndexProblem
+	// stats is told about deleted versions so that their first download is reported again once published again
+	stats *fsStatsBackend
+}
+
+// loadLifecycles reads the persisted version lifecycles. A missing file means no version has a lifecycle yet.
+func (m *fsModuleBackend) loadLifecycles() error {
+	m.lifecycles = map[string]*modules.VersionLifecycle{}
+	data, err := os.ReadFile(m.lifecyclePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed reading version lifecycles - %w", err)
+	}
+	if err := json.Unmarshal(data, &m.lifecycles); err != nil {
+		return fmt.Errorf("failed parsing version lifecycles %s - %w", m.lifecyclePath, err)
+	}
+	return nil
+}
+
+func (m *fsModuleBackend) saveLifecycles() error {
+	return writeJSONFile(m.lifecyclePath, m.lifecycles)
+}
+
+// loadSignatures attaches the persisted signature details to the indexed versions
+func (m *fsModuleBackend) loadSignatures() error {
+	signatures := map[string]*modules.ModuleSignature{}
+	data, err := os.ReadFile(m.signaturesPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed reading signatures - %w", err)
+	}
+	if err := json.Unmarshal(data, &signatures); err != nil {
+		return fmt.Errorf("failed parsing signatures %s - %w", m.signaturesPath, err)
+	}
+	for _, module := range m.modules {
+		module.Signature = signatures[module.Source]
+	}
+	return nil
+}
+
+// saveSignatures persists the signature details of every signed version. Callers must hold the lock.
+func (m *fsModuleBackend) saveSignatures() error {
+	signatures := map[string]*modules.ModuleSignature{}
+	for _, module := range m.modules {
+		if module.Signature != nil {
+			signatures[module.Source] = module.Signature
+		}
+	}
+	return writeJSONFile(m.signaturesPath, signatures)
+}
+
+// saveChecksums persists the recorded checksum of every indexed version. Callers must hold the lock.
+func (m *fsModuleBackend) saveChecksums() error {
+	checksums := make(map[string]string, len(m.modules))
+	for _, module := range m.modules {
+		checksums[module.Source] = module.Checksum
+	}
+	return writeJSONFile(m.checksumsPath, checksums)
+}
+
+// withLifecycle returns a deep copy of the module carrying its lifecycle so that callers never share mutable state
+// with the index
+func (m *fsModuleBackend) withLifecycle(module *modules.Module) *modules.Module {
+	result := module.Copy()
+	if lifecycle, ok := m.lifecycles[module.Source]; ok {
+		copied := *lifecycle
+		result.Lifecycle = &copied
+	}
+	return result
 }
 
 // Init initializes the Modules table
-func (m *fsModuleBackend) Init() error {
+func (m *fsModuleBackend) Init(_ context.Context) error {
 	return nil
 }
 
@@ -20,41 +120,262 @@ func isModuleMatching(module *modules.Module, orgName string, moduleName string,
 }
 
 func (m *fsModuleBackend) filterModules(orgName string, moduleName string, providerName string) []*modules.Module {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	result := make([]*modules.Module, 0, len(m.modules))
 	for _, module := range m.modules {
 		if isModuleMatching(module, orgName, moduleName, providerName) {
-			result = append(result, module)
+			result = append(result, m.withLifecycle(module))
 		}
 	}
 	return result
 }
 
-func (m *fsModuleBackend) findModuleByVersion(orgName string, moduleName string, providerName string, version string) *modules.Module {
-	for _, module := range m.modules {
+// findModuleByVersion returns the index of a version in the module list or -1. Callers must hold the lock.
+func (m *fsModuleBackend) findModuleByVersion(orgName string, moduleName string, providerName string, version string) int {
+	for i, module := range m.modules {
 		if isModuleMatching(module, orgName, moduleName, providerName) && module.Version == version {
-			return module
+			return i
 		}
 	}
-	return nil
+	return -1
 }
 
 // ReadModuleVersions Returns all versions of a given module from the Modules table
-func (m *fsModuleBackend) ReadModuleVersions(orgName string, moduleName string, providerName string) ([]*modules.Module, error) {
+func (m *fsModuleBackend) ReadModuleVersions(_ context.Context, orgName string, moduleName string, providerName string) ([]*modules.Module, error) {
 	matchingModules := m.filterModules(orgName, moduleName, providerName)
 	if len(matchingModules) < 1 {
-		return nil, errors.New("No matching modules found")
+		return nil, stores.ErrModuleNotFound
 	}
 	return matchingModules, nil
 }
 
-func (m *fsModuleBackend) ReadModuleVersionSource(orgName string, moduleName string, providerName string, version string) (string, error) {
-	module := m.findModuleByVersion(orgName, moduleName, providerName, version)
-	if nil != module {
-		return module.Source, nil
+func (m *fsModuleBackend) ReadModuleVersionSource(ctx context.Context, orgName string, moduleName string, providerName string, version string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if i := m.findModuleByVersion(orgName, moduleName, providerName, version); i >= 0 {
+		return m.modules[i].Source, nil
 	}
 	return "", errors.New("No module found for the specified version")
 }
 
+// UpdateVersionLifecycle persists the lifecycle of a version. Setting a version back to active removes its entry.
+func (m *fsModuleBackend) UpdateVersionLifecycle(ctx context.Context, orgName string, moduleName string, providerName string, version string, lifecycle *modules.VersionLifecycle) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.findModuleByVersion(orgName, moduleName, providerName, version)
+	if i < 0 {
+		return stores.ErrModuleVersionNotFound
+	}
+	module := m.modules[i]
+	previous, existed := m.lifecycles[module.Source]
+	if lifecycle.State == modules.VersionActive {
+		delete(m.lifecycles, module.Source)
+	} else {
+		copied := *lifecycle
+		m.lifecycles[module.Source] = &copied
+	}
+	if err := m.saveLifecycles(); err != nil {
+		// Keep memory consistent with what is on disk
+		if existed {
+			m.lifecycles[module.Source] = previous
+		} else {
+			delete(m.lifecycles, module.Source)
+		}
+		return err
+	}
+	return nil
+}
+
+// ReadOrganizationModules returns every indexed version of the modules of an organization
+func (m *fsModuleBackend) ReadOrganizationModules(ctx context.Context, orgName string) ([]*modules.Module, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := make([]*modules.Module, 0)
+	for _, module := range m.modules {
+		if module.Organization == orgName {
+			result = append(result, m.withLifecycle(module))
+		}
+	}
+	return result, nil
+}
+
+// DeleteModuleVersion removes a version from the index along with its lifecycle and appends the deletion to the
+// deletions file once the index is written, so that only deletions which happened are recorded. The archive itself is
+// removed by the storage driver.
+func (m *fsModuleBackend) DeleteModuleVersion(ctx context.Context, deletion *modules.Deletion) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.findModuleByVersion(deletion.Organization, deletion.Name, deletion.Provider, deletion.Version)
+	if i < 0 {
+		return stores.ErrModuleVersionNotFound
+	}
+	source := m.modules[i].Source
+	previous := append([]*modules.Module(nil), m.modules...)
+	previousLifecycle, hadLifecycle := m.lifecycles[source]
+	restore := func() {
+		m.modules = previous
+		if hadLifecycle {
+			m.lifecycles[source] = previousLifecycle
+		}
+		// Best effort, the error that caused the rollback is the one reported
+		_ = m.saveChecksums()
+		_ = m.saveSignatures()
+		if hadLifecycle {
+			_ = m.saveLifecycles()
+		}
+	}
+	m.modules = append(m.modules[:i:i], m.modules[i+1:]...)
+	if err := m.saveChecksums(); err != nil {
+		restore()
+		return err
+	}
+	if err := m.saveSignatures(); err != nil {
+		restore()
+		return err
+	}
+	if hadLifecycle {
+		delete(m.lifecycles, source)
+		if err := m.saveLifecycles(); err != nil {
+			restore()
+			return err
+		}
+	}
+	if err := appendRecord(m.deletionsPath, deletion); err != nil {
+		restore()
+		return err
+	}
+	delete(m.problems, source)
+	if m.stats != nil {
+		m.stats.forgetVersion(deletion)
+	}
+	return nil
+}
+
+// ReadModuleVersion returns a copy of a single indexed version
+func (m *fsModuleBackend) ReadModuleVersion(ctx context.Context, orgName string, moduleName string, providerName string, version string) (*modules.Module, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	i := m.findModuleByVersion(orgName, moduleName, providerName, version)
+	if i < 0 {
+		return nil, stores.ErrModuleVersionNotFound
+	}
+	return m.withLifecycle(m.modules[i]), nil
+}
+
+// PublishModuleVersion adds a version to the index or replaces the indexed version and persists its checksum. The
+// archive must already have been written by the storage driver. A lifecycle given with the module, such as pending
+// approval, is persisted with it so that the version is never visible without it; otherwise any existing lifecycle
+// is kept.
+func (m *fsModuleBackend) PublishModuleVersion(ctx context.Context, module *modules.Module) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	published := module.Copy()
+	published.Lifecycle = nil
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	previous := append([]*modules.Module(nil), m.modules...)
+	previousLifecycle, hadLifecycle := m.lifecycles[module.Source]
+	restore := func() {
+		m.modules = previous
+		if hadLifecycle {
+			m.lifecycles[module.Source] = previousLifecycle
+		} else {
+			delete(m.lifecycles, module.Source)
+		}
+		// Any of the files may have been written before the one that failed, errors rewriting them are dropped in favour
+		// of the error failing the publish
+		_ = m.saveChecksums()
+		_ = m.saveSignatures()
+		if module.Lifecycle != nil {
+			_ = m.saveLifecycles()
+		}
+	}
+	if module.Lifecycle != nil {
+		if module.Lifecycle.State == modules.VersionActive {
+			delete(m.lifecycles, module.Source)
+		} else {
+			lifecycle := *module.Lifecycle
+			m.lifecycles[module.Source] = &lifecycle
+		}
+		if err := m.saveLifecycles(); err != nil {
+			restore()
+			return err
+		}
+	}
+	if i := m.findModuleByVersion(module.Organization, module.Name, module.Provider, module.Version); i >= 0 {
+		m.modules[i] = published
+	} else {
+		m.modules = append(m.modules, published)
+	}
+	if err := m.saveChecksums(); err != nil {
+		restore()
+		return err
+	}
+	if err := m.saveSignatures(); err != nil {
+		restore()
+		return err
+	}
+	delete(m.problems, module.Source)
+	return nil
+}
+
+// IndexProblems returns the archives found when indexing which are not served, sorted by source path
+func (m *fsModuleBackend) IndexProblems() []*modules.IndexProblem {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	problems := make([]*modules.IndexProblem, 0, len(m.problems))
+	for _, problem := range m.problems {
+		copied := *problem
+		problems = append(problems, &copied)
+	}
+	sort.Slice(problems, func(i, j int) bool { return problems[i].Source < problems[j].Source })
+	return problems
+}
+
+// IndexSize returns the number of indexed module versions
+func (m *fsModuleBackend) IndexSize() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.modules)
+}
+
+// appendRecord appends a JSON encoded record as a line to a file in the state directory
+func appendRecord(path string, record interface{}) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed creating state directory - %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed opening %s - %w", path, err)
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("failed writing %s - %w", path, err)
+	}
+	return file.Close()
+}
+
 // GetBackendType Returns the type of backend used
 func (m *fsModuleBackend) GetBackendType() string {
 	return "filesystem"
@@ -0,0 +1,209 @@
+package filesystem
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/modules"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/stats"
+)
+
+// stateDirectory holds the state the filesystem backend persists alongside the modules. It is ignored when indexing
+// modules as it contains no zip archives at module depth.
+const stateDirectory string = ".terrarium"
+
+const downloadsFile string = "downloads.jsonl"
+
+type dailyKey struct {
+	organization string
+	name         string
+	provider     string
+	version      string
+	date         string
+}
+
+type versionKey struct {
+	organization string
+	name         string
+	provider     string
+	version      string
+}
+
+// fsStatsBackend appends every download to a JSON lines file and keeps per day and per version counts in memory.
+// The counts are rebuilt from the file on start so that no separate aggregate has to be kept consistent with it.
+type fsStatsBackend struct {
+	path     string
+	mu       sync.Mutex
+	file     *os.File
+	counts   map[dailyKey]int
+	versions map[versionKey]int
+	// deleted holds when versions were last deleted. Downloads from before a deletion do not count towards the first
+	// download of the version published again.
+	deleted map[versionKey]time.Time
+}
+
+func newStatsBackend(modulesPath string, logger logrus.FieldLogger) (*fsStatsBackend, error) {
+	s := &fsStatsBackend{
+		path:     filepath.Join(modulesPath, stateDirectory, downloadsFile),
+		counts:   map[dailyKey]int{},
+		versions: map[versionKey]int{},
+		deleted:  map[versionKey]time.Time{},
+	}
+	if err := s.loadDeletions(filepath.Join(modulesPath, stateDirectory, deletionsFile), logger); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed opening download statistics - %w", err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		download := &stats.Download{}
+		if err := json.Unmarshal(scanner.Bytes(), download); err != nil {
+			logger.WithError(err).WithField("line", line).Warn("ignoring invalid download record")
+			continue
+		}
+		s.count(download)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed reading download statistics - %w", err)
+	}
+	return s, nil
+}
+
+// loadDeletions reads when each version was last deleted from the deletions file
+func (s *fsStatsBackend) loadDeletions(path string, logger logrus.FieldLogger) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed opening deletions - %w", err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		deletion := &modules.Deletion{}
+		if err := json.Unmarshal(scanner.Bytes(), deletion); err != nil {
+			logger.WithError(err).WithField("line", line).Warn("ignoring invalid deletion record")
+			continue
+		}
+		key := versionKey{deletion.Organization, deletion.Name, deletion.Provider, deletion.Version}
+		if deletion.DeletedAt.After(s.deleted[key]) {
+			s.deleted[key] = deletion.DeletedAt
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed reading deletions - %w", err)
+	}
+	return nil
+}
+
+func keyOf(download *stats.Download) dailyKey {
+	return dailyKey{
+		organization: download.Organization,
+		name:         download.Name,
+		provider:     download.Provider,
+		version:      download.Version,
+		date:         download.Timestamp.UTC().Format("2006-01-02"),
+	}
+}
+
+// count adds a download to the in memory counts, reporting whether it is the first of its version since the version
+// was last deleted
+func (s *fsStatsBackend) count(download *stats.Download) bool {
+	s.counts[keyOf(download)]++
+	key := versionKey{download.Organization, download.Name, download.Provider, download.Version}
+	if !download.Timestamp.After(s.deleted[key]) {
+		return false
+	}
+	s.versions[key]++
+	return s.versions[key] == 1
+}
+
+// forgetVersion resets the first download tracking of a deleted version so that the first download of the version
+// published again is reported. The daily counts are kept as history.
+func (s *fsStatsBackend) forgetVersion(deletion *modules.Deletion) {
+	key := versionKey{deletion.Organization, deletion.Name, deletion.Provider, deletion.Version}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleted[key] = deletion.DeletedAt
+	delete(s.versions, key)
+}
+
+// RecordDownload appends a download to the statistics file, creating it on first use so that a read only modules
+// path only fails when statistics are recorded
+func (s *fsStatsBackend) RecordDownload(ctx context.Context, download *stats.Download) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	data, err := json.Marshal(download)
+	if err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+			return false, fmt.Errorf("failed creating state directory - %w", err)
+		}
+		s.file, err = os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return false, fmt.Errorf("failed opening download statistics - %w", err)
+		}
+	}
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return false, fmt.Errorf("failed writing download statistics - %w", err)
+	}
+	return s.count(download), nil
+}
+
+// ReadDownloadCounts returns the per version and day counts of a module
+func (s *fsStatsBackend) ReadDownloadCounts(ctx context.Context, orgName string, moduleName string, providerName string) ([]*stats.DailyDownloads, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	result := make([]*stats.DailyDownloads, 0)
+	for key, count := range s.counts {
+		if key.organization == orgName && key.name == moduleName && key.provider == providerName {
+			result = append(result, &stats.DailyDownloads{Version: key.version, Date: key.date, Downloads: count})
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Version != result[j].Version {
+			return modules.CompareVersions(result[i].Version, result[j].Version) < 0
+		}
+		return result[i].Date < result[j].Date
+	})
+	return result, nil
+}
+
+func (s *fsStatsBackend) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
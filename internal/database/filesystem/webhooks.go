@@ -0,0 +1,128 @@
+package filesystem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/webhooks"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/stores"
+)
+
+const webhooksFile string = "webhooks.json"
+
+// maxFinishedDeliveries bounds how many delivered and failed deliveries are kept for inspection and redelivery
+const maxFinishedDeliveries int = 1000
+
+// fsWebhookBackend keeps webhook deliveries in memory and rewrites them to a JSON file on every change so that
+// pending deliveries survive restarts
+type fsWebhookBackend struct {
+	path       string
+	mu         sync.Mutex
+	deliveries map[string]*webhooks.Delivery
+}
+
+func newWebhookBackend(modulesPath string) (*fsWebhookBackend, error) {
+	s := &fsWebhookBackend{
+		path:       filepath.Join(modulesPath, stateDirectory, webhooksFile),
+		deliveries: map[string]*webhooks.Delivery{},
+	}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed reading webhook deliveries - %w", err)
+	}
+	if err := json.Unmarshal(data, &s.deliveries); err != nil {
+		return nil, fmt.Errorf("failed parsing webhook deliveries %s - %w", s.path, err)
+	}
+	return s, nil
+}
+
+// SaveDelivery stores a copy of the delivery, discarding the oldest finished deliveries beyond maxFinishedDeliveries
+func (s *fsWebhookBackend) SaveDelivery(ctx context.Context, delivery *webhooks.Delivery) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous := s.deliveries[delivery.ID]
+	stored := *delivery
+	s.deliveries[delivery.ID] = &stored
+	pruned := s.prune()
+	if err := writeJSONFile(s.path, s.deliveries); err != nil {
+		if previous == nil {
+			delete(s.deliveries, delivery.ID)
+		} else {
+			s.deliveries[delivery.ID] = previous
+		}
+		for _, d := range pruned {
+			s.deliveries[d.ID] = d
+		}
+		return err
+	}
+	return nil
+}
+
+// prune removes the oldest finished deliveries beyond maxFinishedDeliveries, returning them
+func (s *fsWebhookBackend) prune() []*webhooks.Delivery {
+	var finished []*webhooks.Delivery
+	for _, d := range s.deliveries {
+		if d.Status != webhooks.DeliveryPending {
+			finished = append(finished, d)
+		}
+	}
+	if len(finished) <= maxFinishedDeliveries {
+		return nil
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].UpdatedAt.Before(finished[j].UpdatedAt) })
+	pruned := finished[:len(finished)-maxFinishedDeliveries]
+	for _, d := range pruned {
+		delete(s.deliveries, d.ID)
+	}
+	return pruned
+}
+
+// ReadDelivery returns a copy of a stored delivery
+func (s *fsWebhookBackend) ReadDelivery(ctx context.Context, id string) (*webhooks.Delivery, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delivery, ok := s.deliveries[id]
+	if !ok {
+		return nil, stores.ErrDeliveryNotFound
+	}
+	found := *delivery
+	return &found, nil
+}
+
+// ReadDeliveries returns copies of the stored deliveries with a status, most recently created first
+func (s *fsWebhookBackend) ReadDeliveries(ctx context.Context, status webhooks.DeliveryStatus) ([]*webhooks.Delivery, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	result := make([]*webhooks.Delivery, 0)
+	for _, delivery := range s.deliveries {
+		if status == "" || delivery.Status == status {
+			found := *delivery
+			result = append(result, &found)
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].CreatedAt.After(result[j].CreatedAt)
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result, nil
+}
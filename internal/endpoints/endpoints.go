@@ -4,6 +4,43 @@ package endpoints
 
 import "net/http"
 
+// Route names registered by the Modules API. Middleware can use these to identify routes independently of their path.
+const (
+	// ModuleRoutePrefix starts the name of every route registered by the Modules API
+	ModuleRoutePrefix string = "modules."
+
+	ModuleVersionsRoute  string = "modules.versions"
+	ModuleDownloadRoute  string = "modules.download"
+	ModuleArchiveRoute   string = "modules.archive"
+	ModuleStatsRoute     string = "modules.stats"
+	ModulePublishRoute   string = "modules.publish"
+	ModuleSignatureRoute string = "modules.signature"
+	ModuleKeysRoute      string = "modules.keys"
+)
+
+// Route names registered by the Admin API
+const (
+	// AdminRoutePrefix starts the name of every route registered by the Admin API
+	AdminRoutePrefix string = "admin."
+
+	AdminLifecycleRoute          string = "admin.lifecycle"
+	AdminLifecycleUpdateRoute    string = "admin.lifecycle.update"
+	AdminDeleteVersionRoute      string = "admin.delete.version"
+	AdminDeleteModuleRoute       string = "admin.delete.module"
+	AdminDeleteOrganizationRoute string = "admin.delete.organization"
+	AdminPendingRoute            string = "admin.pending"
+	AdminProblemsRoute           string = "admin.problems"
+	AdminApproveRoute            string = "admin.approve"
+	AdminRejectRoute             string = "admin.reject"
+	AdminAuditRoute              string = "admin.audit"
+	AdminDeliveriesRoute         string = "admin.webhooks.deliveries"
+	AdminDeliveryRoute           string = "admin.webhooks.delivery"
+	AdminRedeliverRoute          string = "admin.webhooks.redeliver"
+)
+
+// EventsRoute is the name of the route registered by the Stream API
+const EventsRoute string = "events"
+
 // OrganizationAPIInterface specifies the required HTTP handlers for a Terrarium Discovery API
 type DiscoveryAPIInterface interface {
 	DiscoveryHandler() http.Handler
@@ -14,4 +51,35 @@ type ModuleAPIInterface interface {
 	GetModuleVersionHandler() http.Handler
 	DownloadModuleHandler() http.Handler
 	ArchiveHandler() http.Handler
+	StatsHandler() http.Handler
+	PublishHandler() http.Handler
+	SignatureHandler() http.Handler
+	KeysHandler() http.Handler
+}
+
+// AdminAPIInterface specifies the required HTTP handlers for a Terrarium Admin API implementation
+type AdminAPIInterface interface {
+	GetVersionLifecycleHandler() http.Handler
+	UpdateVersionLifecycleHandler() http.Handler
+	ListPendingHandler() http.Handler
+	ListProblemsHandler() http.Handler
+	ApproveHandler() http.Handler
+	RejectHandler() http.Handler
+	DeleteHandler() http.Handler
+	AuditHandler() http.Handler
+	ListDeliveriesHandler() http.Handler
+	GetDeliveryHandler() http.Handler
+	RedeliverHandler() http.Handler
+}
+
+// StreamAPIInterface specifies the required HTTP handlers for a Terrarium event stream implementation
+type StreamAPIInterface interface {
+	EventsHandler() http.Handler
+}
+
+// HealthAPIInterface specifies the required HTTP handlers for a Terrarium health API implementation
+type HealthAPIInterface interface {
+	HealthzHandler() http.Handler
+	ReadyzHandler() http.Handler
+	VersionHandler() http.Handler
 }
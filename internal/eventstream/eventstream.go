@@ -0,0 +1,134 @@
+// Package eventstream fans registry events out to the clients of the event stream as they happen. Every event is
+// first appended to the EventLogStore of the database driver, which numbers it, so that clients reconnecting with the
+// number of the last event they received are sent the events they missed before following new ones.
+package eventstream
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/events"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/stores"
+)
+
+// subscriptionBuffer is how many events a subscriber may fall behind by before it is dropped
+const subscriptionBuffer int = 64
+
+// Stream logs registry events and passes them on to its subscribers
+type Stream struct {
+	store  stores.EventLogStore
+	logger logrus.FieldLogger
+	// emitting is held by Emit while an event is logged and passed on, so that subscribers receive events in the
+	// order they are logged. Subscribing and unsubscribing only take mu and so never wait on the log.
+	emitting      sync.Mutex
+	mu            sync.Mutex
+	subscriptions map[*Subscription]struct{}
+	closed        bool
+}
+
+// Subscription receives the events logged after it was made, in order. Its channel is closed when the subscriber
+// falls too far behind or the stream is closed, after which the subscriber can resume from the log.
+type Subscription struct {
+	Events <-chan *events.Logged
+	events chan *events.Logged
+}
+
+// New creates a Stream logging events to store
+func New(store stores.EventLogStore, logger logrus.FieldLogger) *Stream {
+	return &Stream{
+		store:         store,
+		logger:        logger,
+		subscriptions: map[*Subscription]struct{}{},
+	}
+}
+
+// Emit logs an event and passes it to every subscriber. A nil Stream emits nothing. Failures to log are logged rather
+// than returned as the change the event describes has already been made.
+func (s *Stream) Emit(event *events.Event) {
+	if s == nil {
+		return
+	}
+	if event.ID == "" {
+		event.ID = newID()
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+	s.emitting.Lock()
+	defer s.emitting.Unlock()
+	logged, err := s.store.AppendEvent(context.Background(), event)
+	if err != nil {
+		s.logger.WithError(err).WithFields(logrus.Fields{"event": event.ID, "type": event.Type}).Error("failed logging event")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for subscription := range s.subscriptions {
+		select {
+		case subscription.events <- logged:
+		default:
+			s.logger.WithField("sequence", logged.Sequence).Warn("dropping event stream subscriber falling behind")
+			s.drop(subscription)
+		}
+	}
+}
+
+// Subscribe starts passing events to a new subscription. Events logged before may be read through ReadAfter, in
+// which case subscribers skip the events they received both ways by their sequence number.
+func (s *Stream) Subscribe() *Subscription {
+	c := make(chan *events.Logged, subscriptionBuffer)
+	subscription := &Subscription{Events: c, events: c}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		close(c)
+		return subscription
+	}
+	s.subscriptions[subscription] = struct{}{}
+	return subscription
+}
+
+// Unsubscribe stops passing events to a subscription
+func (s *Stream) Unsubscribe(subscription *Subscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.drop(subscription)
+}
+
+// ReadAfter returns the logged events following a sequence number, oldest first. It reports false when some of them
+// are no longer logged.
+func (s *Stream) ReadAfter(ctx context.Context, sequence uint64) ([]*events.Logged, bool, error) {
+	return s.store.ReadEventsAfter(ctx, sequence)
+}
+
+// Close ends every subscription so that streaming requests finish, for example when the server shuts down
+func (s *Stream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for subscription := range s.subscriptions {
+		s.drop(subscription)
+	}
+}
+
+// drop removes a subscription and closes its channel. It must be called holding the lock.
+func (s *Stream) drop(subscription *Subscription) {
+	if _, ok := s.subscriptions[subscription]; !ok {
+		return
+	}
+	delete(s.subscriptions, subscription)
+	close(subscription.events)
+}
+
+func newID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,95 @@
+package eventstream
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/events"
+)
+
+// blockingLog numbers events like an event log, holding every append until it is released. Appends are announced on
+// appending when it is set.
+type blockingLog struct {
+	mu        sync.Mutex
+	sequence  uint64
+	appending chan struct{}
+	release   chan struct{}
+}
+
+func (l *blockingLog) AppendEvent(_ context.Context, event *events.Event) (*events.Logged, error) {
+	if l.appending != nil {
+		l.appending <- struct{}{}
+	}
+	<-l.release
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sequence++
+	return &events.Logged{Sequence: l.sequence, Event: event}, nil
+}
+
+func (l *blockingLog) ReadEventsAfter(_ context.Context, _ uint64) ([]*events.Logged, bool, error) {
+	return nil, true, nil
+}
+
+func TestEmitDoesNotBlockSubscribers(t *testing.T) {
+	log := &blockingLog{appending: make(chan struct{}), release: make(chan struct{})}
+	stream := New(log, logrus.New())
+	emitted := make(chan struct{})
+	go func() {
+		stream.Emit(&events.Event{Type: events.VersionPublished})
+		close(emitted)
+	}()
+	<-log.appending
+
+	subscribed := make(chan *Subscription)
+	go func() {
+		subscribed <- stream.Subscribe()
+	}()
+	var subscription *Subscription
+	select {
+	case subscription = <-subscribed:
+	case <-time.After(5 * time.Second):
+		close(log.release)
+		t.Fatal("Subscribe() waited for an event being logged")
+	}
+	stream.Unsubscribe(subscription)
+	close(log.release)
+	<-emitted
+}
+
+func TestEmitOrder(t *testing.T) {
+	log := &blockingLog{release: make(chan struct{})}
+	close(log.release)
+	stream := New(log, logrus.New())
+	subscription := stream.Subscribe()
+
+	const emitters, perEmitter = 4, 10
+	var wg sync.WaitGroup
+	for i := 0; i < emitters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perEmitter; j++ {
+				stream.Emit(&events.Event{Type: events.VersionPublished})
+			}
+		}()
+	}
+	wg.Wait()
+	stream.Close()
+
+	var last uint64
+	received := 0
+	for logged := range subscription.Events {
+		if logged.Sequence <= last {
+			t.Fatalf("received event %d after event %d", logged.Sequence, last)
+		}
+		last = logged.Sequence
+		received++
+	}
+	if received != emitters*perEmitter {
+		t.Fatalf("received %d events, want %d", received, emitters*perEmitter)
+	}
+}
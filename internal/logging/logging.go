@@ -0,0 +1,115 @@
+// Package logging provides the structured logger used throughout Terrarium. Every request is assigned an ID, taken
+// from the X-Request-ID header when the client or a proxy supplied one, which is echoed in the response and included
+// in every log line written while serving the request.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/sirupsen/logrus"
+)
+
+// RequestIDHeader is the header carrying the ID of a request
+const RequestIDHeader string = "X-Request-ID"
+
+// validRequestID restricts IDs accepted from clients so that they cannot inject arbitrary content into logs
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type contextKey int
+
+const (
+	loggerKey contextKey = iota
+	requestIDKey
+)
+
+// New creates a logger writing to stderr at the given level. The format is either text or json.
+func New(level string, format string) (*logrus.Logger, error) {
+	logger := logrus.New()
+	logger.SetOutput(os.Stderr)
+	parsedLevel, err := logrus.ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	logger.SetLevel(parsedLevel)
+	switch format {
+	case "json":
+		logger.SetFormatter(&logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano})
+	case "text":
+		logger.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+	return logger, nil
+}
+
+// Default returns the logger used by components that have not been given one
+func Default() logrus.FieldLogger {
+	return logrus.StandardLogger()
+}
+
+// FromContext returns the request scoped logger attached to the context, falling back to the given logger
+func FromContext(ctx context.Context, fallback logrus.FieldLogger) logrus.FieldLogger {
+	if logger, ok := ctx.Value(loggerKey).(logrus.FieldLogger); ok {
+		return logger
+	}
+	if fallback == nil {
+		return Default()
+	}
+	return fallback
+}
+
+// RequestID returns the ID of the request the context belongs to or an empty string
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// Middleware assigns every request an ID and attaches a logger carrying it to the request context. The ID is set on
+// the response before the handler runs so that it is present on error responses too.
+func Middleware(logger logrus.FieldLogger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if !validRequestID.MatchString(id) {
+				id = newRequestID()
+			}
+			rw.Header().Set(RequestIDHeader, id)
+			ctx := context.WithValue(r.Context(), requestIDKey, id)
+			ctx = context.WithValue(ctx, loggerKey, logger.WithField("request_id", id))
+			next.ServeHTTP(rw, r.WithContext(ctx))
+		})
+	}
+}
+
+// AccessLog writes a structured log line for every request once it has been served
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		snoop := httpsnoop.CaptureMetrics(next, rw, r)
+		fields := logrus.Fields{
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"status":      snoop.Code,
+			"bytes":       snoop.Written,
+			"duration_ms": float64(snoop.Duration.Microseconds()) / 1000,
+			"remote_addr": r.RemoteAddr,
+			"user_agent":  r.UserAgent(),
+		}
+		FromContext(r.Context(), nil).WithFields(fields).Info("request served")
+	})
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,166 @@
+// Package metrics exposes Prometheus metrics for Terrarium. Requests are labelled by route template rather than raw
+// path so that the number of series does not grow with the number of organizations and modules in the registry.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/terrariumcloud/terrarium-lite/internal/endpoints"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/drivers"
+)
+
+const namespace string = "terrarium"
+
+// unmatchedRoute labels requests that did not match any registered route
+const unmatchedRoute string = "unmatched"
+
+// Metrics holds the collectors exported by Terrarium
+type Metrics struct {
+	registry        *prometheus.Registry
+	moduleDownloads bool
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	archiveBytes    prometheus.Counter
+	storageFetch    *prometheus.HistogramVec
+	downloads       *prometheus.CounterVec
+}
+
+// IndexSizer may be implemented by a database driver to report how many module versions it has indexed
+type IndexSizer interface {
+	IndexSize() int
+}
+
+// New creates the Terrarium collectors and registers them with a dedicated registry. Per module download counters
+// add a series for every module version downloaded and are only exported when moduleDownloads is enabled.
+func New(moduleDownloads bool) *Metrics {
+	m := &Metrics{
+		registry:        prometheus.NewRegistry(),
+		moduleDownloads: moduleDownloads,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Total number of HTTP requests by route template, method and status code.",
+		}, []string{"route", "method", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests by route template and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		archiveBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "archive_bytes_served_total",
+			Help:      "Total number of module archive bytes served.",
+		}),
+		storageFetch: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "storage_fetch_duration_seconds",
+			Help:      "Latency of module source fetches from the storage backend.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"backend", "result"}),
+		downloads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "module_downloads_total",
+			Help:      "Total number of archive downloads per module version.",
+		}, []string{"organization", "module", "provider", "version"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.archiveBytes,
+		m.storageFetch,
+	)
+	if moduleDownloads {
+		m.registry.MustRegister(m.downloads)
+	}
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Register adds further collectors, for instance from other packages, to the exported metrics
+func (m *Metrics) Register(collector prometheus.Collector) {
+	m.registry.MustRegister(collector)
+}
+
+// RegisterIndexSize exports the number of indexed module versions when the database driver can report it
+func (m *Metrics) RegisterIndexSize(driver drivers.TerrariumDatabaseDriver) {
+	sizer, ok := driver.(IndexSizer)
+	if !ok {
+		return
+	}
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "module_index_size",
+		Help:      "Number of module versions in the index.",
+	}, func() float64 {
+		return float64(sizer.IndexSize())
+	}))
+}
+
+// Middleware records request counts and latencies labelled by the template of the matched route. Successful
+// archive downloads also count the bytes served and, when enabled, the module version downloaded.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		route := unmatchedRoute
+		routeName := ""
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+			routeName = current.GetName()
+		}
+		snoop := httpsnoop.CaptureMetrics(next, rw, r)
+		m.requests.WithLabelValues(route, r.Method, strconv.Itoa(snoop.Code)).Inc()
+		m.requestDuration.WithLabelValues(route, r.Method).Observe(snoop.Duration.Seconds())
+		if routeName == endpoints.ModuleArchiveRoute && snoop.Code == http.StatusOK {
+			m.archiveBytes.Add(float64(snoop.Written))
+			if m.moduleDownloads {
+				params := mux.Vars(r)
+				m.downloads.WithLabelValues(params["organization_name"], params["name"], params["provider"], params["version"]).Inc()
+			}
+		}
+	})
+}
+
+// InstrumentStorage wraps a storage driver so that the latency of every fetch is recorded against its backing store name
+func (m *Metrics) InstrumentStorage(driver drivers.TerrariumStorageDriver) drivers.TerrariumStorageDriver {
+	return &instrumentedStorage{TerrariumStorageDriver: driver, metrics: m}
+}
+
+type instrumentedStorage struct {
+	drivers.TerrariumStorageDriver
+	metrics *Metrics
+}
+
+func (s *instrumentedStorage) FetchModuleSource(ctx context.Context, key string) ([]byte, error) {
+	start := time.Now()
+	data, err := s.TerrariumStorageDriver.FetchModuleSource(ctx, key)
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	s.metrics.storageFetch.WithLabelValues(s.GetBackingStoreName(), result).Observe(time.Since(start).Seconds())
+	return data, err
+}
+
+// HealthCheck is passed through uninstrumented so that readiness probes are not counted as storage operations
+func (s *instrumentedStorage) HealthCheck(ctx context.Context) error {
+	if checker, ok := s.TerrariumStorageDriver.(drivers.HealthChecker); ok {
+		return checker.HealthCheck(ctx)
+	}
+	return nil
+}
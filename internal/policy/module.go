@@ -0,0 +1,287 @@
+package policy
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Position locates a construct within a module
+type Position struct {
+	File string `json:"file,omitempty"`
+	Line int    `json:"line,omitempty"`
+}
+
+// Module is what policies know about a Terraform module: the declarations of its root directory relevant to rules
+type Module struct {
+	// Readme is the name of the module's README file, empty when there is none
+	Readme            string
+	RequiredVersions  []string
+	RequiredProviders map[string]*ProviderRequirement
+	Resources         []*Resource
+	Variables         []*Variable
+	// SyntaxErrors are reported instead of evaluating rules against a partially parsed module
+	SyntaxErrors []Violation
+}
+
+// ProviderRequirement is an entry of a required_providers block
+type ProviderRequirement struct {
+	Name    string
+	Source  string
+	Version string
+	Position
+}
+
+// Resource is a resource or data block
+type Resource struct {
+	// Mode is "managed" for resource blocks and "data" for data blocks
+	Mode string
+	Type string
+	Name string
+	// Provider is the local name of the provider, either set explicitly or implied by the resource type
+	Provider     string
+	Provisioners []*Provisioner
+	Position
+}
+
+// Provisioner is a provisioner block of a resource
+type Provisioner struct {
+	Type string
+	Position
+}
+
+// Variable is a variable block
+type Variable struct {
+	Name        string
+	Description string
+	Position
+}
+
+// Address returns the address of the resource as Terraform writes it
+func (r *Resource) Address() string {
+	if r.Mode == "data" {
+		return fmt.Sprintf("data.%s.%s", r.Type, r.Name)
+	}
+	return fmt.Sprintf("%s.%s", r.Type, r.Name)
+}
+
+var rootSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "terraform"},
+		{Type: "resource", LabelNames: []string{"type", "name"}},
+		{Type: "data", LabelNames: []string{"type", "name"}},
+		{Type: "variable", LabelNames: []string{"name"}},
+	},
+}
+
+var terraformSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{{Name: "required_version"}},
+	Blocks:     []hcl.BlockHeaderSchema{{Type: "required_providers"}},
+}
+
+var resourceSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{{Name: "provider"}},
+	Blocks:     []hcl.BlockHeaderSchema{{Type: "provisioner", LabelNames: []string{"type"}}},
+}
+
+var variableSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{{Name: "description"}},
+}
+
+// LoadZip parses the root module of a zip archive as published to the registry
+func LoadZip(data []byte) (*Module, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed reading zip archive - %w", err)
+	}
+	files := map[string][]byte{}
+	for _, entry := range reader.File {
+		name := path.Clean(strings.ReplaceAll(entry.Name, `\`, "/"))
+		if strings.Contains(name, "/") || !entry.Mode().IsRegular() || !isModuleFile(name) {
+			continue
+		}
+		rc, err := entry.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed reading %s - %w", name, err)
+		}
+		files[name], err = io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed reading %s - %w", name, err)
+		}
+	}
+	return parse(files), nil
+}
+
+// LoadDirectory parses the module in a directory
+func LoadDirectory(dir string) (*Module, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string][]byte{}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !isModuleFile(entry.Name()) {
+			continue
+		}
+		if files[entry.Name()], err = os.ReadFile(filepath.Join(dir, entry.Name())); err != nil {
+			return nil, err
+		}
+	}
+	return parse(files), nil
+}
+
+// isModuleFile selects the files policies look at, Terraform configuration and READMEs
+func isModuleFile(name string) bool {
+	return isConfigFile(name) || isReadme(name)
+}
+
+func isConfigFile(name string) bool {
+	return strings.HasSuffix(name, ".tf") || strings.HasSuffix(name, ".tf.json")
+}
+
+func isReadme(name string) bool {
+	return strings.HasPrefix(strings.ToUpper(name), "README")
+}
+
+func parse(files map[string][]byte) *Module {
+	module := &Module{RequiredProviders: map[string]*ProviderRequirement{}}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parser := hclparse.NewParser()
+	for _, name := range names {
+		if isReadme(name) {
+			if module.Readme == "" {
+				module.Readme = name
+			}
+			continue
+		}
+		var file *hcl.File
+		var diags hcl.Diagnostics
+		if strings.HasSuffix(name, ".json") {
+			file, diags = parser.ParseJSON(files[name], name)
+		} else {
+			file, diags = parser.ParseHCL(files[name], name)
+		}
+		if diags.HasErrors() {
+			module.addSyntaxErrors(diags)
+			continue
+		}
+		module.addFile(file.Body)
+	}
+	return module
+}
+
+func (m *Module) addSyntaxErrors(diags hcl.Diagnostics) {
+	for _, diag := range diags {
+		if diag.Severity != hcl.DiagError {
+			continue
+		}
+		message := diag.Summary
+		if diag.Detail != "" {
+			message = fmt.Sprintf("%s: %s", diag.Summary, diag.Detail)
+		}
+		m.SyntaxErrors = append(m.SyntaxErrors, Violation{Rule: RuleSyntax, Message: message, Position: rangePosition(diag.Subject)})
+	}
+}
+
+// addFile records the declarations of a configuration file. Blocks and attributes policies do not look at are
+// ignored, as are expressions that cannot be evaluated without the rest of the configuration.
+func (m *Module) addFile(body hcl.Body) {
+	content, _, _ := body.PartialContent(rootSchema)
+	for _, block := range content.Blocks {
+		switch block.Type {
+		case "terraform":
+			m.addTerraformBlock(block)
+		case "resource", "data":
+			m.addResource(block)
+		case "variable":
+			variable := &Variable{Name: block.Labels[0], Position: rangePosition(&block.DefRange)}
+			attrs, _, _ := block.Body.PartialContent(variableSchema)
+			if attr, ok := attrs.Attributes["description"]; ok {
+				variable.Description = stringValue(attr.Expr)
+			}
+			m.Variables = append(m.Variables, variable)
+		}
+	}
+}
+
+func (m *Module) addTerraformBlock(block *hcl.Block) {
+	content, _, _ := block.Body.PartialContent(terraformSchema)
+	if attr, ok := content.Attributes["required_version"]; ok {
+		m.RequiredVersions = append(m.RequiredVersions, stringValue(attr.Expr))
+	}
+	for _, providers := range content.Blocks {
+		attrs, _ := providers.Body.JustAttributes()
+		for name, attr := range attrs {
+			requirement := &ProviderRequirement{Name: name, Position: rangePosition(&attr.Range)}
+			if pairs, diags := hcl.ExprMap(attr.Expr); !diags.HasErrors() {
+				for _, pair := range pairs {
+					switch hcl.ExprAsKeyword(pair.Key) {
+					case "source":
+						requirement.Source = stringValue(pair.Value)
+					case "version":
+						requirement.Version = stringValue(pair.Value)
+					}
+				}
+			} else {
+				// The legacy form gives the version constraint as a string
+				requirement.Version = stringValue(attr.Expr)
+			}
+			m.RequiredProviders[name] = requirement
+		}
+	}
+}
+
+func (m *Module) addResource(block *hcl.Block) {
+	mode := "managed"
+	if block.Type == "data" {
+		mode = "data"
+	}
+	resource := &Resource{
+		Mode:     mode,
+		Type:     block.Labels[0],
+		Name:     block.Labels[1],
+		Provider: strings.SplitN(block.Labels[0], "_", 2)[0],
+		Position: rangePosition(&block.DefRange),
+	}
+	content, _, _ := block.Body.PartialContent(resourceSchema)
+	if attr, ok := content.Attributes["provider"]; ok {
+		if traversal, diags := hcl.AbsTraversalForExpr(attr.Expr); !diags.HasErrors() {
+			resource.Provider = traversal.RootName()
+		}
+	}
+	for _, provisioner := range content.Blocks {
+		resource.Provisioners = append(resource.Provisioners, &Provisioner{Type: provisioner.Labels[0], Position: rangePosition(&provisioner.DefRange)})
+	}
+	m.Resources = append(m.Resources, resource)
+}
+
+// stringValue evaluates a literal string expression, returning an empty string for anything else
+func stringValue(expr hcl.Expression) string {
+	value, diags := expr.Value(nil)
+	if diags.HasErrors() || value.IsNull() || !value.IsKnown() || value.Type() != cty.String {
+		return ""
+	}
+	return value.AsString()
+}
+
+func rangePosition(r *hcl.Range) Position {
+	if r == nil {
+		return Position{}
+	}
+	return Position{File: r.Filename, Line: r.Start.Line}
+}
@@ -0,0 +1,187 @@
+// Package policy checks the contents of modules against rules set per organization before they are published. Rules
+// implement the Rule interface; the built-in rules are enabled through a YAML rules file per organization:
+//
+//	forbidden_resource_types: ["aws_iam_user", "aws_iam_access_key"]
+//	forbidden_provisioners: ["local-exec"]
+//	require_required_version: true
+//	require_pinned_providers: true
+//	require_readme: true
+//	require_variable_descriptions: true
+//
+// The registry loads the rules of organization acme from acme.yaml in its policy rules directory.
+package policy
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Names of the built-in rules as reported in violations
+const (
+	RuleSyntax                 string = "syntax"
+	RuleForbiddenResourceTypes string = "forbidden_resource_types"
+	RuleForbiddenProvisioners  string = "forbidden_provisioners"
+	RuleRequiredVersion        string = "required_version"
+	RulePinnedProviders        string = "pinned_providers"
+	RuleReadme                 string = "readme"
+	RuleVariableDescriptions   string = "variable_descriptions"
+)
+
+// Violation is a failed check of a rule, located in the module when it concerns a specific declaration
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+	Position
+}
+
+// String formats the violation for terminals, prefixed with its location when known
+func (v Violation) String() string {
+	location := v.File
+	if location != "" && v.Line > 0 {
+		location = fmt.Sprintf("%s:%d", v.File, v.Line)
+	}
+	if location == "" {
+		return fmt.Sprintf("[%s] %s", v.Rule, v.Message)
+	}
+	return fmt.Sprintf("%s: [%s] %s", location, v.Rule, v.Message)
+}
+
+// Rule checks a module and returns its violations
+type Rule interface {
+	Name() string
+	Check(module *Module) []Violation
+}
+
+// Policy is the set of rules a module must pass
+type Policy struct {
+	Rules []Rule
+}
+
+// Evaluate checks a module against every rule. A module with syntax errors only reports those, as rules would see
+// an incomplete module.
+func (p *Policy) Evaluate(module *Module) []Violation {
+	if len(module.SyntaxErrors) > 0 {
+		return module.SyntaxErrors
+	}
+	violations := make([]Violation, 0)
+	for _, rule := range p.Rules {
+		violations = append(violations, rule.Check(module)...)
+	}
+	return violations
+}
+
+// ViolationError is returned when a module fails its policy. The violations are returned to clients as error details.
+type ViolationError struct {
+	Violations []Violation
+}
+
+func (e *ViolationError) Error() string {
+	if len(e.Violations) == 1 {
+		return fmt.Sprintf("module violates policy - %s", e.Violations[0].String())
+	}
+	return fmt.Sprintf("module violates policy with %d violations", len(e.Violations))
+}
+
+// Details returns the violations
+func (e *ViolationError) Details() interface{} {
+	return e.Violations
+}
+
+// Rules is the rules file of an organization enabling the built-in rules
+type Rules struct {
+	// ForbiddenResourceTypes are patterns as understood by path.Match, such as aws_iam_*
+	ForbiddenResourceTypes []string `yaml:"forbidden_resource_types"`
+	ForbiddenProvisioners  []string `yaml:"forbidden_provisioners"`
+	RequireRequiredVersion bool     `yaml:"require_required_version"`
+	// RequirePinnedProviders requires a version constraint for every provider declared or used by a resource
+	RequirePinnedProviders      bool `yaml:"require_pinned_providers"`
+	RequireReadme               bool `yaml:"require_readme"`
+	RequireVariableDescriptions bool `yaml:"require_variable_descriptions"`
+}
+
+// LoadPolicy reads a rules file and returns the policy it enables
+func LoadPolicy(name string) (*Policy, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading policy rules - %w", err)
+	}
+	rules := &Rules{}
+	if err := yaml.UnmarshalStrict(data, rules); err != nil {
+		return nil, fmt.Errorf("failed parsing policy rules %s - %w", name, err)
+	}
+	policy, err := rules.Policy()
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy rules %s - %w", name, err)
+	}
+	return policy, nil
+}
+
+// Policy returns the policy made of the enabled built-in rules
+func (r *Rules) Policy() (*Policy, error) {
+	policy := &Policy{}
+	if len(r.ForbiddenResourceTypes) > 0 {
+		for _, pattern := range r.ForbiddenResourceTypes {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("forbidden resource type pattern %q - %w", pattern, err)
+			}
+		}
+		policy.Rules = append(policy.Rules, ForbiddenResourceTypes(r.ForbiddenResourceTypes))
+	}
+	if len(r.ForbiddenProvisioners) > 0 {
+		policy.Rules = append(policy.Rules, ForbiddenProvisioners(r.ForbiddenProvisioners))
+	}
+	if r.RequireRequiredVersion {
+		policy.Rules = append(policy.Rules, RequiredVersion{})
+	}
+	if r.RequirePinnedProviders {
+		policy.Rules = append(policy.Rules, PinnedProviders{})
+	}
+	if r.RequireReadme {
+		policy.Rules = append(policy.Rules, Readme{})
+	}
+	if r.RequireVariableDescriptions {
+		policy.Rules = append(policy.Rules, VariableDescriptions{})
+	}
+	return policy, nil
+}
+
+// Engine holds the policy of every organization that has one
+type Engine struct {
+	Policies map[string]*Policy
+}
+
+// LoadEngine loads the rules files of a directory, named after the organization they apply to, such as acme.yaml
+func LoadEngine(dir string) (*Engine, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading policy rules directory - %w", err)
+	}
+	engine := &Engine{Policies: map[string]*Policy{}}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		orgName := strings.TrimSuffix(entry.Name(), ext)
+		if _, ok := engine.Policies[orgName]; ok {
+			return nil, fmt.Errorf("duplicate policy rules for organization %s", orgName)
+		}
+		if engine.Policies[orgName], err = LoadPolicy(filepath.Join(dir, entry.Name())); err != nil {
+			return nil, err
+		}
+	}
+	return engine, nil
+}
+
+// Policy returns the policy of an organization, nil when it has none
+func (e *Engine) Policy(orgName string) *Policy {
+	if e == nil {
+		return nil
+	}
+	return e.Policies[orgName]
+}
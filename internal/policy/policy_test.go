@@ -0,0 +1,186 @@
+package policy
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const pinnedModule = `
+terraform {
+  required_version = ">= 1.3"
+  required_providers {
+    aws = {
+      source  = "hashicorp/aws"
+      version = "~> 5.0"
+    }
+  }
+}
+
+variable "name" {
+  description = "Name of the VPC"
+}
+
+resource "aws_vpc" "main" {
+  cidr_block = "10.0.0.0/16"
+}
+`
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules Rules
+		files map[string]string
+		want  []string
+	}{
+		{"compliant module", Rules{
+			ForbiddenResourceTypes:      []string{"aws_iam_*"},
+			ForbiddenProvisioners:       []string{"local-exec"},
+			RequireRequiredVersion:      true,
+			RequirePinnedProviders:      true,
+			RequireReadme:               true,
+			RequireVariableDescriptions: true,
+		}, map[string]string{"main.tf": pinnedModule, "README.md": "# vpc"}, nil},
+		{"no rules", Rules{}, map[string]string{"main.tf": `resource "aws_iam_user" "ci" {}`}, nil},
+
+		{"forbidden resource type pattern", Rules{ForbiddenResourceTypes: []string{"aws_iam_*"}}, map[string]string{
+			"main.tf": "resource \"aws_iam_user\" \"ci\" {}\nresource \"aws_vpc\" \"main\" {}\n",
+		}, []string{"main.tf:1: [forbidden_resource_types] resource aws_iam_user.ci has forbidden type aws_iam_user"}},
+		{"data sources are not forbidden resources", Rules{ForbiddenResourceTypes: []string{"aws_iam_*"}}, map[string]string{
+			"main.tf": `data "aws_iam_policy_document" "assume" {}`,
+		}, nil},
+		{"forbidden provisioner", Rules{ForbiddenProvisioners: []string{"local-exec"}}, map[string]string{
+			"main.tf": "resource \"null_resource\" \"run\" {\n  provisioner \"local-exec\" {\n    command = \"curl evil\"\n  }\n}\n",
+		}, []string{"main.tf:2: [forbidden_provisioners] resource null_resource.run uses the forbidden local-exec provisioner"}},
+		{"missing required_version", Rules{RequireRequiredVersion: true}, map[string]string{
+			"main.tf": `terraform {}`,
+		}, []string{"[required_version] terraform block must set required_version"}},
+		{"unpinned and undeclared providers", Rules{RequirePinnedProviders: true}, map[string]string{
+			"versions.tf": "terraform {\n  required_providers {\n    aws = {\n      source = \"hashicorp/aws\"\n    }\n  }\n}\n",
+			"main.tf":     "resource \"aws_vpc\" \"main\" {}\nresource \"random_id\" \"suffix\" {}\nresource \"random_pet\" \"name\" {}\nresource \"terraform_data\" \"run\" {}\n",
+		}, []string{
+			"versions.tf:3: [pinned_providers] provider aws must have a version constraint in required_providers",
+			"main.tf:2: [pinned_providers] provider random used by random_id.suffix must be declared in required_providers",
+		}},
+		{"legacy provider version string", Rules{RequirePinnedProviders: true}, map[string]string{
+			"main.tf": "terraform {\n  required_providers {\n    aws = \"~> 5.0\"\n  }\n}\nresource \"aws_vpc\" \"main\" {}\n",
+		}, nil},
+		{"aliased provider", Rules{RequirePinnedProviders: true}, map[string]string{
+			"main.tf": "resource \"aws_vpc\" \"main\" {\n  provider = google.west\n}\n",
+		}, []string{"main.tf:1: [pinned_providers] provider google used by aws_vpc.main must be declared in required_providers"}},
+		{"missing README", Rules{RequireReadme: true}, map[string]string{
+			"main.tf": pinnedModule,
+		}, []string{"[readme] module must have a README"}},
+		{"undescribed variable", Rules{RequireVariableDescriptions: true}, map[string]string{
+			"variables.tf": "variable \"name\" {\n  description = \"\"\n}\nvariable \"cidr\" {}\n",
+		}, []string{
+			"variables.tf:1: [variable_descriptions] variable name must have a description",
+			"variables.tf:4: [variable_descriptions] variable cidr must have a description",
+		}},
+		{"JSON configuration", Rules{ForbiddenResourceTypes: []string{"aws_iam_user"}}, map[string]string{
+			"main.tf.json": `{"resource": {"aws_iam_user": {"ci": {}}}}`,
+		}, []string{"[forbidden_resource_types] resource aws_iam_user.ci has forbidden type aws_iam_user"}},
+		{"syntax errors replace rule violations", Rules{RequireReadme: true}, map[string]string{
+			"main.tf": `resource "aws_vpc" {`,
+		}, []string{"main.tf:1: [syntax]"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[string][]byte{}
+			for name, content := range tt.files {
+				files[name] = []byte(content)
+			}
+			policy, err := tt.rules.Policy()
+			if err != nil {
+				t.Fatalf("Policy() unexpected error: %v", err)
+			}
+			violations := policy.Evaluate(parse(files))
+			if len(violations) != len(tt.want) {
+				t.Fatalf("Evaluate() = %q, want %d violations", violations, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if got := violations[i].String(); !strings.Contains(got, want) {
+					t.Fatalf("Evaluate() violation %d = %q, want it to contain %q", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadZip(t *testing.T) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"main.tf":                 `resource "aws_iam_user" "ci" {}`,
+		"README.md":               "# module",
+		"modules/iam/main.tf":     `resource "aws_iam_access_key" "ci" {}`,
+		"examples/basic/main.tf":  `resource "aws_iam_role" "ci" {}`,
+		"scripts/provision.sh.tf": `resource "aws_iam_group" "ci" {}`,
+	} {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	module, err := LoadZip(buf.Bytes())
+	if err != nil {
+		t.Fatalf("LoadZip() unexpected error: %v", err)
+	}
+	// Only the root module is checked, nested modules and examples are published as part of it but not used directly
+	if len(module.Resources) != 1 || module.Resources[0].Address() != "aws_iam_user.ci" {
+		t.Fatalf("LoadZip() resources = %+v, want only aws_iam_user.ci", module.Resources)
+	}
+	if module.Readme != "README.md" {
+		t.Fatalf("LoadZip() readme = %q, want README.md", module.Readme)
+	}
+}
+
+func TestLoadEngine(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+		wantOrg string
+	}{
+		{"rules per organization", map[string]string{"acme.yaml": "require_readme: true\n", "notes.txt": "ignored"}, "", "acme"},
+		{"yml extension", map[string]string{"acme.yml": "require_readme: true\n"}, "", "acme"},
+		{"duplicate organization", map[string]string{"acme.yaml": "require_readme: true\n", "acme.yml": "require_readme: true\n"}, "duplicate policy rules for organization acme", ""},
+		{"malformed pattern", map[string]string{"acme.yaml": "forbidden_resource_types: [\"[\"]\n"}, `forbidden resource type pattern "["`, ""},
+		{"unknown rule", map[string]string{"acme.yaml": "require_tests: true\n"}, "require_tests", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			engine, err := LoadEngine(dir)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadEngine() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadEngine() unexpected error: %v", err)
+			}
+			if engine.Policy(tt.wantOrg) == nil {
+				t.Fatalf("LoadEngine() has no policy for %s", tt.wantOrg)
+			}
+			if engine.Policy("globex") != nil {
+				t.Fatalf("LoadEngine() has a policy for an organization without rules")
+			}
+		})
+	}
+}
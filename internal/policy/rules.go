@@ -0,0 +1,152 @@
+package policy
+
+import (
+	"fmt"
+	"path"
+	"sort"
+)
+
+// ForbiddenResourceTypes rejects managed resources whose type matches any of the patterns
+type ForbiddenResourceTypes []string
+
+func (r ForbiddenResourceTypes) Name() string {
+	return RuleForbiddenResourceTypes
+}
+
+func (r ForbiddenResourceTypes) Check(module *Module) []Violation {
+	var violations []Violation
+	for _, resource := range module.Resources {
+		if resource.Mode != "managed" {
+			continue
+		}
+		for _, pattern := range r {
+			if matched, _ := path.Match(pattern, resource.Type); matched {
+				violations = append(violations, Violation{
+					Rule:     r.Name(),
+					Message:  fmt.Sprintf("resource %s has forbidden type %s", resource.Address(), resource.Type),
+					Position: resource.Position,
+				})
+				break
+			}
+		}
+	}
+	return violations
+}
+
+// ForbiddenProvisioners rejects resources using any of the provisioner types, such as local-exec
+type ForbiddenProvisioners []string
+
+func (r ForbiddenProvisioners) Name() string {
+	return RuleForbiddenProvisioners
+}
+
+func (r ForbiddenProvisioners) Check(module *Module) []Violation {
+	var violations []Violation
+	for _, resource := range module.Resources {
+		for _, provisioner := range resource.Provisioners {
+			for _, forbidden := range r {
+				if provisioner.Type == forbidden {
+					violations = append(violations, Violation{
+						Rule:     r.Name(),
+						Message:  fmt.Sprintf("resource %s uses the forbidden %s provisioner", resource.Address(), provisioner.Type),
+						Position: provisioner.Position,
+					})
+				}
+			}
+		}
+	}
+	return violations
+}
+
+// RequiredVersion requires the module to constrain the Terraform versions it supports
+type RequiredVersion struct{}
+
+func (r RequiredVersion) Name() string {
+	return RuleRequiredVersion
+}
+
+func (r RequiredVersion) Check(module *Module) []Violation {
+	for _, constraint := range module.RequiredVersions {
+		if constraint != "" {
+			return nil
+		}
+	}
+	return []Violation{{Rule: r.Name(), Message: "terraform block must set required_version"}}
+}
+
+// PinnedProviders requires a version constraint in required_providers for every provider the module declares or uses
+type PinnedProviders struct{}
+
+func (r PinnedProviders) Name() string {
+	return RulePinnedProviders
+}
+
+func (r PinnedProviders) Check(module *Module) []Violation {
+	var violations []Violation
+	names := make([]string, 0, len(module.RequiredProviders))
+	for name := range module.RequiredProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		requirement := module.RequiredProviders[name]
+		if requirement.Version == "" {
+			violations = append(violations, Violation{
+				Rule:     r.Name(),
+				Message:  fmt.Sprintf("provider %s must have a version constraint in required_providers", name),
+				Position: requirement.Position,
+			})
+		}
+	}
+	reported := map[string]bool{}
+	for _, resource := range module.Resources {
+		// The terraform provider is built in and never declared
+		if resource.Provider == "terraform" || reported[resource.Provider] {
+			continue
+		}
+		if _, ok := module.RequiredProviders[resource.Provider]; !ok {
+			reported[resource.Provider] = true
+			violations = append(violations, Violation{
+				Rule:     r.Name(),
+				Message:  fmt.Sprintf("provider %s used by %s must be declared in required_providers", resource.Provider, resource.Address()),
+				Position: resource.Position,
+			})
+		}
+	}
+	return violations
+}
+
+// Readme requires the module to be documented by a README
+type Readme struct{}
+
+func (r Readme) Name() string {
+	return RuleReadme
+}
+
+func (r Readme) Check(module *Module) []Violation {
+	if module.Readme != "" {
+		return nil
+	}
+	return []Violation{{Rule: r.Name(), Message: "module must have a README"}}
+}
+
+// VariableDescriptions requires every input variable to be described
+type VariableDescriptions struct{}
+
+func (r VariableDescriptions) Name() string {
+	return RuleVariableDescriptions
+}
+
+func (r VariableDescriptions) Check(module *Module) []Violation {
+	var violations []Violation
+	for _, variable := range module.Variables {
+		if variable.Description == "" {
+			violations = append(violations, Violation{
+				Rule:     r.Name(),
+				Message:  fmt.Sprintf("variable %s must have a description", variable.Name),
+				Position: variable.Position,
+			})
+		}
+	}
+	return violations
+}
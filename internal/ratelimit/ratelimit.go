@@ -0,0 +1,350 @@
+// Package ratelimit protects the registry from clients sending more requests than it can serve, such as a CI loop
+// running terraform init over and over. Every client gets a token bucket per class of route, refilling at a steady
+// rate up to a burst, and requests finding their bucket empty are rejected with a 429 and a Retry-After header.
+// Clients are identified by their authenticated identity, or by their address when anonymous.
+//
+// Archive downloads are additionally limited by a bandwidth quota per organization, a bucket of bytes refilling over
+// a period. Downloads are let through while the quota has bytes left and charged with the size of the archive served,
+// so that archives do not have to be read before deciding.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/terrariumcloud/terrarium-lite/internal/auth"
+	"github.com/terrariumcloud/terrarium-lite/internal/endpoints"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/responses"
+)
+
+// Class groups routes sharing a rate limit
+type Class string
+
+const (
+	// ClassProtocol covers the module registry protocol routes other than archive downloads
+	ClassProtocol Class = "protocol"
+	// ClassArchive covers archive downloads
+	ClassArchive Class = "archive"
+	// ClassPublish covers publishing module versions
+	ClassPublish Class = "publish"
+	// ClassAdmin covers the admin API
+	ClassAdmin Class = "admin"
+	// ClassEvents covers connecting to the event stream
+	ClassEvents Class = "events"
+)
+
+// Classes lists every class of route
+var Classes = []Class{ClassProtocol, ClassArchive, ClassPublish, ClassAdmin, ClassEvents}
+
+// ErrRateLimited is returned to clients sending requests faster than their rate limit allows
+var ErrRateLimited = responses.NewStatusError(http.StatusTooManyRequests, "rate limit exceeded")
+
+// ErrQuotaExceeded is returned for archive downloads of an organization which has used up its bandwidth quota
+var ErrQuotaExceeded = responses.NewStatusError(http.StatusTooManyRequests, "download quota exceeded")
+
+// sweepInterval is how often buckets of clients which have not sent requests for long enough to refill are discarded
+const sweepInterval = time.Minute
+
+// Limit is a token bucket allowing Rate requests per second on average and bursts of up to Burst requests. A limit
+// with a rate of zero allows every request.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Quota allows an organization to serve Bytes of archives per Period. A quota of zero bytes is unlimited.
+type Quota struct {
+	Bytes  int64
+	Period time.Duration
+}
+
+// Config sets the limit of every class of route and the bandwidth quotas of organizations
+type Config struct {
+	Classes map[Class]Limit
+	// DefaultQuota applies to organizations without a quota of their own
+	DefaultQuota Quota
+	Quotas       map[string]Quota
+}
+
+type clientKey struct {
+	class  Class
+	client string
+}
+
+// Limiter enforces rate limits and bandwidth quotas. It implements prometheus.Collector to export its state.
+type Limiter struct {
+	config        Config
+	mu            sync.Mutex
+	clients       map[clientKey]*bucket
+	organizations map[string]*bucket
+	rejected      map[Class]uint64
+	overQuota     map[string]uint64
+	lastSweep     time.Time
+}
+
+// New creates a Limiter
+func New(config Config) *Limiter {
+	return &Limiter{
+		config:        config,
+		clients:       map[clientKey]*bucket{},
+		organizations: map[string]*bucket{},
+		rejected:      map[Class]uint64{},
+		overQuota:     map[string]uint64{},
+		lastSweep:     time.Now(),
+	}
+}
+
+// ClassOf returns the class of a named route, or an empty class for routes which are not limited such as health
+// checks and metrics
+func ClassOf(routeName string) Class {
+	switch {
+	case routeName == endpoints.ModuleArchiveRoute:
+		return ClassArchive
+	case routeName == endpoints.ModulePublishRoute:
+		return ClassPublish
+	case routeName == endpoints.EventsRoute:
+		return ClassEvents
+	case strings.HasPrefix(routeName, endpoints.ModuleRoutePrefix):
+		return ClassProtocol
+	case strings.HasPrefix(routeName, endpoints.AdminRoutePrefix):
+		return ClassAdmin
+	}
+	return ""
+}
+
+// Middleware rejects requests exceeding the rate limit of their client and route class, and archive downloads of
+// organizations over their quota. It must run after auth.Middleware so that clients are identified by their identity,
+// and before auth.RejectInvalidCredentials so that clients presenting invalid credentials are limited by address.
+// Rejections are written by the error writer selected for the request.
+func (l *Limiter) Middleware(errorHandlers responses.ErrorWriterSelector) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			route := mux.CurrentRoute(r)
+			if route == nil {
+				next.ServeHTTP(rw, r)
+				return
+			}
+			class := ClassOf(route.GetName())
+			if class == "" {
+				next.ServeHTTP(rw, r)
+				return
+			}
+			if wait, ok := l.AllowRequest(class, Client(r)); !ok {
+				writeRejection(rw, errorHandlers(r), ErrRateLimited, wait)
+				return
+			}
+			if class != ClassArchive {
+				next.ServeHTTP(rw, r)
+				return
+			}
+			orgName := mux.Vars(r)["organization_name"]
+			if wait, ok := l.AllowDownload(orgName); !ok {
+				writeRejection(rw, errorHandlers(r), fmt.Errorf("%w for organization %q", ErrQuotaExceeded, orgName), wait)
+				return
+			}
+			snoop := httpsnoop.CaptureMetrics(next, rw, r)
+			if snoop.Code == http.StatusOK {
+				l.ChargeDownload(orgName, snoop.Written)
+			}
+		})
+	}
+}
+
+// Client identifies the client of a request by its identity, or by its address when it is anonymous
+func Client(r *http.Request) string {
+	if identity := auth.IdentityFromContext(r.Context()); identity != nil {
+		return fmt.Sprintf("%s:%s", identity.Type, identity.Subject)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "address:" + host
+}
+
+// AllowRequest takes a token from the bucket of a client for a class of route. When it is empty it returns how long
+// until a token is available.
+func (l *Limiter) AllowRequest(class Class, client string) (time.Duration, bool) {
+	limit, ok := l.config.Classes[class]
+	if !ok || limit.Rate <= 0 {
+		return 0, true
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	key := clientKey{class: class, client: client}
+	b, ok := l.clients[key]
+	if !ok {
+		b = newBucket(limit.Rate, float64(limit.Burst), now)
+		l.clients[key] = b
+	}
+	b.refill(now)
+	if b.tokens < 1 {
+		l.rejected[class]++
+		return b.wait(1), false
+	}
+	b.tokens--
+	return 0, true
+}
+
+// AllowDownload reports whether an organization has at least a byte left in its quota, as the fraction of a byte
+// refilled between a download using up the quota and the next must not let it through. When it has not it returns
+// how long until it has. Organizations which have not been charged for a download yet have their whole quota left, so no
+// bucket is created for names which do not resolve to a module.
+func (l *Limiter) AllowDownload(orgName string) (time.Duration, bool) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	b := l.quotaBucket(orgName, now, false)
+	if b == nil || b.tokens >= 1 {
+		return 0, true
+	}
+	l.overQuota[orgName]++
+	return b.wait(1), false
+}
+
+// ChargeDownload takes the bytes of an archive served from the quota of an organization. The quota may go below zero
+// when the archive was larger than what was left, delaying further downloads until it is paid back.
+func (l *Limiter) ChargeDownload(orgName string, bytes int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b := l.quotaBucket(orgName, time.Now(), true); b != nil {
+		b.tokens -= float64(bytes)
+	}
+}
+
+// quotaBucket returns the refilled quota bucket of an organization, or nil when its downloads are unlimited or, unless
+// create is set, it has no bucket yet. It must be called holding the lock.
+func (l *Limiter) quotaBucket(orgName string, now time.Time, create bool) *bucket {
+	quota, ok := l.config.Quotas[orgName]
+	if !ok {
+		quota = l.config.DefaultQuota
+	}
+	if quota.Bytes <= 0 || quota.Period <= 0 {
+		return nil
+	}
+	b, ok := l.organizations[orgName]
+	if !ok {
+		if !create {
+			return nil
+		}
+		b = newBucket(float64(quota.Bytes)/quota.Period.Seconds(), float64(quota.Bytes), now)
+		l.organizations[orgName] = b
+	}
+	b.refill(now)
+	return b
+}
+
+// sweep discards the buckets of clients and organizations which have refilled completely, as a new bucket would be
+// in the same state. It must be called holding the lock.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.clients {
+		b.refill(now)
+		if b.tokens >= b.burst {
+			delete(l.clients, key)
+		}
+	}
+	for orgName, b := range l.organizations {
+		b.refill(now)
+		if b.tokens >= b.burst {
+			delete(l.organizations, orgName)
+		}
+	}
+}
+
+var (
+	rejectedDesc = prometheus.NewDesc("terrarium_rate_limit_rejected_requests_total",
+		"Total number of requests rejected for exceeding the rate limit by route class.", []string{"class"}, nil)
+	clientsDesc = prometheus.NewDesc("terrarium_rate_limit_clients",
+		"Number of clients currently tracked by the rate limiter by route class.", []string{"class"}, nil)
+	overQuotaDesc = prometheus.NewDesc("terrarium_quota_rejected_downloads_total",
+		"Total number of archive downloads rejected for exceeding the bandwidth quota by organization.", []string{"organization"}, nil)
+	remainingDesc = prometheus.NewDesc("terrarium_quota_remaining_bytes",
+		"Bytes left in the bandwidth quota by organization. Negative while a download larger than what was left is paid back.", []string{"organization"}, nil)
+)
+
+// Describe implements prometheus.Collector
+func (l *Limiter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- rejectedDesc
+	ch <- clientsDesc
+	ch <- overQuotaDesc
+	ch <- remainingDesc
+}
+
+// Collect implements prometheus.Collector, exporting the current state of the buckets. Organizations are reported
+// from their first download until their quota has refilled completely and their bucket is swept.
+func (l *Limiter) Collect(ch chan<- prometheus.Metric) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	clients := map[Class]int{}
+	for key := range l.clients {
+		clients[key.class]++
+	}
+	for _, class := range Classes {
+		if _, ok := l.config.Classes[class]; !ok {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(rejectedDesc, prometheus.CounterValue, float64(l.rejected[class]), string(class))
+		ch <- prometheus.MustNewConstMetric(clientsDesc, prometheus.GaugeValue, float64(clients[class]), string(class))
+	}
+	for orgName, b := range l.organizations {
+		b.refill(now)
+		ch <- prometheus.MustNewConstMetric(remainingDesc, prometheus.GaugeValue, b.tokens, orgName)
+		ch <- prometheus.MustNewConstMetric(overQuotaDesc, prometheus.CounterValue, float64(l.overQuota[orgName]), orgName)
+	}
+}
+
+// writeRejection writes a 429 telling the client to retry once the wait is over, rounded up to whole seconds
+func writeRejection(rw http.ResponseWriter, errorHandler responses.APIErrorWriter, err error, wait time.Duration) {
+	seconds := int64(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	rw.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	errorHandler.Write(rw, err, http.StatusTooManyRequests)
+}
+
+// bucket holds tokens refilling at a steady rate up to a burst
+type bucket struct {
+	rate    float64
+	burst   float64
+	tokens  float64
+	updated time.Time
+}
+
+func newBucket(rate float64, burst float64, now time.Time) *bucket {
+	return &bucket{rate: rate, burst: burst, tokens: burst, updated: now}
+}
+
+// refill adds the tokens accrued since the last refill
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+	}
+	b.updated = now
+}
+
+// wait returns how long until the bucket holds the given number of tokens
+func (b *bucket) wait(tokens float64) time.Duration {
+	missing := tokens - b.tokens
+	if missing <= 0 {
+		return 0
+	}
+	return time.Duration(missing / b.rate * float64(time.Second))
+}
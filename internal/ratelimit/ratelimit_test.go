@@ -0,0 +1,225 @@
+package ratelimit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/terrariumcloud/terrarium-lite/internal/endpoints"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/responses"
+)
+
+// slowRate refills so slowly that no token is added while a test runs
+const slowRate = 0.001
+
+func TestAllowRequest(t *testing.T) {
+	type request struct {
+		class  Class
+		client string
+		want   bool
+	}
+	tests := []struct {
+		name     string
+		classes  map[Class]Limit
+		requests []request
+	}{
+		{"burst then rejected", map[Class]Limit{ClassProtocol: {Rate: slowRate, Burst: 2}}, []request{
+			{ClassProtocol, "user:alice", true},
+			{ClassProtocol, "user:alice", true},
+			{ClassProtocol, "user:alice", false},
+			{ClassProtocol, "user:alice", false},
+		}},
+		{"buckets per client", map[Class]Limit{ClassProtocol: {Rate: slowRate, Burst: 1}}, []request{
+			{ClassProtocol, "user:alice", true},
+			{ClassProtocol, "user:alice", false},
+			{ClassProtocol, "user:bob", true},
+			{ClassProtocol, "address:192.0.2.1", true},
+			{ClassProtocol, "address:192.0.2.1", false},
+		}},
+		{"buckets per class", map[Class]Limit{ClassProtocol: {Rate: slowRate, Burst: 1}, ClassPublish: {Rate: slowRate, Burst: 1}}, []request{
+			{ClassProtocol, "user:alice", true},
+			{ClassPublish, "user:alice", true},
+			{ClassPublish, "user:alice", false},
+			{ClassProtocol, "user:alice", false},
+		}},
+		{"zero rate is unlimited", map[Class]Limit{ClassProtocol: {Rate: 0, Burst: 0}}, []request{
+			{ClassProtocol, "user:alice", true},
+			{ClassProtocol, "user:alice", true},
+		}},
+		{"unconfigured class is unlimited", map[Class]Limit{ClassProtocol: {Rate: slowRate, Burst: 1}}, []request{
+			{ClassAdmin, "user:alice", true},
+			{ClassAdmin, "user:alice", true},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := New(Config{Classes: tt.classes})
+			for i, req := range tt.requests {
+				wait, ok := l.AllowRequest(req.class, req.client)
+				if ok != req.want {
+					t.Fatalf("request %d: AllowRequest(%s, %s) = %t, want %t", i, req.class, req.client, ok, req.want)
+				}
+				if !ok && wait <= 0 {
+					t.Fatalf("request %d: AllowRequest() rejected the request without a wait", i)
+				}
+			}
+		})
+	}
+}
+
+func TestDownloadQuota(t *testing.T) {
+	type download struct {
+		org  string
+		size int64
+		want bool
+	}
+	day := 24 * time.Hour
+	tests := []struct {
+		name      string
+		config    Config
+		downloads []download
+	}{
+		{"charged until used up", Config{DefaultQuota: Quota{Bytes: 100, Period: day}}, []download{
+			{"acme", 60, true},
+			{"acme", 30, true},
+			{"acme", 10, true},
+			{"acme", 10, false},
+		}},
+		{"last download may overdraw", Config{DefaultQuota: Quota{Bytes: 100, Period: day}}, []download{
+			{"acme", 90, true},
+			{"acme", 50, true},
+			{"acme", 1, false},
+		}},
+		{"quotas per organization", Config{DefaultQuota: Quota{Bytes: 100, Period: day}}, []download{
+			{"acme", 100, true},
+			{"acme", 1, false},
+			{"globex", 100, true},
+		}},
+		{"organization quota overrides the default", Config{DefaultQuota: Quota{Bytes: 100, Period: day}, Quotas: map[string]Quota{"acme": {Bytes: 1000, Period: day}}}, []download{
+			{"acme", 500, true},
+			{"acme", 400, true},
+			{"globex", 100, true},
+			{"globex", 1, false},
+		}},
+		{"organization without quota is unlimited", Config{DefaultQuota: Quota{Bytes: 100, Period: day}, Quotas: map[string]Quota{"acme": {}}}, []download{
+			{"acme", 1000, true},
+			{"acme", 1000, true},
+		}},
+		{"no quota", Config{}, []download{
+			{"acme", 1 << 40, true},
+			{"acme", 1 << 40, true},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := New(tt.config)
+			for i, d := range tt.downloads {
+				wait, ok := l.AllowDownload(d.org)
+				if ok != d.want {
+					t.Fatalf("download %d: AllowDownload(%s) = %t, want %t", i, d.org, ok, d.want)
+				}
+				if !ok {
+					if wait <= 0 {
+						t.Fatalf("download %d: AllowDownload() rejected the download without a wait", i)
+					}
+					continue
+				}
+				l.ChargeDownload(d.org, d.size)
+			}
+		})
+	}
+}
+
+func TestBucket(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	tests := []struct {
+		name       string
+		tokens     float64
+		elapsed    time.Duration
+		wantTokens float64
+		wantWait   time.Duration
+	}{
+		{"refills at the rate", 0, 2 * time.Second, 4, 0},
+		{"refills up to the burst", 0, time.Minute, 10, 0},
+		{"pays back an overdraft", -10, 2 * time.Second, -6, 3500 * time.Millisecond},
+		{"clock going backwards", 5, -time.Second, 5, 0},
+		{"empty", 0, 0, 0, 500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBucket(2, 10, start)
+			b.tokens = tt.tokens
+			b.refill(start.Add(tt.elapsed))
+			if b.tokens != tt.wantTokens {
+				t.Fatalf("refill() tokens = %g, want %g", b.tokens, tt.wantTokens)
+			}
+			if wait := b.wait(1); wait != tt.wantWait {
+				t.Fatalf("wait(1) = %s, want %s", wait, tt.wantWait)
+			}
+		})
+	}
+}
+
+type statusWriter struct{}
+
+func (statusWriter) Write(rw http.ResponseWriter, err error, statusCode int) {
+	var typed responses.StatusError
+	if errors.As(err, &typed) {
+		statusCode = typed.StatusCode()
+	}
+	http.Error(rw, err.Error(), statusCode)
+}
+
+func TestMiddleware(t *testing.T) {
+	l := New(Config{
+		Classes:      map[Class]Limit{ClassProtocol: {Rate: slowRate, Burst: 1}, ClassArchive: {Rate: slowRate, Burst: 10}},
+		DefaultQuota: Quota{Bytes: 10, Period: 24 * time.Hour},
+	})
+	router := mux.NewRouter()
+	router.Use(l.Middleware(func(*http.Request) responses.APIErrorWriter { return statusWriter{} }))
+	router.Handle("/{organization_name}/versions", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {})).Name(endpoints.ModuleVersionsRoute)
+	router.Handle("/{organization_name}/archive", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("missing") != "" {
+			http.NotFound(rw, r)
+			return
+		}
+		rw.Write([]byte("0123456789"))
+	})).Name(endpoints.ModuleArchiveRoute)
+	router.Handle("/healthz", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name       string
+		path       string
+		remoteAddr string
+		wantStatus int
+		wantBody   string
+	}{
+		{"first request", "/acme/versions", "192.0.2.1:1234", http.StatusOK, ""},
+		{"over the rate limit", "/acme/versions", "192.0.2.1:5678", http.StatusTooManyRequests, "rate limit exceeded"},
+		{"another address", "/acme/versions", "192.0.2.2:1234", http.StatusOK, ""},
+		{"unnamed routes are not limited", "/healthz", "192.0.2.1:1234", http.StatusOK, ""},
+		{"failed downloads are not charged", "/acme/archive?missing=1", "192.0.2.1:1234", http.StatusNotFound, ""},
+		{"download within the quota", "/acme/archive", "192.0.2.1:1234", http.StatusOK, ""},
+		{"download over the quota", "/acme/archive", "192.0.2.2:1234", http.StatusTooManyRequests, `download quota exceeded for organization "acme"`},
+		{"download of another organization", "/globex/archive", "192.0.2.1:1234", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.RemoteAddr = tt.remoteAddr
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != tt.wantStatus {
+			t.Fatalf("%s: status = %d, want %d", tt.name, rec.Code, tt.wantStatus)
+		}
+		if tt.wantStatus == http.StatusTooManyRequests && rec.Header().Get("Retry-After") == "" {
+			t.Fatalf("%s: rejection without a Retry-After header", tt.name)
+		}
+		if !strings.Contains(rec.Body.String(), tt.wantBody) {
+			t.Fatalf("%s: body = %q, want it to contain %q", tt.name, rec.Body.String(), tt.wantBody)
+		}
+	}
+}
@@ -3,9 +3,11 @@ package responder
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 
+	"github.com/sirupsen/logrus"
+	"github.com/terrariumcloud/terrarium-lite/internal/logging"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/responses"
 	"gopkg.in/errgo.v2/errors"
 )
 
@@ -14,10 +16,20 @@ const InternalServerErrorPrefix string = "Internal Server Error"
 const NotFoundPrefix string = "404 Not Found"
 const UnprocessablePrefix string = "Unprocessable Entity"
 const NotImplementedPrefix string = "Not Implemented"
+const UnauthorizedPrefix string = "Unauthorized"
+const ForbiddenPrefix string = "Forbidden"
+const ConflictPrefix string = "Conflict"
+const PayloadTooLargePrefix string = "Payload Too Large"
+const TooManyRequestsPrefix string = "Too Many Requests"
 
-type TerrariumAPIErrorHandler struct{}
+// TerrariumAPIErrorHandler writes errors in the Terrarium envelope, with the status code, a message prefixed with the
+// status and the request ID. It answers the admin and event stream APIs.
+type TerrariumAPIErrorHandler struct {
+	Logger logrus.FieldLogger
+}
 
 func (t *TerrariumAPIErrorHandler) Write(rw http.ResponseWriter, err error, statusCode int) {
+	statusCode = StatusCode(err, statusCode)
 	var prefix string = ""
 	switch statusCode {
 	case http.StatusInternalServerError:
@@ -30,20 +42,73 @@ func (t *TerrariumAPIErrorHandler) Write(rw http.ResponseWriter, err error, stat
 		prefix = UnprocessablePrefix
 	case http.StatusNotImplemented:
 		prefix = NotImplementedPrefix
+	case http.StatusUnauthorized:
+		prefix = UnauthorizedPrefix
+	case http.StatusForbidden:
+		prefix = ForbiddenPrefix
+	case http.StatusConflict:
+		prefix = ConflictPrefix
+	case http.StatusRequestEntityTooLarge:
+		prefix = PayloadTooLargePrefix
+	case http.StatusTooManyRequests:
+		prefix = TooManyRequestsPrefix
 	default:
 
 	}
+	// The request ID is set on the response by the logging middleware before any handler runs
+	requestID := rw.Header().Get(logging.RequestIDHeader)
 	resp := &TerrariumServerResponse{
-		Code:    statusCode,
-		Message: fmt.Sprintf("%s - %s", prefix, err.Error()),
+		Code:      statusCode,
+		Message:   fmt.Sprintf("%s - %s", prefix, err.Error()),
+		RequestID: requestID,
+	}
+	if detailed, ok := err.(responses.DetailedError); ok {
+		resp.Details = detailed.Details()
+	}
+	writeError(rw, logger(t.Logger), err, statusCode, resp)
+}
+
+// RegistryErrorHandler writes errors in the format of the Terraform registry protocols, a list of messages which
+// Terraform shows to users as they are. Structured details are added alongside for clients that understand them.
+// It answers the module registry protocol routes.
+type RegistryErrorHandler struct {
+	Logger logrus.FieldLogger
+}
+
+func (t *RegistryErrorHandler) Write(rw http.ResponseWriter, err error, statusCode int) {
+	statusCode = StatusCode(err, statusCode)
+	resp := &RegistryErrorResponse{
+		Errors: []string{err.Error()},
+	}
+	if detailed, ok := err.(responses.DetailedError); ok {
+		resp.Details = detailed.Details()
+	}
+	writeError(rw, logger(t.Logger), err, statusCode, resp)
+}
+
+// writeError logs an error, as an error for server failures and for debugging otherwise, and writes its response
+func writeError(rw http.ResponseWriter, log logrus.FieldLogger, err error, statusCode int, resp interface{}) {
+	requestID := rw.Header().Get(logging.RequestIDHeader)
+	entry := log.WithFields(logrus.Fields{"request_id": requestID, "status": statusCode})
+	if statusCode >= http.StatusInternalServerError {
+		entry.WithError(err).Error("request failed")
+	} else {
+		entry.WithError(err).Debug("request rejected")
 	}
 	jsonData, err := json.MarshalIndent(resp, "", "   ")
 	if err != nil {
 		rw.WriteHeader(http.StatusInternalServerError)
-		log.Printf("+%v", errors.Wrap(err))
+		log.Errorf("+%v", errors.Wrap(err))
 		return
 	}
 	rw.Header().Add("Content-Type", "application/json")
 	rw.WriteHeader(statusCode)
 	rw.Write(jsonData)
 }
+
+func logger(log logrus.FieldLogger) logrus.FieldLogger {
+	if log == nil {
+		return logging.Default()
+	}
+	return log
+}
@@ -0,0 +1,123 @@
+package responder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/terrariumcloud/terrarium-lite/internal/logging"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/responses"
+)
+
+var errQuota = responses.NewStatusError(http.StatusTooManyRequests, "download quota exceeded")
+
+type problemsError []string
+
+func (e problemsError) Error() string {
+	return fmt.Sprintf("%d problems found", len(e))
+}
+
+func (e problemsError) Details() interface{} {
+	return []string(e)
+}
+
+func TestStatusCode(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		statusCode int
+		want       int
+	}{
+		{"typed error", errQuota, http.StatusInternalServerError, http.StatusTooManyRequests},
+		{"wrapped typed error", fmt.Errorf("failed fetching archive - %w", errQuota), http.StatusInternalServerError, http.StatusTooManyRequests},
+		{"first typed error in the chain", fmt.Errorf("%w - %w", responses.NewStatusError(http.StatusNotFound, "module not found"), errQuota), http.StatusInternalServerError, http.StatusNotFound},
+		{"plain error", errors.New("disk full"), http.StatusInternalServerError, http.StatusInternalServerError},
+		{"wrapped message only", fmt.Errorf("failed fetching archive - %v", errQuota), http.StatusBadGateway, http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StatusCode(tt.err, tt.statusCode); got != tt.want {
+				t.Fatalf("StatusCode() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTerrariumAPIErrorHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		statusCode  int
+		wantCode    int
+		wantMessage string
+		wantDetails interface{}
+	}{
+		{"server error", errors.New("disk full"), http.StatusInternalServerError, http.StatusInternalServerError, "Internal Server Error - disk full", nil},
+		{"typed error", fmt.Errorf("failed downloading - %w", errQuota), http.StatusInternalServerError, http.StatusTooManyRequests, "Too Many Requests - failed downloading - download quota exceeded", nil},
+		{"detailed error", problemsError{"main.tf:1: forbidden"}, http.StatusUnprocessableEntity, http.StatusUnprocessableEntity, "Unprocessable Entity - 1 problems found", []interface{}{"main.tf:1: forbidden"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			rec.Header().Set(logging.RequestIDHeader, "req-1")
+			(&TerrariumAPIErrorHandler{Logger: logrus.New()}).Write(rec, tt.err, tt.statusCode)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if contentType := rec.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Fatalf("content type = %q, want application/json", contentType)
+			}
+			var resp TerrariumServerResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed decoding response %s: %v", rec.Body.String(), err)
+			}
+			if resp.Code != tt.wantCode || resp.Message != tt.wantMessage || resp.RequestID != "req-1" {
+				t.Fatalf("response = %+v, want code %d, message %q and request ID req-1", resp, tt.wantCode, tt.wantMessage)
+			}
+			if fmt.Sprint(resp.Details) != fmt.Sprint(tt.wantDetails) {
+				t.Fatalf("details = %v, want %v", resp.Details, tt.wantDetails)
+			}
+		})
+	}
+}
+
+func TestRegistryErrorHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		statusCode int
+		wantCode   int
+		wantBody   string
+	}{
+		{"plain error", errors.New("module not found"), http.StatusNotFound, http.StatusNotFound, `{"errors":["module not found"]}`},
+		{"typed error", fmt.Errorf("failed downloading - %w", errQuota), http.StatusInternalServerError, http.StatusTooManyRequests, `{"errors":["failed downloading - download quota exceeded"]}`},
+		{"detailed error", problemsError{"main.tf:1: forbidden"}, http.StatusUnprocessableEntity, http.StatusUnprocessableEntity, `{"errors":["1 problems found"],"details":["main.tf:1: forbidden"]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			(&RegistryErrorHandler{Logger: logrus.New()}).Write(rec, tt.err, tt.statusCode)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			// Terraform shows the messages of the errors list to users, the body must not use the Terrarium envelope
+			var compact map[string]interface{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &compact); err != nil {
+				t.Fatalf("failed decoding response %s: %v", rec.Body.String(), err)
+			}
+			got, _ := json.Marshal(compact)
+			var want map[string]interface{}
+			json.Unmarshal([]byte(tt.wantBody), &want)
+			wantBody, _ := json.Marshal(want)
+			if string(got) != string(wantBody) {
+				t.Fatalf("body = %s, want %s", got, wantBody)
+			}
+		})
+	}
+}
@@ -2,13 +2,23 @@ package responder
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 
+	"github.com/sirupsen/logrus"
+	"github.com/terrariumcloud/terrarium-lite/internal/logging"
 	"gopkg.in/errgo.v2/errors"
 )
 
-type TerrariumAPIResponseWriter struct{}
+type TerrariumAPIResponseWriter struct {
+	Logger logrus.FieldLogger
+}
+
+func (t *TerrariumAPIResponseWriter) logger() logrus.FieldLogger {
+	if t.Logger == nil {
+		return logging.Default()
+	}
+	return t.Logger
+}
 
 func (t *TerrariumAPIResponseWriter) Write(rw http.ResponseWriter, data interface{}, statusCode int) {
 	resp := &TerrariumDataResponse{
@@ -18,7 +28,7 @@ func (t *TerrariumAPIResponseWriter) Write(rw http.ResponseWriter, data interfac
 	jsonData, err := json.MarshalIndent(resp, "", "   ")
 	if err != nil {
 		rw.WriteHeader(http.StatusInternalServerError)
-		log.Printf("+%v", errors.Wrap(err))
+		t.logger().Errorf("+%v", errors.Wrap(err))
 		return
 	}
 	rw.Header().Add("Content-Type", "application/json")
@@ -32,7 +42,7 @@ func (t *TerrariumAPIResponseWriter) WriteRaw(rw http.ResponseWriter, data inter
 	jsonData, err := json.MarshalIndent(data, "", "   ")
 	if err != nil {
 		rw.WriteHeader(http.StatusInternalServerError)
-		log.Printf("+%v", errors.Wrap(err))
+		t.logger().Errorf("+%v", errors.Wrap(err))
 		return
 	}
 	rw.Header().Add("Content-Type", "application/json")
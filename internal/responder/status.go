@@ -0,0 +1,17 @@
+package responder
+
+import (
+	"errors"
+
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/responses"
+)
+
+// StatusCode returns the status code carried by a responses.StatusError in the chain of an error, or the given status
+// code for other errors
+func StatusCode(err error, statusCode int) int {
+	var typed responses.StatusError
+	if errors.As(err, &typed) {
+		return typed.StatusCode()
+	}
+	return statusCode
+}
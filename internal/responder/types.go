@@ -6,6 +6,14 @@ type TerrariumDataResponse struct {
 }
 
 type TerrariumServerResponse struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Code      int         `json:"code"`
+	Message   string      `json:"message"`
+	RequestID string      `json:"request_id,omitempty"`
+	Details   interface{} `json:"details,omitempty"`
+}
+
+// RegistryErrorResponse is an error response of the Terraform registry protocols
+type RegistryErrorResponse struct {
+	Errors  []string    `json:"errors"`
+	Details interface{} `json:"details,omitempty"`
 }
@@ -0,0 +1,209 @@
+// Package signing verifies detached signatures of module archives against public keys trusted per organization.
+// Publishers sign archives with an ed25519 key, for example using `openssl pkeyutl -sign -rawin`, or with a GPG key
+// using `gpg --detach-sign`. Trusted keys are configured in a YAML file:
+//
+//	organizations:
+//	  acme:
+//	    - id: release
+//	      type: ed25519
+//	      public_key: |
+//	        -----BEGIN PUBLIC KEY-----
+//	        ...
+//	  "*":
+//	    - id: platform-team
+//	      type: pgp
+//	      public_key: |
+//	        -----BEGIN PGP PUBLIC KEY BLOCK-----
+//	        ...
+//
+// Keys listed under "*" are trusted for every organization.
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/responses"
+	"gopkg.in/yaml.v2"
+)
+
+// KeyType is the kind of key a signature is made with
+type KeyType string
+
+const (
+	KeyTypeEd25519 KeyType = "ed25519"
+	KeyTypePGP     KeyType = "pgp"
+)
+
+// AnyOrganization lists keys trusted for every organization
+const AnyOrganization string = "*"
+
+// ErrNoTrustedKeys is returned when verifying a signature for an organization without trusted keys
+var ErrNoTrustedKeys = responses.NewStatusError(http.StatusUnprocessableEntity, "no trusted signing keys configured for organization")
+
+// ErrInvalidSignature is returned when a signature was not made by any key trusted for the organization
+var ErrInvalidSignature = responses.NewStatusError(http.StatusUnprocessableEntity, "signature does not match any trusted key")
+
+// PublicKey is a key trusted to sign archives of an organization
+type PublicKey struct {
+	ID        string  `yaml:"id" json:"id"`
+	Type      KeyType `yaml:"type" json:"type"`
+	PublicKey string  `yaml:"public_key" json:"public_key"`
+
+	ed25519Key ed25519.PublicKey
+	pgpKeyring openpgp.EntityList
+}
+
+// TrustedKeys holds the public keys trusted per organization
+type TrustedKeys struct {
+	Organizations map[string][]*PublicKey `yaml:"organizations"`
+}
+
+// LoadTrustedKeys reads and parses a trusted keys file
+func LoadTrustedKeys(path string) (*TrustedKeys, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading trusted keys - %w", err)
+	}
+	keys := &TrustedKeys{}
+	if err := yaml.UnmarshalStrict(data, keys); err != nil {
+		return nil, fmt.Errorf("failed parsing trusted keys %s - %w", path, err)
+	}
+	for orgName, orgKeys := range keys.Organizations {
+		for i, key := range orgKeys {
+			if key.ID == "" {
+				return nil, fmt.Errorf("trusted key %d of organization %s has no id", i, orgName)
+			}
+			if err := key.parse(); err != nil {
+				return nil, fmt.Errorf("trusted key %s of organization %s - %w", key.ID, orgName, err)
+			}
+		}
+	}
+	return keys, nil
+}
+
+// Keys returns the keys trusted for an organization
+func (t *TrustedKeys) Keys(orgName string) []*PublicKey {
+	if t == nil {
+		return nil
+	}
+	keys := append([]*PublicKey{}, t.Organizations[orgName]...)
+	return append(keys, t.Organizations[AnyOrganization]...)
+}
+
+// Verify checks a detached signature of an archive against the keys of the given type trusted for the organization
+// and returns the ID of the key that made it
+func (t *TrustedKeys) Verify(orgName string, keyType KeyType, archive []byte, signature []byte) (string, error) {
+	keys := t.Keys(orgName)
+	if len(keys) == 0 {
+		return "", ErrNoTrustedKeys
+	}
+	for _, key := range keys {
+		if key.Type == keyType && key.Verify(archive, signature) == nil {
+			return key.ID, nil
+		}
+	}
+	return "", ErrInvalidSignature
+}
+
+// Verify checks a detached signature of an archive made with this key
+func (k *PublicKey) Verify(archive []byte, signature []byte) error {
+	if k.ed25519Key == nil && k.pgpKeyring == nil {
+		if err := k.parse(); err != nil {
+			return err
+		}
+	}
+	switch k.Type {
+	case KeyTypeEd25519:
+		raw, err := decodeEd25519Signature(signature)
+		if err != nil {
+			return err
+		}
+		if !ed25519.Verify(k.ed25519Key, archive, raw) {
+			return ErrInvalidSignature
+		}
+		return nil
+	case KeyTypePGP:
+		check := openpgp.CheckDetachedSignature
+		if bytes.HasPrefix(bytes.TrimSpace(signature), []byte("-----BEGIN PGP")) {
+			check = openpgp.CheckArmoredDetachedSignature
+		}
+		if _, err := check(k.pgpKeyring, bytes.NewReader(archive), bytes.NewReader(signature), nil); err != nil {
+			return fmt.Errorf("%w - %s", ErrInvalidSignature, err.Error())
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown key type %q", k.Type)
+	}
+}
+
+// ParseKeyType validates the name of a key type
+func ParseKeyType(value string) (KeyType, error) {
+	switch KeyType(value) {
+	case KeyTypeEd25519, KeyTypePGP:
+		return KeyType(value), nil
+	default:
+		return "", fmt.Errorf("signature type must be %s or %s, got %q", KeyTypeEd25519, KeyTypePGP, value)
+	}
+}
+
+func (k *PublicKey) parse() error {
+	switch k.Type {
+	case KeyTypeEd25519:
+		key, err := parseEd25519PublicKey(k.PublicKey)
+		if err != nil {
+			return err
+		}
+		k.ed25519Key = key
+	case KeyTypePGP:
+		keyring, err := openpgp.ReadArmoredKeyRing(strings.NewReader(k.PublicKey))
+		if err != nil {
+			return fmt.Errorf("failed parsing PGP public key - %w", err)
+		}
+		k.pgpKeyring = keyring
+	default:
+		return fmt.Errorf("type must be %s or %s, got %q", KeyTypeEd25519, KeyTypePGP, k.Type)
+	}
+	return nil
+}
+
+// parseEd25519PublicKey accepts a PEM encoded PKIX public key, as written by openssl, or the base64 encoded raw key
+func parseEd25519PublicKey(value string) (ed25519.PublicKey, error) {
+	if block, _ := pem.Decode([]byte(value)); block != nil {
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing ed25519 public key - %w", err)
+		}
+		key, ok := parsed.(ed25519.PublicKey)
+		if !ok {
+			return nil, errors.New("public key is not an ed25519 key")
+		}
+		return key, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		return nil, errors.New("ed25519 public key must be PEM encoded or a base64 encoded 32 byte key")
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// decodeEd25519Signature accepts a raw 64 byte signature or its base64 encoding
+func decodeEd25519Signature(signature []byte) ([]byte, error) {
+	if len(signature) == ed25519.SignatureSize {
+		return signature, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil || len(raw) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("%w - ed25519 signatures must be 64 bytes, raw or base64 encoded", ErrInvalidSignature)
+	}
+	return raw, nil
+}
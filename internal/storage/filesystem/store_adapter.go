@@ -2,26 +2,108 @@ package filesystem
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/terrariumcloud/terrarium-lite/internal/logging"
 )
 
 type TerrariumFilesystemStorage struct {
-	path string
+	path   string
+	logger logrus.FieldLogger
 }
 
 func (s *TerrariumFilesystemStorage) FetchModuleSource(ctx context.Context, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	fullPath := path.Clean(path.Join(s.path, key))
+	logging.FromContext(ctx, s.logger).WithField("path", fullPath).Debug("reading module source")
 	return os.ReadFile(fullPath)
 }
 
+// StoreModuleSource writes an archive to a temporary file before renaming it into place so that concurrent downloads
+// never read a partially written archive
+func (s *TerrariumFilesystemStorage) StoreModuleSource(ctx context.Context, key string, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	fullPath := path.Clean(path.Join(s.path, key))
+	if !strings.HasPrefix(fullPath, s.path+"/") {
+		return fmt.Errorf("key %s is outside the storage root", key)
+	}
+	logging.FromContext(ctx, s.logger).WithField("path", fullPath).Debug("storing module source")
+	if err := os.MkdirAll(path.Dir(fullPath), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(path.Dir(fullPath), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fullPath)
+}
+
+// DeleteModuleSource removes an archive and any directories left empty by its removal, up to the storage root
+func (s *TerrariumFilesystemStorage) DeleteModuleSource(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	fullPath := path.Clean(path.Join(s.path, key))
+	if !strings.HasPrefix(fullPath, s.path+"/") {
+		return fmt.Errorf("key %s is outside the storage root", key)
+	}
+	logging.FromContext(ctx, s.logger).WithField("path", fullPath).Debug("deleting module source")
+	if err := os.Remove(fullPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for dir := path.Dir(fullPath); dir != s.path; dir = path.Dir(dir) {
+		// Remove fails on directories that still have entries which ends the walk
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
 func (s *TerrariumFilesystemStorage) GetBackingStoreName() string {
 	return "filesystem"
 }
 
-func New(storageRootPath string) (*TerrariumFilesystemStorage, error) {
+// HealthCheck reports whether the storage root is still accessible
+func (s *TerrariumFilesystemStorage) HealthCheck(_ context.Context) error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("storage root %s is not a directory", s.path)
+	}
+	return nil
+}
+
+func (s *TerrariumFilesystemStorage) Close() error {
+	return nil
+}
+
+func New(storageRootPath string, logger logrus.FieldLogger) (*TerrariumFilesystemStorage, error) {
 	s := &TerrariumFilesystemStorage{
-		path: path.Clean(storageRootPath),
+		path:   path.Clean(storageRootPath),
+		logger: logger,
 	}
 	return s, nil
 }
@@ -0,0 +1,137 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/modules"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/drivers"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/stores"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// TraceModuleStore wraps a module store so that every call is recorded as a span
+func (t *Tracing) TraceModuleStore(store stores.ModuleStore) stores.ModuleStore {
+	return &tracedModuleStore{ModuleStore: store, tracing: t}
+}
+
+type tracedModuleStore struct {
+	stores.ModuleStore
+	tracing *Tracing
+}
+
+func moduleAttributes(orgName string, moduleName string, providerName string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("terrarium.organization", orgName),
+		attribute.String("terrarium.module", moduleName),
+		attribute.String("terrarium.provider", providerName),
+	}
+}
+
+func (s *tracedModuleStore) ReadModuleVersions(ctx context.Context, orgName string, moduleName string, providerName string) ([]*modules.Module, error) {
+	ctx, span := s.tracing.start(ctx, "ModuleStore.ReadModuleVersions", moduleAttributes(orgName, moduleName, providerName)...)
+	result, err := s.ModuleStore.ReadModuleVersions(ctx, orgName, moduleName, providerName)
+	end(span, err)
+	return result, err
+}
+
+func (s *tracedModuleStore) ReadModuleVersionSource(ctx context.Context, orgName string, moduleName string, providerName string, version string) (string, error) {
+	attributes := append(moduleAttributes(orgName, moduleName, providerName), attribute.String("terrarium.version", version))
+	ctx, span := s.tracing.start(ctx, "ModuleStore.ReadModuleVersionSource", attributes...)
+	result, err := s.ModuleStore.ReadModuleVersionSource(ctx, orgName, moduleName, providerName, version)
+	end(span, err)
+	return result, err
+}
+
+func (s *tracedModuleStore) UpdateVersionLifecycle(ctx context.Context, orgName string, moduleName string, providerName string, version string, lifecycle *modules.VersionLifecycle) error {
+	attributes := append(moduleAttributes(orgName, moduleName, providerName),
+		attribute.String("terrarium.version", version),
+		attribute.String("terrarium.lifecycle.state", string(lifecycle.State)),
+	)
+	ctx, span := s.tracing.start(ctx, "ModuleStore.UpdateVersionLifecycle", attributes...)
+	err := s.ModuleStore.UpdateVersionLifecycle(ctx, orgName, moduleName, providerName, version, lifecycle)
+	end(span, err)
+	return err
+}
+
+func (s *tracedModuleStore) ReadModuleVersion(ctx context.Context, orgName string, moduleName string, providerName string, version string) (*modules.Module, error) {
+	attributes := append(moduleAttributes(orgName, moduleName, providerName), attribute.String("terrarium.version", version))
+	ctx, span := s.tracing.start(ctx, "ModuleStore.ReadModuleVersion", attributes...)
+	result, err := s.ModuleStore.ReadModuleVersion(ctx, orgName, moduleName, providerName, version)
+	end(span, err)
+	return result, err
+}
+
+func (s *tracedModuleStore) PublishModuleVersion(ctx context.Context, module *modules.Module) error {
+	attributes := append(moduleAttributes(module.Organization, module.Name, module.Provider), attribute.String("terrarium.version", module.Version))
+	ctx, span := s.tracing.start(ctx, "ModuleStore.PublishModuleVersion", attributes...)
+	err := s.ModuleStore.PublishModuleVersion(ctx, module)
+	end(span, err)
+	return err
+}
+
+func (s *tracedModuleStore) ReadOrganizationModules(ctx context.Context, orgName string) ([]*modules.Module, error) {
+	ctx, span := s.tracing.start(ctx, "ModuleStore.ReadOrganizationModules", attribute.String("terrarium.organization", orgName))
+	result, err := s.ModuleStore.ReadOrganizationModules(ctx, orgName)
+	end(span, err)
+	return result, err
+}
+
+func (s *tracedModuleStore) DeleteModuleVersion(ctx context.Context, deletion *modules.Deletion) error {
+	attributes := append(moduleAttributes(deletion.Organization, deletion.Name, deletion.Provider), attribute.String("terrarium.version", deletion.Version))
+	ctx, span := s.tracing.start(ctx, "ModuleStore.DeleteModuleVersion", attributes...)
+	err := s.ModuleStore.DeleteModuleVersion(ctx, deletion)
+	end(span, err)
+	return err
+}
+
+// TraceStorage wraps a storage driver so that every fetch is recorded as a span
+func (t *Tracing) TraceStorage(driver drivers.TerrariumStorageDriver) drivers.TerrariumStorageDriver {
+	return &tracedStorage{TerrariumStorageDriver: driver, tracing: t}
+}
+
+type tracedStorage struct {
+	drivers.TerrariumStorageDriver
+	tracing *Tracing
+}
+
+func (s *tracedStorage) FetchModuleSource(ctx context.Context, key string) ([]byte, error) {
+	ctx, span := s.tracing.start(ctx, "TerrariumStorageDriver.FetchModuleSource",
+		attribute.String("terrarium.storage.backend", s.GetBackingStoreName()),
+		attribute.String("terrarium.storage.key", key),
+	)
+	data, err := s.TerrariumStorageDriver.FetchModuleSource(ctx, key)
+	if err == nil {
+		span.SetAttributes(attribute.Int("terrarium.storage.bytes", len(data)))
+	}
+	end(span, err)
+	return data, err
+}
+
+func (s *tracedStorage) StoreModuleSource(ctx context.Context, key string, data []byte) error {
+	ctx, span := s.tracing.start(ctx, "TerrariumStorageDriver.StoreModuleSource",
+		attribute.String("terrarium.storage.backend", s.GetBackingStoreName()),
+		attribute.String("terrarium.storage.key", key),
+		attribute.Int("terrarium.storage.bytes", len(data)),
+	)
+	err := s.TerrariumStorageDriver.StoreModuleSource(ctx, key, data)
+	end(span, err)
+	return err
+}
+
+func (s *tracedStorage) DeleteModuleSource(ctx context.Context, key string) error {
+	ctx, span := s.tracing.start(ctx, "TerrariumStorageDriver.DeleteModuleSource",
+		attribute.String("terrarium.storage.backend", s.GetBackingStoreName()),
+		attribute.String("terrarium.storage.key", key),
+	)
+	err := s.TerrariumStorageDriver.DeleteModuleSource(ctx, key)
+	end(span, err)
+	return err
+}
+
+// HealthCheck is passed through without a span so that readiness probes do not fill traces
+func (s *tracedStorage) HealthCheck(ctx context.Context) error {
+	if checker, ok := s.TerrariumStorageDriver.(drivers.HealthChecker); ok {
+		return checker.HealthCheck(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+// Package tracing integrates OpenTelemetry tracing into Terrarium. Spans are started for every routed request,
+// continuing any trace propagated by the client through a W3C traceparent header, and for the module store and
+// storage driver calls made while serving it. Spans are exported over OTLP/HTTP, typically to a local collector.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName string = "github.com/terrariumcloud/terrarium-lite"
+
+// Config holds the settings of the OTLP exporter
+type Config struct {
+	// Endpoint is the host and port of the OTLP/HTTP collector e.g. localhost:4318
+	Endpoint string
+	// Insecure sends spans over plain HTTP, which is usual for a collector running alongside Terrarium
+	Insecure bool
+	// ServiceName is reported as the service.name resource attribute
+	ServiceName string
+	// SampleRatio is the fraction of new traces sampled. Traces propagated from clients keep their sampling decision.
+	SampleRatio float64
+}
+
+// Tracing holds the tracer provider used by Terrarium
+type Tracing struct {
+	provider   *sdktrace.TracerProvider
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// New creates a tracer provider exporting spans to the configured collector
+func New(ctx context.Context, cfg *Config) (*Tracing, error) {
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+	if cfg.Insecure {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating OTLP exporter - %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(cfg.ServiceName))),
+	)
+	return &Tracing{
+		provider:   provider,
+		tracer:     provider.Tracer(instrumentationName),
+		propagator: propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}),
+	}, nil
+}
+
+// Close flushes any buffered spans and stops the exporter
+func (t *Tracing) Close() error {
+	return t.provider.Shutdown(context.Background())
+}
+
+// Middleware starts a server span for every routed request named after the template of the matched route so that
+// span names do not vary with organization or module names
+func (t *Tracing) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		ctx := t.propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := t.tracer.Start(ctx, fmt.Sprintf("%s %s", r.Method, route),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest("terrarium", route, r)...),
+		)
+		defer span.End()
+		snoop := httpsnoop.CaptureMetrics(next, rw, r.WithContext(ctx))
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(snoop.Code)...)
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCodeAndSpanKind(snoop.Code, trace.SpanKindServer))
+	})
+}
+
+// start begins an internal span, typically around a call to a driver
+func (t *Tracing) start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return t.tracer.Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// end records the outcome of a call on its span and ends it
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
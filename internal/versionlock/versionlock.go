@@ -0,0 +1,59 @@
+// Package versionlock serialises changes to the same module version made through different APIs, such as a publish
+// replacing a version and an admin deleting it.
+package versionlock
+
+import (
+	"context"
+	"sync"
+)
+
+// Locks serialises work on the same key, typically the source path of a module version, while leaving other keys to
+// proceed in parallel. Locks are dropped once nobody holds or waits for them so that the map does not grow with every
+// version ever published. The zero value is ready to use.
+type Locks struct {
+	mu    sync.Mutex
+	locks map[string]*versionLock
+}
+
+type versionLock struct {
+	// held has room for one holder
+	held chan struct{}
+	// users counts the holder and the waiters of the lock
+	users int
+}
+
+// Lock waits until the key is free and returns the function releasing it. Callers whose context ends while waiting
+// get its error instead.
+func (v *Locks) Lock(ctx context.Context, key string) (func(), error) {
+	v.mu.Lock()
+	if v.locks == nil {
+		v.locks = map[string]*versionLock{}
+	}
+	l, ok := v.locks[key]
+	if !ok {
+		l = &versionLock{held: make(chan struct{}, 1)}
+		v.locks[key] = l
+	}
+	l.users++
+	v.mu.Unlock()
+
+	select {
+	case l.held <- struct{}{}:
+		return func() {
+			<-l.held
+			v.release(key, l)
+		}, nil
+	case <-ctx.Done():
+		v.release(key, l)
+		return nil, ctx.Err()
+	}
+}
+
+func (v *Locks) release(key string, l *versionLock) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	l.users--
+	if l.users == 0 {
+		delete(v.locks, key)
+	}
+}
@@ -0,0 +1,128 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/events"
+	"gopkg.in/yaml.v2"
+)
+
+// Endpoint is a URL registry events are delivered to. Payloads are signed with an HMAC-SHA256 of the delivery timestamp
+// and the request body, see Sign, keyed with the secret of the endpoint, read from SecretFile or the SecretEnv environment variable so that it does
+// not have to appear in the endpoints file.
+//
+// An example endpoints file notifying a docs pipeline of every published acme module:
+//
+//	endpoints:
+//	  - name: docs
+//	    url: https://ci.example.com/hooks/terrarium
+//	    secret_env: DOCS_WEBHOOK_SECRET
+//	    events: [version.published, version.deleted]
+//	    organizations: [acme]
+type Endpoint struct {
+	Name       string `yaml:"name"`
+	URL        string `yaml:"url"`
+	SecretFile string `yaml:"secret_file"`
+	SecretEnv  string `yaml:"secret_env"`
+	// Events lists the event types sent to the endpoint, every type when empty
+	Events []events.Type `yaml:"events"`
+	// Organizations lists path.Match patterns of the organizations whose events are sent, every organization when empty
+	Organizations []string `yaml:"organizations"`
+	secret        []byte
+}
+
+// Wants reports whether an event should be delivered to the endpoint
+func (e *Endpoint) Wants(event *events.Event) bool {
+	if len(e.Events) > 0 {
+		wanted := false
+		for _, t := range e.Events {
+			wanted = wanted || t == event.Type
+		}
+		if !wanted {
+			return false
+		}
+	}
+	if len(e.Organizations) == 0 {
+		return true
+	}
+	for _, pattern := range e.Organizations {
+		if matched, _ := path.Match(pattern, event.Organization); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// endpointsFile is the layout of a webhook endpoints file
+type endpointsFile struct {
+	Endpoints []*Endpoint `yaml:"endpoints"`
+}
+
+// LoadEndpoints reads and validates a YAML webhook endpoints file, resolving the secret of every endpoint
+func LoadEndpoints(endpointsPath string) ([]*Endpoint, error) {
+	data, err := os.ReadFile(endpointsPath)
+	if err != nil {
+		return nil, err
+	}
+	file := &endpointsFile{}
+	if err := yaml.UnmarshalStrict(data, file); err != nil {
+		return nil, fmt.Errorf("failed parsing webhook endpoints %s - %w", endpointsPath, err)
+	}
+	names := map[string]bool{}
+	for i, endpoint := range file.Endpoints {
+		if err := endpoint.load(); err != nil {
+			return nil, fmt.Errorf("invalid webhook endpoint %d in %s - %w", i, endpointsPath, err)
+		}
+		if names[endpoint.Name] {
+			return nil, fmt.Errorf("invalid webhook endpoints %s - duplicate endpoint name %q", endpointsPath, endpoint.Name)
+		}
+		names[endpoint.Name] = true
+	}
+	return file.Endpoints, nil
+}
+
+// load validates the endpoint and reads its secret
+func (e *Endpoint) load() error {
+	if e.Name == "" {
+		return errors.New("name must be set")
+	}
+	target, err := url.Parse(e.URL)
+	if err != nil || (target.Scheme != "https" && target.Scheme != "http") || target.Host == "" {
+		return fmt.Errorf("%s: url must be an absolute http or https URL", e.Name)
+	}
+	for _, t := range e.Events {
+		known := false
+		for _, candidate := range events.Types {
+			known = known || candidate == t
+		}
+		if !known {
+			return fmt.Errorf("%s: unknown event type %q", e.Name, t)
+		}
+	}
+	for _, pattern := range e.Organizations {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%s: organization pattern %q - %w", e.Name, pattern, err)
+		}
+	}
+	switch {
+	case e.SecretFile != "" && e.SecretEnv != "":
+		return fmt.Errorf("%s: only one of secret_file or secret_env may be set", e.Name)
+	case e.SecretFile != "":
+		secret, err := os.ReadFile(e.SecretFile)
+		if err != nil {
+			return fmt.Errorf("%s: failed reading secret - %w", e.Name, err)
+		}
+		e.secret = []byte(strings.TrimSpace(string(secret)))
+	case e.SecretEnv != "":
+		e.secret = []byte(os.Getenv(e.SecretEnv))
+	}
+	if len(e.secret) == 0 {
+		return fmt.Errorf("%s: a non empty secret must be set through secret_file or secret_env", e.Name)
+	}
+	return nil
+}
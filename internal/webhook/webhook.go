@@ -0,0 +1,370 @@
+// Package webhook delivers registry events to configured webhook endpoints. Every event is queued as a delivery per
+// interested endpoint in the WebhookStore of the database driver before it is sent, so deliveries pending when the
+// registry stops are sent once it is back. Deliveries are at least once: receivers should deduplicate on the event ID.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/events"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/webhooks"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/responses"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/stores"
+)
+
+const (
+	// SignatureHeader carries "sha256=" followed by the hex encoded HMAC-SHA256 of the timestamp and the request body
+	SignatureHeader string = "X-Terrarium-Signature"
+	// TimestampHeader carries the time a delivery attempt was signed, in seconds since the Unix epoch
+	TimestampHeader string = "X-Terrarium-Timestamp"
+	// EventHeader carries the type of the event delivered
+	EventHeader string = "X-Terrarium-Event"
+	// DeliveryHeader carries the ID of the delivery, which differs between redeliveries of the same event
+	DeliveryHeader string = "X-Terrarium-Delivery"
+)
+
+// SignatureTolerance is the largest difference between the timestamp of a delivery and the clock of the receiver
+// that Verify accepts. Receivers rejecting older deliveries cannot be sent a captured delivery again once it has
+// passed, as changing the timestamp invalidates the signature.
+const SignatureTolerance = 5 * time.Minute
+
+// ErrNotPending is returned when redelivering a delivery that is still pending
+var ErrNotPending = responses.NewStatusError(http.StatusConflict, "delivery is still pending")
+
+// Config controls how deliveries are retried
+type Config struct {
+	// MaxAttempts is the number of times a delivery is sent before it is given up on
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry. It doubles for every further retry up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Timeout bounds a single delivery attempt
+	Timeout time.Duration
+}
+
+// Dispatcher queues events for the endpoints interested in them and delivers them in the background. Deliveries are
+// sent one at a time in the order they become due.
+type Dispatcher struct {
+	endpoints map[string]*Endpoint
+	ordered   []*Endpoint
+	store     stores.WebhookStore
+	config    Config
+	client    *http.Client
+	logger    logrus.FieldLogger
+	wake      chan struct{}
+	cancel    context.CancelFunc
+	done      chan struct{}
+	startOnce sync.Once
+}
+
+// New creates a Dispatcher. Deliveries are only sent once Start has been called.
+func New(endpoints []*Endpoint, store stores.WebhookStore, config Config, logger logrus.FieldLogger) *Dispatcher {
+	d := &Dispatcher{
+		endpoints: map[string]*Endpoint{},
+		ordered:   endpoints,
+		store:     store,
+		config:    config,
+		client:    &http.Client{Timeout: config.Timeout},
+		logger:    logger,
+		wake:      make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+	for _, endpoint := range endpoints {
+		d.endpoints[endpoint.Name] = endpoint
+	}
+	return d
+}
+
+// Start sends pending deliveries, including those left pending by a previous run, in the background until Close
+func (d *Dispatcher) Start() {
+	d.startOnce.Do(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		d.cancel = cancel
+		go d.run(ctx)
+	})
+}
+
+// Close stops delivering, waiting for an attempt in progress to finish. Pending deliveries remain queued.
+func (d *Dispatcher) Close() error {
+	if d.cancel == nil {
+		return nil
+	}
+	d.cancel()
+	<-d.done
+	return nil
+}
+
+// Emit queues an event for every endpoint interested in it. A nil Dispatcher emits nothing. Failures to queue are
+// logged rather than returned as the change the event describes has already been made.
+func (d *Dispatcher) Emit(event *events.Event) {
+	if d == nil {
+		return
+	}
+	if event.ID == "" {
+		event.ID = newID()
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+	queued := false
+	for _, endpoint := range d.ordered {
+		if !endpoint.Wants(event) {
+			continue
+		}
+		now := time.Now().UTC()
+		delivery := &webhooks.Delivery{
+			ID:            newID(),
+			Endpoint:      endpoint.Name,
+			Event:         event,
+			Status:        webhooks.DeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		if err := d.store.SaveDelivery(context.Background(), delivery); err != nil {
+			d.logger.WithError(err).WithFields(logrus.Fields{"endpoint": endpoint.Name, "event": event.ID, "type": event.Type}).Error("failed queueing webhook delivery")
+			continue
+		}
+		queued = true
+	}
+	if queued {
+		d.notify()
+	}
+}
+
+// Deliveries returns the queued and recent deliveries with a status, or every one when status is empty
+func (d *Dispatcher) Deliveries(ctx context.Context, status webhooks.DeliveryStatus) ([]*webhooks.Delivery, error) {
+	return d.store.ReadDeliveries(ctx, status)
+}
+
+// Delivery returns a single delivery, or stores.ErrDeliveryNotFound when it does not exist
+func (d *Dispatcher) Delivery(ctx context.Context, id string) (*webhooks.Delivery, error) {
+	return d.store.ReadDelivery(ctx, id)
+}
+
+// Redeliver queues the event of a delivered or failed delivery again as a new delivery to the same endpoint
+func (d *Dispatcher) Redeliver(ctx context.Context, id string) (*webhooks.Delivery, error) {
+	original, err := d.store.ReadDelivery(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if original.Status == webhooks.DeliveryPending {
+		return nil, ErrNotPending
+	}
+	if _, ok := d.endpoints[original.Endpoint]; !ok {
+		return nil, fmt.Errorf("endpoint %q is no longer configured", original.Endpoint)
+	}
+	now := time.Now().UTC()
+	delivery := &webhooks.Delivery{
+		ID:            newID(),
+		Endpoint:      original.Endpoint,
+		Event:         original.Event,
+		Status:        webhooks.DeliveryPending,
+		NextAttemptAt: now,
+		RedeliveryOf:  original.ID,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := d.store.SaveDelivery(ctx, delivery); err != nil {
+		return nil, err
+	}
+	d.notify()
+	return delivery, nil
+}
+
+// notify wakes the delivery loop without blocking when it is already due to run
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *Dispatcher) run(ctx context.Context) {
+	defer close(d.done)
+	for {
+		next := d.deliverDue(ctx)
+		wait := time.Minute
+		if !next.IsZero() {
+			wait = time.Until(next)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-d.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// deliverDue sends every pending delivery that is due and returns when the next one is, or a zero time when none is
+// pending
+func (d *Dispatcher) deliverDue(ctx context.Context) time.Time {
+	pending, err := d.store.ReadDeliveries(ctx, webhooks.DeliveryPending)
+	if err != nil {
+		if ctx.Err() == nil {
+			d.logger.WithError(err).Error("failed reading pending webhook deliveries")
+		}
+		return time.Now().Add(d.config.InitialBackoff)
+	}
+	var next time.Time
+	// Pending deliveries are read most recent first, send the oldest first
+	for i := len(pending) - 1; i >= 0; i-- {
+		if ctx.Err() != nil {
+			return next
+		}
+		delivery := pending[i]
+		if delivery.NextAttemptAt.After(time.Now()) {
+			if next.IsZero() || delivery.NextAttemptAt.Before(next) {
+				next = delivery.NextAttemptAt
+			}
+			continue
+		}
+		d.attempt(ctx, delivery)
+		if delivery.Status == webhooks.DeliveryPending && (next.IsZero() || delivery.NextAttemptAt.Before(next)) {
+			next = delivery.NextAttemptAt
+		}
+	}
+	return next
+}
+
+// attempt sends a delivery once and records the outcome, scheduling a retry with exponential backoff when the
+// endpoint could not be reached, timed out, was rate limited or failed with a server error
+func (d *Dispatcher) attempt(ctx context.Context, delivery *webhooks.Delivery) {
+	logger := d.logger.WithFields(logrus.Fields{"endpoint": delivery.Endpoint, "delivery": delivery.ID, "type": delivery.Event.Type})
+	endpoint, ok := d.endpoints[delivery.Endpoint]
+	retry := false
+	if !ok {
+		delivery.LastStatusCode, delivery.LastError = 0, "endpoint is no longer configured"
+	} else {
+		status, err := d.send(ctx, endpoint, delivery)
+		if ctx.Err() != nil {
+			// Shutting down, leave the delivery to be sent on the next start
+			return
+		}
+		delivery.Attempts++
+		delivery.LastStatusCode, delivery.LastError = status, ""
+		switch {
+		case err != nil:
+			delivery.LastError = err.Error()
+			retry = true
+		case status >= 200 && status < 300:
+		case status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status >= 500:
+			delivery.LastError = fmt.Sprintf("endpoint responded %d", status)
+			retry = true
+		default:
+			delivery.LastError = fmt.Sprintf("endpoint refused the delivery with %d", status)
+		}
+	}
+	now := time.Now().UTC()
+	delivery.UpdatedAt = now
+	switch {
+	case delivery.LastError == "":
+		delivery.Status = webhooks.DeliveryDelivered
+		delivery.NextAttemptAt = time.Time{}
+		logger.Info("delivered webhook")
+	case retry && delivery.Attempts < d.config.MaxAttempts:
+		delivery.NextAttemptAt = now.Add(d.backoff(delivery.Attempts))
+		logger.WithField("attempts", delivery.Attempts).WithField("error", delivery.LastError).Warn("webhook delivery failed, retrying")
+	default:
+		delivery.Status = webhooks.DeliveryFailed
+		delivery.NextAttemptAt = time.Time{}
+		logger.WithField("attempts", delivery.Attempts).WithField("error", delivery.LastError).Error("webhook delivery failed, giving up")
+	}
+	if err := d.store.SaveDelivery(context.Background(), delivery); err != nil {
+		logger.WithError(err).Error("failed recording webhook delivery")
+	}
+}
+
+// backoff returns the wait before the retry following an attempt
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.config.InitialBackoff
+	for i := 1; i < attempts && wait < d.config.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > d.config.MaxBackoff {
+		wait = d.config.MaxBackoff
+	}
+	return wait
+}
+
+// send posts the event of a delivery to an endpoint and returns the status code of the response
+func (d *Dispatcher) send(ctx context.Context, endpoint *Endpoint, delivery *webhooks.Delivery) (int, error) {
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Terrarium-Webhook")
+	req.Header.Set(EventHeader, string(delivery.Event.Type))
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(endpoint.secret, timestamp, body))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, nil
+}
+
+// Sign returns the signature header value of a payload sent with a timestamp header. The HMAC is computed over the
+// timestamp, a dot and the payload, which receivers recompute with the shared secret and compare in constant time
+// before checking the timestamp is within SignatureTolerance of their clock.
+func Sign(secret []byte, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature and timestamp headers of a delivery received at now, for receivers written in Go
+func Verify(secret []byte, signature string, timestamp string, payload []byte, now time.Time) error {
+	if !hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, payload))) {
+		return errors.New("signature does not match the payload")
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %q", timestamp)
+	}
+	skew := now.Sub(time.Unix(seconds, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > SignatureTolerance {
+		return fmt.Errorf("timestamp is %s away from the current time, more than the tolerance of %s", skew.Round(time.Second), SignatureTolerance)
+	}
+	return nil
+}
+
+func newID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,63 @@
+package webhook
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	secret := []byte("shared secret")
+	payload := []byte(`{"id":"1","type":"module.published"}`)
+	now := time.Unix(1700000000, 0)
+	at := func(offset time.Duration) string {
+		return strconv.FormatInt(now.Add(offset).Unix(), 10)
+	}
+
+	tests := []struct {
+		name      string
+		signature string
+		timestamp string
+		payload   []byte
+		wantErr   string
+	}{
+		{"current", Sign(secret, at(0), payload), at(0), payload, ""},
+		{"within tolerance", Sign(secret, at(-4*time.Minute), payload), at(-4 * time.Minute), payload, ""},
+		{"receiver clock behind", Sign(secret, at(4*time.Minute), payload), at(4 * time.Minute), payload, ""},
+
+		{"replayed after the tolerance", Sign(secret, at(-6*time.Minute), payload), at(-6 * time.Minute), payload, "more than the tolerance"},
+		{"from the future", Sign(secret, at(10*time.Minute), payload), at(10 * time.Minute), payload, "more than the tolerance"},
+		{"timestamp changed", Sign(secret, at(-time.Hour), payload), at(0), payload, "signature does not match"},
+		{"payload changed", Sign(secret, at(0), payload), at(0), []byte(`{"id":"2"}`), "signature does not match"},
+		{"other secret", Sign([]byte("other"), at(0), payload), at(0), payload, "signature does not match"},
+		{"body only signature", Sign(secret, "", payload), at(0), payload, "signature does not match"},
+		{"invalid timestamp", Sign(secret, "yesterday", payload), "yesterday", payload, `invalid timestamp "yesterday"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(secret, tt.signature, tt.timestamp, tt.payload, now)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Verify() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Verify() accepted the delivery, want error containing %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Verify() error = %q, want it to contain %q", err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSign(t *testing.T) {
+	// Receivers in other languages compute the HMAC-SHA256 of "<timestamp>.<body>"
+	got := Sign([]byte("secret"), "1700000000", []byte(`{}`))
+	want := "sha256=b8569b78799ff9e3cbff0fc2d63a33a2b57f3282abd07c37ae5e8e7d79a5f163"
+	if got != want {
+		t.Fatalf("Sign() = %s, want %s", got, want)
+	}
+}
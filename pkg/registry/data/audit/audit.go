@@ -0,0 +1,102 @@
+package audit
+
+import (
+	"time"
+
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/modules"
+)
+
+// Action names a kind of audited operation
+type Action string
+
+const (
+	// ActionPublish is the publishing of a new module version, or of a signature for an existing one
+	ActionPublish Action = "module.publish"
+	// ActionOverride is an admin replacing the content of a published version, bypassing its immutability
+	ActionOverride Action = "module.override"
+	// ActionLifecycle is a version being deprecated, yanked or restored
+	ActionLifecycle Action = "module.lifecycle"
+	// ActionApprove is a version pending approval being approved
+	ActionApprove Action = "module.approve"
+	// ActionReject is a version pending approval being rejected
+	ActionReject Action = "module.reject"
+	// ActionDelete is a version being removed from the registry
+	ActionDelete Action = "module.delete"
+	// ActionAuthFailure is a request presenting credentials that failed validation
+	ActionAuthFailure Action = "auth.failure"
+	// ActionRoles is the role bindings of an organization changing. Role bindings are read from a file when the
+	// registry starts, so changes are recorded by the first start after them.
+	ActionRoles Action = "auth.roles"
+)
+
+// Actions lists every audited action
+var Actions = []Action{ActionPublish, ActionOverride, ActionLifecycle, ActionApprove, ActionReject, ActionDelete, ActionAuthFailure, ActionRoles}
+
+// Event records a single change made to the registry, who made it and from where
+type Event struct {
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Action    Action    `json:"action"`
+	Actor     string    `json:"actor"`
+	SourceIP  string    `json:"source_ip"`
+	RequestID string    `json:"request_id,omitempty"`
+	// Reason is why the credentials of an authentication failure were refused
+	Reason string `json:"reason,omitempty"`
+	modules.ModuleVersionRef
+	// Before is the state of the version prior to the change, nil when it did not exist
+	Before *Snapshot `json:"before,omitempty"`
+	// After is the state of the version following the change, nil when it was removed
+	After *Snapshot `json:"after,omitempty"`
+}
+
+// Snapshot is the audited state of a module version, or of the role bindings of an organization
+type Snapshot struct {
+	Checksum     string                    `json:"checksum,omitempty"`
+	SignatureKey string                    `json:"signature_key_id,omitempty"`
+	Lifecycle    *modules.VersionLifecycle `json:"lifecycle,omitempty"`
+	// Grants lists the roles bound on an organization as "role kind:pattern", such as "admin team:platform"
+	Grants []string `json:"grants,omitempty"`
+}
+
+// SnapshotOf returns the audited state of a version, or nil for a version that does not exist
+func SnapshotOf(module *modules.Module) *Snapshot {
+	if module == nil {
+		return nil
+	}
+	snapshot := &Snapshot{Checksum: module.Checksum, Lifecycle: module.Lifecycle}
+	if module.Signature != nil {
+		snapshot.SignatureKey = module.Signature.KeyID
+	}
+	return snapshot
+}
+
+// Filter selects audit events. Empty fields match every event.
+type Filter struct {
+	Organization string
+	Name         string
+	Actor        string
+	Action       Action
+	Since        time.Time
+	Until        time.Time
+	// Limit is the largest number of events returned, keeping the most recent. Zero returns every matching event.
+	Limit int
+}
+
+// Matches reports whether an event is selected by the filter. Since is inclusive and Until exclusive.
+func (f *Filter) Matches(event *Event) bool {
+	switch {
+	case f.Organization != "" && event.Organization != f.Organization:
+		return false
+	case f.Name != "" && event.Name != f.Name:
+		return false
+	case f.Actor != "" && event.Actor != f.Actor:
+		return false
+	case f.Action != "" && event.Action != f.Action:
+		return false
+	case !f.Since.IsZero() && event.Timestamp.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !event.Timestamp.Before(f.Until):
+		return false
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+package events
+
+import (
+	"time"
+
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/modules"
+)
+
+// Type names a kind of registry event
+type Type string
+
+const (
+	// VersionPublished is emitted when a version becomes available, either on publishing or, for versions requiring
+	// approval, once approved. Replacing the content of a version emits it again.
+	VersionPublished Type = "version.published"
+	// VersionDeprecated is emitted when a version is deprecated
+	VersionDeprecated Type = "version.deprecated"
+	// VersionYanked is emitted when a version is yanked
+	VersionYanked Type = "version.yanked"
+	// VersionRestored is emitted when a deprecated or yanked version is made active again
+	VersionRestored Type = "version.restored"
+	// VersionDeleted is emitted when a version is removed from the registry
+	VersionDeleted Type = "version.deleted"
+	// VersionFirstDownload is emitted when a version is downloaded for the first time
+	VersionFirstDownload Type = "version.first_download"
+)
+
+// Types lists every event type
+var Types = []Type{VersionPublished, VersionDeprecated, VersionYanked, VersionRestored, VersionDeleted, VersionFirstDownload}
+
+// Event describes a change to a module version
+type Event struct {
+	ID        string    `json:"id"`
+	Type      Type      `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	modules.ModuleVersionRef
+	// Actor is the identity that made the change. It is not set for downloads.
+	Actor     string                    `json:"actor,omitempty"`
+	Checksum  string                    `json:"checksum,omitempty"`
+	Lifecycle *modules.VersionLifecycle `json:"lifecycle,omitempty"`
+}
+
+// LifecycleEventType returns the event emitted when a version enters a lifecycle state, or an empty type for states
+// that emit none
+func LifecycleEventType(state modules.VersionState) Type {
+	switch state {
+	case modules.VersionDeprecated:
+		return VersionDeprecated
+	case modules.VersionYanked:
+		return VersionYanked
+	case modules.VersionActive:
+		return VersionRestored
+	}
+	return ""
+}
+
+// ForVersion returns an event about a module version made by actor
+func ForVersion(t Type, module *modules.Module, actor string) *Event {
+	return &Event{
+		Type: t,
+		ModuleVersionRef: modules.ModuleVersionRef{
+			Organization: module.Organization,
+			Name:         module.Name,
+			Provider:     module.Provider,
+			Version:      module.Version,
+		},
+		Actor:     actor,
+		Checksum:  module.Checksum,
+		Lifecycle: module.Lifecycle,
+	}
+}
+
+// Logged is an event kept in the event log under its sequence number. Sequence numbers increase by one with every
+// event logged and identify events to clients resuming an event stream.
+type Logged struct {
+	Sequence uint64 `json:"sequence"`
+	Event    *Event `json:"event"`
+}
+
+// Emitter is notified of registry events once the change they describe has been made
+type Emitter interface {
+	Emit(event *Event)
+}
+
+// Emitters notifies every emitter in turn
+type Emitters []Emitter
+
+// Emit passes the event to every emitter
+func (e Emitters) Emit(event *Event) {
+	for _, emitter := range e {
+		emitter.Emit(event)
+	}
+}
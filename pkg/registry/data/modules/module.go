@@ -1,15 +1,65 @@
 package modules
 
+import "time"
+
 type Module struct {
 	Name         string
 	Organization string
 	Provider     string
 	Version      string
 	Source       string
+	// Checksum is the hex encoded SHA-256 of the archive recorded when the version was first indexed or published
+	Checksum string
+	// Signature is nil for versions published without a signature
+	Signature *ModuleSignature
+	// Lifecycle is nil for versions that were never deprecated or yanked
+	Lifecycle *VersionLifecycle
+	// Validation is the outcome of checking the archive when it was indexed or published
+	Validation *ArchiveValidation
+}
+
+// Copy returns a copy of the module including the signature, lifecycle and validation it points to, so that the copy
+// can be changed without affecting the module
+func (m *Module) Copy() *Module {
+	c := *m
+	if m.Signature != nil {
+		signature := *m.Signature
+		c.Signature = &signature
+	}
+	if m.Lifecycle != nil {
+		lifecycle := *m.Lifecycle
+		c.Lifecycle = &lifecycle
+	}
+	if m.Validation != nil {
+		validation := *m.Validation
+		c.Validation = &validation
+	}
+	return &c
+}
+
+// ArchiveValidation records whether a version archive is safe to serve, and why not when it is not
+type ArchiveValidation struct {
+	Valid bool `json:"valid"`
+	// Reason explains why an invalid archive was rejected
+	Reason           string    `json:"reason,omitempty"`
+	Format           string    `json:"format,omitempty"`
+	Files            int       `json:"files"`
+	UncompressedSize int64     `json:"uncompressed_size"`
+	ValidatedAt      time.Time `json:"validated_at"`
+}
+
+// IndexProblem is an archive found in storage which is not served, because it failed validation or no longer matches
+// the checksum recorded for it
+type IndexProblem struct {
+	Source string `json:"source"`
+	Reason string `json:"reason"`
+	// Tampered archives changed after their checksum was recorded
+	Tampered bool `json:"tampered,omitempty"`
 }
 
 type ModuleVersionItem struct {
-	Version string `json:"version"`
+	Version     string             `json:"version"`
+	Deprecation *ModuleDeprecation `json:"deprecation,omitempty"`
 }
 
 type ModuleVersions struct {
@@ -19,3 +69,74 @@ type ModuleVersions struct {
 type ModuleVersionResponse struct {
 	Modules []*ModuleVersions `json:"modules"`
 }
+
+// VersionState is the lifecycle state of a module version
+type VersionState string
+
+const (
+	// VersionActive is the state of a version that has not been deprecated or yanked
+	VersionActive VersionState = "active"
+	// VersionDeprecated versions are still listed and downloadable but clients are warned against using them
+	VersionDeprecated VersionState = "deprecated"
+	// VersionYanked versions are no longer listed so they are not selected by version constraints. They remain
+	// downloadable by exact version so that existing lock files keep working.
+	VersionYanked VersionState = "yanked"
+	// VersionPending versions of modules requiring approval are neither listed nor downloadable until an organization
+	// admin other than their publisher approves them
+	VersionPending VersionState = "pending"
+	// VersionRejected versions were refused by an approver. They are never served and may be published again.
+	VersionRejected VersionState = "rejected"
+)
+
+// VersionLifecycle records the lifecycle state of a module version and why it was set
+type VersionLifecycle struct {
+	State VersionState `json:"state"`
+	// Reason is shown to users of the version
+	Reason string `json:"reason,omitempty"`
+	// Replacement suggests what to use instead, typically a newer version
+	Replacement string `json:"replacement,omitempty"`
+	// Link points to further information such as release notes or a security advisory
+	Link string `json:"link,omitempty"`
+	// RequestedBy is the publisher of a version awaiting or refused approval
+	RequestedBy string    `json:"requested_by,omitempty"`
+	UpdatedBy   string    `json:"updated_by,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at,omitempty"`
+}
+
+// ModuleVersionRef identifies a single module version
+type ModuleVersionRef struct {
+	Organization string `json:"organization"`
+	Name         string `json:"name"`
+	Provider     string `json:"provider"`
+	Version      string `json:"version"`
+}
+
+// Deletion records who removed a module version from the registry and when
+type Deletion struct {
+	ModuleVersionRef
+	DeletedBy string    `json:"deleted_by"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// ModuleSignature describes the verified detached signature of a version archive. The signature itself is stored by
+// the storage driver next to the archive under SignatureKey.
+type ModuleSignature struct {
+	Type         string    `json:"type"`
+	KeyID        string    `json:"key_id"`
+	SignatureKey string    `json:"signature_key"`
+	SignedAt     time.Time `json:"signed_at"`
+}
+
+// SignatureResponse returns the detached signature of a version archive
+type SignatureResponse struct {
+	Type      string `json:"type"`
+	KeyID     string `json:"key_id"`
+	Signature []byte `json:"signature"`
+	Checksum  string `json:"checksum"`
+}
+
+// ModuleDeprecation is the deprecation notice of a version in the module registry protocol versions response
+type ModuleDeprecation struct {
+	Reason string `json:"reason"`
+	Link   string `json:"link,omitempty"`
+}
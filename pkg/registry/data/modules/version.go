@@ -0,0 +1,115 @@
+package modules
+
+import "strings"
+
+// CompareVersions orders two semantic versions, returning -1, 0 or 1 when a is lower than, equal to or higher than b.
+// Build metadata is ignored and pre-releases are lower than the release they precede. Versions which are not valid
+// semantic versions sort after valid ones, by plain string comparison.
+func CompareVersions(a string, b string) int {
+	va, okA := parseVersion(a)
+	vb, okB := parseVersion(b)
+	switch {
+	case !okA && !okB:
+		return strings.Compare(a, b)
+	case !okA:
+		return 1
+	case !okB:
+		return -1
+	}
+	for i := 0; i < 3; i++ {
+		if c := compareNumeric(va.core[i], vb.core[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case va.prerelease == nil && vb.prerelease == nil:
+		return 0
+	case va.prerelease == nil:
+		return 1
+	case vb.prerelease == nil:
+		return -1
+	}
+	for i := 0; i < len(va.prerelease) && i < len(vb.prerelease); i++ {
+		if c := comparePrerelease(va.prerelease[i], vb.prerelease[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInt(len(va.prerelease), len(vb.prerelease))
+}
+
+type semanticVersion struct {
+	core       [3]string
+	prerelease []string
+}
+
+func parseVersion(version string) (*semanticVersion, bool) {
+	if i := strings.IndexByte(version, '+'); i >= 0 {
+		version = version[:i]
+	}
+	parsed := &semanticVersion{}
+	if i := strings.IndexByte(version, '-'); i >= 0 {
+		parsed.prerelease = strings.Split(version[i+1:], ".")
+		version = version[:i]
+		for _, identifier := range parsed.prerelease {
+			if identifier == "" {
+				return nil, false
+			}
+		}
+	}
+	core := strings.Split(version, ".")
+	if len(core) != 3 {
+		return nil, false
+	}
+	for i, number := range core {
+		if !isNumeric(number) {
+			return nil, false
+		}
+		parsed.core[i] = number
+	}
+	return parsed, true
+}
+
+func isNumeric(identifier string) bool {
+	if identifier == "" {
+		return false
+	}
+	for _, c := range identifier {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// compareNumeric compares numeric identifiers of any length, leading zeros are ignored
+func compareNumeric(a string, b string) int {
+	a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+	if c := compareInt(len(a), len(b)); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+// comparePrerelease compares pre-release identifiers, numeric identifiers are lower than alphanumeric ones
+func comparePrerelease(a string, b string) int {
+	numericA, numericB := isNumeric(a), isNumeric(b)
+	switch {
+	case numericA && numericB:
+		return compareNumeric(a, b)
+	case numericA:
+		return -1
+	case numericB:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func compareInt(a int, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
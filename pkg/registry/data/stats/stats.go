@@ -0,0 +1,41 @@
+package stats
+
+import "time"
+
+// Download records a single successful download of a module version archive
+type Download struct {
+	Organization string    `json:"organization"`
+	Name         string    `json:"name"`
+	Provider     string    `json:"provider"`
+	Version      string    `json:"version"`
+	Timestamp    time.Time `json:"timestamp"`
+	// Client identifies the downloader, either the subject of an authenticated caller or an HMAC of the client IP
+	// under a key kept in memory for a single day
+	Client string `json:"client"`
+}
+
+// DailyDownloads is the number of downloads of a module version on a single day in UTC
+type DailyDownloads struct {
+	Version   string `json:"version"`
+	Date      string `json:"date"`
+	Downloads int    `json:"downloads"`
+}
+
+type DayItem struct {
+	Date      string `json:"date"`
+	Downloads int    `json:"downloads"`
+}
+
+type VersionStatsItem struct {
+	Version   string     `json:"version"`
+	Downloads int        `json:"downloads"`
+	Days      []*DayItem `json:"days"`
+}
+
+type ModuleStatsResponse struct {
+	Organization string              `json:"organization"`
+	Name         string              `json:"name"`
+	Provider     string              `json:"provider"`
+	Downloads    int                 `json:"downloads"`
+	Versions     []*VersionStatsItem `json:"versions"`
+}
@@ -0,0 +1,37 @@
+package webhooks
+
+import (
+	"time"
+
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/events"
+)
+
+// DeliveryStatus is the progress of delivering an event to a webhook endpoint
+type DeliveryStatus string
+
+const (
+	// DeliveryPending deliveries are waiting for their next attempt
+	DeliveryPending DeliveryStatus = "pending"
+	// DeliveryDelivered deliveries were accepted by the endpoint
+	DeliveryDelivered DeliveryStatus = "delivered"
+	// DeliveryFailed deliveries were given up on, either after the last attempt or because the endpoint refused them
+	DeliveryFailed DeliveryStatus = "failed"
+)
+
+// Delivery is an event queued for, or sent to, a single webhook endpoint
+type Delivery struct {
+	ID string `json:"id"`
+	// Endpoint is the name of the configured endpoint the event is sent to
+	Endpoint string         `json:"endpoint"`
+	Event    *events.Event  `json:"event"`
+	Status   DeliveryStatus `json:"status"`
+	Attempts int            `json:"attempts"`
+	// NextAttemptAt is when a pending delivery is sent next
+	NextAttemptAt  time.Time `json:"next_attempt_at,omitempty"`
+	LastStatusCode int       `json:"last_status_code,omitempty"`
+	LastError      string    `json:"last_error,omitempty"`
+	// RedeliveryOf is the ID of the delivery this one repeats, when redelivered through the admin API
+	RedeliveryOf string    `json:"redelivery_of,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
@@ -5,15 +5,40 @@ package drivers
 import (
 	"context"
 
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/modules"
 	"github.com/terrariumcloud/terrarium-lite/pkg/registry/stores"
 )
 
 type TerrariumDatabaseDriver interface {
 	Connect(ctx context.Context) error
 	Modules() stores.ModuleStore
+	Stats() stores.StatsStore
+	Audit() stores.AuditStore
+	Webhooks() stores.WebhookStore
+	Events() stores.EventLogStore
+	// Close releases connections and any other resources held by the driver. It is called once on shutdown.
+	Close() error
 }
 
 type TerrariumStorageDriver interface {
 	GetBackingStoreName() string
 	FetchModuleSource(ctx context.Context, key string) ([]byte, error)
+	// StoreModuleSource stores an archive under key, replacing any archive already stored there
+	StoreModuleSource(ctx context.Context, key string, data []byte) error
+	// DeleteModuleSource removes the source stored under key. Deleting a key that does not exist is not an error.
+	DeleteModuleSource(ctx context.Context, key string) error
+	// Close releases connections and any other resources held by the driver. It is called once on shutdown.
+	Close() error
+}
+
+// IndexReporter may optionally be implemented by database drivers indexing the archives found in storage to report
+// the archives they refuse to serve
+type IndexReporter interface {
+	IndexProblems() []*modules.IndexProblem
+}
+
+// HealthChecker may optionally be implemented by database and storage drivers to take part in readiness checks.
+// HealthCheck should return an error describing why the backend cannot currently serve requests.
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
 }
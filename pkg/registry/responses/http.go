@@ -13,3 +13,40 @@ type APIResponseWriter interface {
 type APIErrorWriter interface {
 	Write(rw http.ResponseWriter, err error, statusCode int)
 }
+
+// ErrorWriterSelector returns the APIErrorWriter answering a request, so that middleware shared by every router writes
+// errors in the format of the router the request was matched to
+type ErrorWriterSelector func(r *http.Request) APIErrorWriter
+
+// DetailedError is an error carrying structured details that APIErrorWriter implementations return to clients
+// alongside the message, such as the individual problems found in a request
+type DetailedError interface {
+	error
+	Details() interface{}
+}
+
+// StatusError is an error answered with a status code of its own wherever it is returned from. APIErrorWriter
+// implementations use the status code of the first StatusError in the chain of an error over the one they are given,
+// so that they need not know every package defining typed errors.
+type StatusError interface {
+	error
+	StatusCode() int
+}
+
+// NewStatusError returns an error with the given message that is answered with statusCode
+func NewStatusError(statusCode int, message string) error {
+	return &statusError{statusCode: statusCode, message: message}
+}
+
+type statusError struct {
+	statusCode int
+	message    string
+}
+
+func (e *statusError) Error() string {
+	return e.message
+}
+
+func (e *statusError) StatusCode() int {
+	return e.statusCode
+}
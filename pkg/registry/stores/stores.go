@@ -1,11 +1,82 @@
 package stores
 
 import (
+	"context"
+	"net/http"
+
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/audit"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/events"
 	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/modules"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/stats"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/data/webhooks"
+	"github.com/terrariumcloud/terrarium-lite/pkg/registry/responses"
 )
 
+// ErrModuleVersionNotFound is returned when a requested module version does not exist
+var ErrModuleVersionNotFound = responses.NewStatusError(http.StatusNotFound, "module version not found")
+
+// ErrModuleNotFound is returned when a requested module has no versions
+var ErrModuleNotFound = responses.NewStatusError(http.StatusNotFound, "module not found")
+
+// ErrDeliveryNotFound is returned when a requested webhook delivery does not exist
+var ErrDeliveryNotFound = responses.NewStatusError(http.StatusNotFound, "webhook delivery not found")
+
+// ModuleStore provides access to module metadata. Every method takes the context of the request it serves so that
+// implementations can propagate traces and abandon work when the client goes away.
 type ModuleStore interface {
-	Init() error
-	ReadModuleVersions(orgName string, moduleName string, providerName string) ([]*modules.Module, error)
-	ReadModuleVersionSource(orgName string, moduleName string, providerName string, version string) (string, error)
+	Init(ctx context.Context) error
+	ReadModuleVersions(ctx context.Context, orgName string, moduleName string, providerName string) ([]*modules.Module, error)
+	ReadModuleVersionSource(ctx context.Context, orgName string, moduleName string, providerName string, version string) (string, error)
+	// ReadModuleVersion returns a single version, or ErrModuleVersionNotFound when it does not exist
+	ReadModuleVersion(ctx context.Context, orgName string, moduleName string, providerName string, version string) (*modules.Module, error)
+	// PublishModuleVersion adds a version, or replaces an existing version along with its recorded checksum. The
+	// lifecycle of the module is stored with it when set, otherwise the version keeps any lifecycle it had.
+	PublishModuleVersion(ctx context.Context, module *modules.Module) error
+	// UpdateVersionLifecycle sets the lifecycle state of a version, returning ErrModuleVersionNotFound when it does not exist
+	UpdateVersionLifecycle(ctx context.Context, orgName string, moduleName string, providerName string, version string, lifecycle *modules.VersionLifecycle) error
+	// ReadOrganizationModules returns every version of every module of an organization
+	ReadOrganizationModules(ctx context.Context, orgName string) ([]*modules.Module, error)
+	// DeleteModuleVersion removes a version from the store and records the deletion, returning
+	// ErrModuleVersionNotFound when it does not exist
+	DeleteModuleVersion(ctx context.Context, deletion *modules.Deletion) error
+}
+
+// StatsStore records module downloads and aggregates them for usage reporting
+type StatsStore interface {
+	// RecordDownload records a download, reporting whether it was the first download of the version since it was last
+	// published. Deleting a version resets it.
+	RecordDownload(ctx context.Context, download *stats.Download) (bool, error)
+	// ReadDownloadCounts returns the number of downloads per version and day of a module, ordered by semantic version and date
+	ReadDownloadCounts(ctx context.Context, orgName string, moduleName string, providerName string) ([]*stats.DailyDownloads, error)
+}
+
+// AuditStore keeps an append only trail of the changes made to the registry. Recorded events are never modified or
+// removed through the store. Every database driver provides one through TerrariumDatabaseDriver.Audit, so the trail
+// lives wherever the driver keeps the rest of the registry state; the filesystem driver writes it to a JSON lines file.
+type AuditStore interface {
+	// RecordEvent appends an event to the trail, it must be durable once RecordEvent returns without error
+	RecordEvent(ctx context.Context, event *audit.Event) error
+	// ReadEvents returns the events matching a filter, oldest first
+	ReadEvents(ctx context.Context, filter *audit.Filter) ([]*audit.Event, error)
+}
+
+// WebhookStore persists the queue of webhook deliveries so that events are not lost when the registry restarts.
+// Implementations may discard old delivered and failed deliveries.
+type WebhookStore interface {
+	// SaveDelivery adds a delivery or replaces the stored delivery with the same ID
+	SaveDelivery(ctx context.Context, delivery *webhooks.Delivery) error
+	// ReadDelivery returns a single delivery, or ErrDeliveryNotFound when it does not exist
+	ReadDelivery(ctx context.Context, id string) (*webhooks.Delivery, error)
+	// ReadDeliveries returns the deliveries with a status, or every delivery when status is empty, most recent first
+	ReadDeliveries(ctx context.Context, status webhooks.DeliveryStatus) ([]*webhooks.Delivery, error)
+}
+
+// EventLogStore keeps a bounded log of recent registry events so that event stream clients can catch up on the
+// events they missed while disconnected. Implementations discard the oldest events beyond their bound.
+type EventLogStore interface {
+	// AppendEvent logs an event under the next sequence number
+	AppendEvent(ctx context.Context, event *events.Event) (*events.Logged, error)
+	// ReadEventsAfter returns the logged events following a sequence number, oldest first. It reports false when
+	// events following it are no longer logged, or when the sequence number was never handed out.
+	ReadEventsAfter(ctx context.Context, sequence uint64) ([]*events.Logged, bool, error)
 }